@@ -3,33 +3,154 @@ package configs
 import (
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Server   struct {
-		HostAddress          string `yaml:"hostAddress" env:"RUN_ADDRESS" env-description:"Server start address"`
+	Repository struct {
+		SavePath string `yaml:"savePath" env:"FILE_STORAGE_PATH" env-description:"File of the in-memory storage"`
+		InMemory bool   `yaml:"inMemory" env:"IN_MEMORY" env-description:"Use the in-memory storage instead of the database"`
+	} `yaml:"repository"`
+	Server struct {
+		HostAddress          string `yaml:"hostAddress" env:"RUN_ADDRESS" env-default:"localhost:8080" env-description:"Server start address"`
 		AccuralSystemAddress string `yaml:"accuralSystemAddress" env:"ACCRUAL_SYSTEM_ADDRESS" env-description:"Accural system address"`
+		ReadHeaderTimeout    int    `yaml:"readHeaderTimeout" env:"READ_HEADER_TIMEOUT" env-default:"10" env-description:"Seconds to read the headers of a request"`
+		ReadTimeout          int    `yaml:"readTimeout" env:"READ_TIMEOUT" env-default:"30" env-description:"Seconds to read a whole request"`
+		WriteTimeout         int    `yaml:"writeTimeout" env:"WRITE_TIMEOUT" env-description:"Seconds to write a response, zero for no limit; a limit also cuts the order stream"`
+		IdleTimeout          int    `yaml:"idleTimeout" env:"IDLE_TIMEOUT" env-default:"120" env-description:"Seconds a keep-alive connection waits for the next request"`
+		MaxHeaderBytes       int    `yaml:"maxHeaderBytes" env:"MAX_HEADER_BYTES" env-default:"1048576" env-description:"Size limit of the request headers in bytes"`
 	} `yaml:"server"`
+	Worker struct {
+		WorkersCount     int `yaml:"workersCount" env:"WORKERS_COUNT" env-default:"5" env-description:"Workers processing orders and webhooks"`
+		BufferSize       int `yaml:"bufferSize" env:"WORKER_BUFFER_SIZE" env-default:"100" env-description:"Tasks queued for the workers at most"`
+		ErrMaximumAmount int `yaml:"errMaximumAmount" env:"WORKER_ERR_MAXIMUM_AMOUNT" env-default:"100" env-description:"Task errors kept by the worker pool"`
+	} `yaml:"worker"`
+	Accrual struct {
+		MaxRetries int `yaml:"maxRetries" env:"ACCRUAL_MAX_RETRIES" env-default:"5" env-description:"Retries of a failed request to the accrual system"`
+		RetryDelay int `yaml:"retryDelay" env:"ACCRUAL_RETRY_DELAY" env-default:"1000" env-description:"Milliseconds before a retry of the accrual system"`
+	} `yaml:"accrual"`
 	Database struct {
+		Driver   string `yaml:"driver" env:"DB_DRIVER" env-default:"postgres" env-description:"Database driver: postgres or sqlite"`
+		Path     string `yaml:"path" env:"DB_PATH" env-default:"./data/store.db" env-description:"SQLite database file"`
 		Host     string `yaml:"host" env:"DB_HOST" env-description:"Database host-address"`
 		Port     string `yaml:"port" env:"DB_PORT" env-description:"Database port"`
 		Dbname   string `yaml:"dbname" env:"DB_NAME" env-description:"Database name"`
 		User     string `yaml:"user" env:"DB_USER" env-description:"Database user"`
 		Password string `yaml:"password" env:"DB_PASSWORD" env-description:"Database password"`
+		// The pool limits apply to Postgres, SQLite always uses one
+		// connection.
+		MaxOpenConns    int `yaml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS" env-default:"25" env-description:"Open database connections at most"`
+		MaxIdleConns    int `yaml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS" env-default:"5" env-description:"Idle database connections kept at most"`
+		ConnMaxLifetime int `yaml:"connMaxLifetime" env:"DB_CONN_MAX_LIFETIME" env-default:"1800" env-description:"Seconds a database connection is reused for"`
+		ConnMaxIdleTime int `yaml:"connMaxIdleTime" env:"DB_CONN_MAX_IDLE_TIME" env-default:"300" env-description:"Seconds a database connection stays idle before it is closed"`
 	} `yaml:"database"`
 	Auth struct {
-		TokenExp          int    `yaml:"tokenExp" env:"TOKEN_EXP" env-description:"Expire time for token"`
-		SecretKey         string `yaml:"secretKey" env:"SECRET_KEY" env-description:"Secret key for token"`
-		PasswordSecretKey string `yaml:"passwordSecretKey" env:"PASSWORD_SECRET_KEY" env-description:"Secret key for password"`
+		TokenExp              int    `yaml:"tokenExp" env:"TOKEN_EXP" env-default:"10800" env-description:"Token lifetime in seconds"`
+		SecretKey             string `yaml:"secretKey" env:"SECRET_KEY" env-description:"Secret key for token"`
+		PasswordSecretKey     string `yaml:"passwordSecretKey" env:"PASSWORD_SECRET_KEY" env-description:"Secret key for password"`
+		MaxLoginAttempts      int    `yaml:"maxLoginAttempts" env:"MAX_LOGIN_ATTEMPTS" env-default:"5" env-description:"Failed logins per account before lockout"`
+		MaxLoginAttemptsPerIP int    `yaml:"maxLoginAttemptsPerIP" env:"MAX_LOGIN_ATTEMPTS_PER_IP" env-default:"20" env-description:"Failed logins per IP before lockout"`
+		LockoutBase           int    `yaml:"lockoutBase" env:"LOCKOUT_BASE" env-default:"30" env-description:"First lockout duration in seconds"`
+		LockoutMax            int    `yaml:"lockoutMax" env:"LOCKOUT_MAX" env-default:"3600" env-description:"Maximum lockout duration in seconds"`
+		PasswordMinLength     int    `yaml:"passwordMinLength" env:"PASSWORD_MIN_LENGTH" env-default:"8" env-description:"Minimum password length"`
+		PasswordMaxLength     int    `yaml:"passwordMaxLength" env:"PASSWORD_MAX_LENGTH" env-default:"72" env-description:"Maximum password length in bytes"`
+		BreachedPasswordsPath string `yaml:"breachedPasswordsPath" env:"BREACHED_PASSWORDS_PATH" env-description:"Path to a list of breached passwords"`
+		PasswordHashAlgorithm string `yaml:"passwordHashAlgorithm" env:"PASSWORD_HASH_ALGORITHM" env-default:"argon2id" env-description:"Password hash algorithm: bcrypt or argon2id"`
+		BcryptCost            int    `yaml:"bcryptCost" env:"BCRYPT_COST" env-default:"10" env-description:"bcrypt cost"`
+		Argon2Time            int    `yaml:"argon2Time" env:"ARGON2_TIME" env-default:"3" env-description:"Argon2id number of passes"`
+		Argon2Memory          int    `yaml:"argon2Memory" env:"ARGON2_MEMORY" env-default:"65536" env-description:"Argon2id memory in KiB"`
+		Argon2Threads         int    `yaml:"argon2Threads" env:"ARGON2_THREADS" env-default:"4" env-description:"Argon2id parallelism"`
+		TOTPIssuer            string `yaml:"totpIssuer" env:"TOTP_ISSUER" env-default:"go_store" env-description:"Issuer shown in authenticator apps"`
+		MFAPendingExp         int    `yaml:"mfaPendingExp" env:"MFA_PENDING_EXP" env-default:"300" env-description:"Lifetime of the token between password and second factor in seconds"`
+		MFAWithdrawThreshold  int    `yaml:"mfaWithdrawThreshold" env:"MFA_WITHDRAW_THRESHOLD" env-default:"1000" env-description:"Withdrawals above this sum require a fresh second factor"`
+		MFAFreshness          int    `yaml:"mfaFreshness" env:"MFA_FRESHNESS" env-default:"300" env-description:"How long a second factor verification stays fresh in seconds"`
+		ResetTokenTTL         int    `yaml:"resetTokenTTL" env:"RESET_TOKEN_TTL" env-default:"3600" env-description:"Password reset token lifetime in seconds"`
 	} `yaml:"auth"`
+	Cookie struct {
+		Domain   string `yaml:"domain" env:"COOKIE_DOMAIN" env-description:"Domain of the auth cookies, the host of the request if empty"`
+		Secure   bool   `yaml:"secure" env:"COOKIE_SECURE" env-description:"Send the auth cookies over HTTPS only"`
+		SameSite string `yaml:"sameSite" env:"COOKIE_SAME_SITE" env-default:"lax" env-description:"SameSite attribute of the auth cookies: lax, strict or none"`
+	} `yaml:"cookie"`
+	Notifier struct {
+		Type string `yaml:"type" env:"NOTIFIER_TYPE" env-default:"log" env-description:"Notifier type: log or file"`
+		Path string `yaml:"path" env:"NOTIFIER_PATH" env-description:"Output file of the file notifier"`
+	} `yaml:"notifier"`
+	Outbox struct {
+		Publisher      string `yaml:"publisher" env:"OUTBOX_PUBLISHER" env-default:"file" env-description:"Event publisher: file or webhook"`
+		Path           string `yaml:"path" env:"OUTBOX_PATH" env-description:"Output file of the file publisher, stdout if empty"`
+		WebhookURL     string `yaml:"webhookURL" env:"OUTBOX_WEBHOOK_URL" env-description:"URL the webhook publisher posts events to"`
+		WebhookTimeout int    `yaml:"webhookTimeout" env:"OUTBOX_WEBHOOK_TIMEOUT" env-default:"10" env-description:"Webhook request timeout in seconds"`
+		PollInterval   int    `yaml:"pollInterval" env:"OUTBOX_POLL_INTERVAL" env-default:"1" env-description:"Seconds between outbox polls"`
+		BatchSize      int    `yaml:"batchSize" env:"OUTBOX_BATCH_SIZE" env-default:"100" env-description:"Events read from the outbox at once"`
+		MaxAttempts    int    `yaml:"maxAttempts" env:"OUTBOX_MAX_ATTEMPTS" env-default:"10" env-description:"Attempts to publish an event before it is marked dead"`
+		RetryDelay     int    `yaml:"retryDelay" env:"OUTBOX_RETRY_DELAY" env-default:"5" env-description:"Seconds before the first retry of an event, doubled on every attempt"`
+		GapTimeout     int    `yaml:"gapTimeout" env:"OUTBOX_GAP_TIMEOUT" env-default:"30" env-description:"Seconds a missing event ID is waited for, more than twice the transaction timeout"`
+	} `yaml:"outbox"`
+	Webhooks struct {
+		Timeout     int `yaml:"timeout" env:"WEBHOOK_TIMEOUT" env-default:"10" env-description:"Webhook request timeout in seconds"`
+		MaxAttempts int `yaml:"maxAttempts" env:"WEBHOOK_MAX_ATTEMPTS" env-default:"6" env-description:"Delivery attempts per webhook event"`
+		RetryDelay  int `yaml:"retryDelay" env:"WEBHOOK_RETRY_DELAY" env-default:"5" env-description:"Seconds before the first retry, doubled on every next one"`
+	} `yaml:"webhooks"`
+	Stream struct {
+		Heartbeat   int `yaml:"heartbeat" env:"STREAM_HEARTBEAT" env-default:"15" env-description:"Seconds between heartbeats of the order stream"`
+		HistorySize int `yaml:"historySize" env:"STREAM_HISTORY_SIZE" env-default:"100" env-description:"Events kept per user for Last-Event-ID reconnects"`
+		Retention   int `yaml:"retention" env:"STREAM_RETENTION" env-default:"3600" env-description:"Seconds the events of a user nobody listens to are kept"`
+	} `yaml:"stream"`
+	Withdrawals struct {
+		HoldTTL         int `yaml:"holdTTL" env:"WITHDRAWAL_HOLD_TTL" env-default:"900" env-description:"Seconds a withdrawal hold waits for confirmation"`
+		ExpiryInterval  int `yaml:"expiryInterval" env:"WITHDRAWAL_EXPIRY_INTERVAL" env-default:"30" env-description:"Seconds between runs of the hold expiry job"`
+		ExpiryBatchSize int `yaml:"expiryBatchSize" env:"WITHDRAWAL_EXPIRY_BATCH_SIZE" env-default:"100" env-description:"Expired holds released per transaction batch"`
+	} `yaml:"withdrawals"`
+	Points struct {
+		ValidMonths     int `yaml:"validMonths" env:"POINTS_VALID_MONTHS" env-description:"Months accrued points stay valid, zero keeps them forever"`
+		ExpiryInterval  int `yaml:"expiryInterval" env:"POINTS_EXPIRY_INTERVAL" env-default:"3600" env-description:"Seconds between runs of the points expiry job"`
+		ExpiryBatchSize int `yaml:"expiryBatchSize" env:"POINTS_EXPIRY_BATCH_SIZE" env-default:"100" env-description:"Point lots read per batch of the expiry job"`
+		UpcomingDays    int `yaml:"upcomingDays" env:"POINTS_UPCOMING_DAYS" env-default:"30" env-description:"Days ahead the balance shows expiring points for"`
+	} `yaml:"points"`
+	Transfers struct {
+		DailySum   int `yaml:"dailySum" env:"TRANSFER_DAILY_SUM" env-default:"5000" env-description:"Points a user may transfer per day"`
+		DailyCount int `yaml:"dailyCount" env:"TRANSFER_DAILY_COUNT" env-default:"10" env-description:"Transfers a user may make per day"`
+	} `yaml:"transfers"`
+	AccrualRules struct {
+		Mode           string `yaml:"mode" env:"ACCRUAL_RULES_MODE" env-default:"off" env-description:"Use of the local accrual rules: off, fallback or replace"`
+		Path           string `yaml:"path" env:"ACCRUAL_RULES_PATH" env-default:"./configs/accrual_rules.yml" env-description:"YAML file with the local accrual rules"`
+		ReloadInterval int    `yaml:"reloadInterval" env:"ACCRUAL_RULES_RELOAD_INTERVAL" env-default:"10" env-description:"Seconds between checks of the rules file for changes"`
+	} `yaml:"accrualRules"`
+	Reconciliation struct {
+		Enabled   bool   `yaml:"enabled" env:"RECONCILE_ENABLED" env-description:"Run the reconciliation job against the accrual system"`
+		Interval  int    `yaml:"interval" env:"RECONCILE_INTERVAL" env-default:"3600" env-description:"Seconds between runs of the reconciliation job"`
+		Window    int    `yaml:"window" env:"RECONCILE_WINDOW" env-default:"604800" env-description:"Seconds back the reconciliation job checks orders for"`
+		MinAge    int    `yaml:"minAge" env:"RECONCILE_MIN_AGE" env-default:"600" env-description:"Seconds an order is left to be processed before it is checked"`
+		BatchSize int    `yaml:"batchSize" env:"RECONCILE_BATCH_SIZE" env-default:"100" env-description:"Orders read per batch of the reconciliation"`
+		Fix       bool   `yaml:"fix" env:"RECONCILE_FIX" env-description:"Credit the points users are found to be missing"`
+		ReportDir string `yaml:"reportDir" env:"RECONCILE_REPORT_DIR" env-description:"Directory the reconciliation reports are written to, logged only if empty"`
+	} `yaml:"reconciliation"`
+	Timeouts struct {
+		Request     int `yaml:"request" env:"REQUEST_TIMEOUT" env-default:"30" env-description:"Seconds an HTTP request may take, except the order stream"`
+		Transaction int `yaml:"transaction" env:"TRANSACTION_TIMEOUT" env-default:"10" env-description:"Seconds a database transaction may stay open"`
+		Accrual     int `yaml:"accrual" env:"ACCRUAL_TIMEOUT" env-default:"10" env-description:"Seconds a request to the accrual system may take"`
+	} `yaml:"timeouts"`
+	Tracing struct {
+		Exporter    string `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none" env-description:"Span exporter: none, stdout or file"`
+		Path        string `yaml:"path" env:"TRACING_PATH" env-default:"./data/spans.jsonl" env-description:"Output file of the file exporter"`
+		ServiceName string `yaml:"serviceName" env:"TRACING_SERVICE_NAME" env-default:"go_store" env-description:"Service name the spans are exported with"`
+	} `yaml:"tracing"`
+	Log struct {
+		Level              string `yaml:"level" env:"LOG_LEVEL" env-default:"info" env-description:"Lowest level logged: debug, info, warn or error"`
+		Format             string `yaml:"format" env:"LOG_FORMAT" env-default:"console" env-description:"Log format: json or console"`
+		SamplingInitial    int    `yaml:"samplingInitial" env:"LOG_SAMPLING_INITIAL" env-description:"Lines with the same level and message logged each second before sampling starts, zero disables sampling"`
+		SamplingThereafter int    `yaml:"samplingThereafter" env:"LOG_SAMPLING_THEREAFTER" env-default:"100" env-description:"One of this many lines is logged once sampling has started"`
+		File               string `yaml:"file" env:"LOG_FILE" env-description:"File the log is written to, stderr if empty"`
+		MaxSize            int    `yaml:"maxSize" env:"LOG_MAX_SIZE" env-default:"100" env-description:"Megabytes the log file grows to before it is rotated"`
+		MaxBackups         int    `yaml:"maxBackups" env:"LOG_MAX_BACKUPS" env-default:"5" env-description:"Rotated log files kept"`
+		MaxAge             int    `yaml:"maxAge" env:"LOG_MAX_AGE" env-default:"30" env-description:"Days rotated log files are kept"`
+		Compress           bool   `yaml:"compress" env:"LOG_COMPRESS" env-description:"Gzip the rotated log files"`
+	} `yaml:"log"`
 }
 
 type argsCommandLine struct {
@@ -46,13 +167,18 @@ type argsCommandLine struct {
 	PasswordSecretKey    string
 }
 
+// defaultConfigPath is read when neither -c nor CONFIG_PATH is set.
+const defaultConfigPath = "./configs/config.yml"
+
 func processArgs(argsToParse []string) (*argsCommandLine, map[string]bool, error) {
 	a := new(argsCommandLine)
 	f := flag.NewFlagSet("order_service", flag.ContinueOnError)
 
-	f.StringVar(&a.ConfigPath, "c",
-		"/home/ortem917/go/src/github.com/OrtemRepos/go_store/configs/config.yml",
-		"Path to configuration file")
+	configPath := os.Getenv("CONFIG_PATH")
+	if configPath == "" {
+		configPath = defaultConfigPath
+	}
+	f.StringVar(&a.ConfigPath, "c", configPath, "Path to configuration file, $CONFIG_PATH if set")
 	f.StringVar(&a.HostAddress, "a", "", "Server start address")
 	f.StringVar(&a.AccuralSystemAddress, "r", "", "Accural system address")
 	f.StringVar(&a.Host, "db-address", "", "Database host-address")
@@ -100,20 +226,25 @@ func GetConfig(argsToParse []string) (*Config, error) {
 	if err := overrideConfig(cfg, args, setFlags); err != nil {
 		return nil, fmt.Errorf("config override error: %w", err)
 	}
-	cfg.Auth.TokenExp *= int(time.Second)
-	logConfig(cfg)
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 	return cfg, nil
 }
 
-var flagMapping = map[string]string{
-	"db-address":  "Database.Host",
-	"db-port":     "Database.Port",
-	"db-name":     "Database.Dbname",
-	"db-user":     "Database.User",
-	"db-password": "Database.Password",
-	"t":           "Auth.TokenExp",
-	"sk":          "Auth.SecretKey",
-	"psk":         "Auth.PasswordSecKey",
+// flagMapping maps every flag to the argsCommandLine field holding its
+// value and to the config field it overrides.
+var flagMapping = map[string]struct{ arg, field string }{
+	"a":           {"HostAddress", "Server.HostAddress"},
+	"r":           {"AccuralSystemAddress", "Server.AccuralSystemAddress"},
+	"db-address":  {"Host", "Database.Host"},
+	"db-port":     {"DatabasePort", "Database.Port"},
+	"db-name":     {"Dbname", "Database.Dbname"},
+	"db-user":     {"DatabaseUser", "Database.User"},
+	"db-password": {"DatabasePassword", "Database.Password"},
+	"t":           {"TokenExp", "Auth.TokenExp"},
+	"sk":          {"SecretKey", "Auth.SecretKey"},
+	"psk":         {"PasswordSecretKey", "Auth.PasswordSecretKey"},
 }
 
 func overrideConfig(cfg *Config, args *argsCommandLine, setFlags map[string]bool) error {
@@ -121,20 +252,17 @@ func overrideConfig(cfg *Config, args *argsCommandLine, setFlags map[string]bool
 	cfgVal := reflect.ValueOf(cfg).Elem()
 
 	for flagName := range setFlags {
-		fieldPath, ok := flagMapping[flagName]
+		mapping, ok := flagMapping[flagName]
 		if !ok {
 			continue
 		}
 
-		field := argsVal.FieldByNameFunc(func(name string) bool {
-			return strings.EqualFold(name, flagName)
-		})
-
+		field := argsVal.FieldByName(mapping.arg)
 		if !field.IsValid() {
 			continue
 		}
 
-		if err := setConfigValue(cfgVal, fieldPath, field); err != nil {
+		if err := setConfigValue(cfgVal, mapping.field, field); err != nil {
 			return err
 		}
 	}
@@ -207,12 +335,3 @@ func setFieldValue(field, value reflect.Value) error {
 		return fmt.Errorf("unsupported field type: %s", field.Type())
 	}
 }
-
-func logConfig(cfg *Config) {
-	log.Println("Loaded configuration:")
-	log.Printf("Database.Host: %s", cfg.Database.Host)
-	log.Printf("Database.Port: %s", cfg.Database.Port)
-	log.Printf("Database.Dbname: %s", cfg.Database.Dbname)
-	log.Printf("Database.User: %s", cfg.Database.User)
-	log.Printf("Auth.TokenExp: %v", cfg.Auth.TokenExp)
-}
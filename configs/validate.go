@@ -0,0 +1,184 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Validate reports every setting that is out of range or not one of the
+// supported values, joined in one error.
+func (c *Config) Validate() error {
+	var errs []error
+	positive := func(name string, v int) {
+		if v <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be greater than zero, got %d", name, v))
+		}
+	}
+	nonNegative := func(name string, v int) {
+		if v < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %d", name, v))
+		}
+	}
+	oneOf := func(name, v string, allowed ...string) {
+		if !slices.Contains(allowed, v) {
+			errs = append(errs, fmt.Errorf("%s must be one of %s, got %q", name, strings.Join(allowed, ", "), v))
+		}
+	}
+	between := func(name string, v int, lo, hi int64) {
+		if int64(v) < lo || int64(v) > hi {
+			errs = append(errs, fmt.Errorf("%s must be between %d and %d, got %d", name, lo, hi, v))
+		}
+	}
+	required := func(name, v string) {
+		if v == "" {
+			errs = append(errs, fmt.Errorf("%s must not be empty", name))
+		}
+	}
+
+	required("server.hostAddress", c.Server.HostAddress)
+	nonNegative("server.readHeaderTimeout", c.Server.ReadHeaderTimeout)
+	nonNegative("server.readTimeout", c.Server.ReadTimeout)
+	nonNegative("server.writeTimeout", c.Server.WriteTimeout)
+	nonNegative("server.idleTimeout", c.Server.IdleTimeout)
+	positive("server.maxHeaderBytes", c.Server.MaxHeaderBytes)
+
+	positive("worker.workersCount", c.Worker.WorkersCount)
+	positive("worker.bufferSize", c.Worker.BufferSize)
+	positive("worker.errMaximumAmount", c.Worker.ErrMaximumAmount)
+
+	nonNegative("accrual.maxRetries", c.Accrual.MaxRetries)
+	positive("accrual.retryDelay", c.Accrual.RetryDelay)
+
+	oneOf("database.driver", c.Database.Driver, "postgres", "sqlite")
+	if c.Database.Driver == "sqlite" {
+		required("database.path", c.Database.Path)
+	}
+	nonNegative("database.maxOpenConns", c.Database.MaxOpenConns)
+	nonNegative("database.maxIdleConns", c.Database.MaxIdleConns)
+	nonNegative("database.connMaxLifetime", c.Database.ConnMaxLifetime)
+	nonNegative("database.connMaxIdleTime", c.Database.ConnMaxIdleTime)
+
+	positive("auth.tokenExp", c.Auth.TokenExp)
+	required("auth.secretKey", c.Auth.SecretKey)
+	positive("auth.maxLoginAttempts", c.Auth.MaxLoginAttempts)
+	positive("auth.maxLoginAttemptsPerIP", c.Auth.MaxLoginAttemptsPerIP)
+	positive("auth.lockoutBase", c.Auth.LockoutBase)
+	if c.Auth.LockoutMax < c.Auth.LockoutBase {
+		errs = append(errs, fmt.Errorf("auth.lockoutMax must not be less than auth.lockoutBase"))
+	}
+	positive("auth.passwordMinLength", c.Auth.PasswordMinLength)
+	if c.Auth.PasswordMaxLength < c.Auth.PasswordMinLength {
+		errs = append(errs, fmt.Errorf("auth.passwordMaxLength must not be less than auth.passwordMinLength"))
+	}
+	oneOf("auth.passwordHashAlgorithm", c.Auth.PasswordHashAlgorithm, "bcrypt", "argon2id")
+	between("auth.bcryptCost", c.Auth.BcryptCost, int64(bcrypt.MinCost), int64(bcrypt.MaxCost))
+	between("auth.argon2Time", c.Auth.Argon2Time, 1, math.MaxUint32)
+	between("auth.argon2Memory", c.Auth.Argon2Memory, 1, math.MaxUint32)
+	between("auth.argon2Threads", c.Auth.Argon2Threads, 1, math.MaxUint8)
+	required("auth.totpIssuer", c.Auth.TOTPIssuer)
+	positive("auth.mfaPendingExp", c.Auth.MFAPendingExp)
+	nonNegative("auth.mfaWithdrawThreshold", c.Auth.MFAWithdrawThreshold)
+	positive("auth.mfaFreshness", c.Auth.MFAFreshness)
+	positive("auth.resetTokenTTL", c.Auth.ResetTokenTTL)
+
+	oneOf("cookie.sameSite", c.Cookie.SameSite, "lax", "strict", "none")
+	if c.Cookie.SameSite == "none" && !c.Cookie.Secure {
+		errs = append(errs, fmt.Errorf("cookie.sameSite none requires cookie.secure"))
+	}
+
+	oneOf("notifier.type", c.Notifier.Type, "log", "file")
+	if c.Notifier.Type == "file" {
+		required("notifier.path", c.Notifier.Path)
+	}
+
+	oneOf("outbox.publisher", c.Outbox.Publisher, "file", "webhook")
+	if c.Outbox.Publisher == "webhook" {
+		if u, err := url.Parse(c.Outbox.WebhookURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("outbox.webhookURL must be an absolute URL with the webhook publisher"))
+		}
+	}
+	positive("outbox.webhookTimeout", c.Outbox.WebhookTimeout)
+	positive("outbox.pollInterval", c.Outbox.PollInterval)
+	positive("outbox.batchSize", c.Outbox.BatchSize)
+	positive("outbox.maxAttempts", c.Outbox.MaxAttempts)
+	positive("outbox.retryDelay", c.Outbox.RetryDelay)
+	positive("outbox.gapTimeout", c.Outbox.GapTimeout)
+	if c.Timeouts.Transaction > 0 && c.Outbox.GapTimeout <= 2*c.Timeouts.Transaction {
+		errs = append(errs, fmt.Errorf("outbox.gapTimeout must be more than twice timeouts.transaction"))
+	}
+
+	positive("webhooks.timeout", c.Webhooks.Timeout)
+	positive("webhooks.maxAttempts", c.Webhooks.MaxAttempts)
+	positive("webhooks.retryDelay", c.Webhooks.RetryDelay)
+
+	positive("stream.heartbeat", c.Stream.Heartbeat)
+	positive("stream.historySize", c.Stream.HistorySize)
+	positive("stream.retention", c.Stream.Retention)
+
+	positive("withdrawals.holdTTL", c.Withdrawals.HoldTTL)
+	positive("withdrawals.expiryInterval", c.Withdrawals.ExpiryInterval)
+	positive("withdrawals.expiryBatchSize", c.Withdrawals.ExpiryBatchSize)
+
+	nonNegative("points.validMonths", c.Points.ValidMonths)
+	positive("points.expiryInterval", c.Points.ExpiryInterval)
+	positive("points.expiryBatchSize", c.Points.ExpiryBatchSize)
+	nonNegative("points.upcomingDays", c.Points.UpcomingDays)
+
+	nonNegative("transfers.dailySum", c.Transfers.DailySum)
+	nonNegative("transfers.dailyCount", c.Transfers.DailyCount)
+
+	oneOf("accrualRules.mode", c.AccrualRules.Mode, "off", "fallback", "replace")
+	if c.AccrualRules.Mode != "off" {
+		required("accrualRules.path", c.AccrualRules.Path)
+	}
+	positive("accrualRules.reloadInterval", c.AccrualRules.ReloadInterval)
+
+	positive("reconciliation.interval", c.Reconciliation.Interval)
+	positive("reconciliation.window", c.Reconciliation.Window)
+	nonNegative("reconciliation.minAge", c.Reconciliation.MinAge)
+	positive("reconciliation.batchSize", c.Reconciliation.BatchSize)
+
+	nonNegative("timeouts.request", c.Timeouts.Request)
+	nonNegative("timeouts.transaction", c.Timeouts.Transaction)
+	positive("timeouts.accrual", c.Timeouts.Accrual)
+
+	oneOf("tracing.exporter", c.Tracing.Exporter, "none", "stdout", "file")
+	if c.Tracing.Exporter == "file" {
+		required("tracing.path", c.Tracing.Path)
+	}
+
+	oneOf("log.level", c.Log.Level, "debug", "info", "warn", "error")
+	oneOf("log.format", c.Log.Format, "json", "console")
+	nonNegative("log.samplingInitial", c.Log.SamplingInitial)
+	if c.Log.SamplingInitial > 0 {
+		positive("log.samplingThereafter", c.Log.SamplingThereafter)
+	}
+	nonNegative("log.maxSize", c.Log.MaxSize)
+	nonNegative("log.maxBackups", c.Log.MaxBackups)
+	nonNegative("log.maxAge", c.Log.MaxAge)
+	return errors.Join(errs...)
+}
+
+const redacted = "[REDACTED]"
+
+// Redacted returns a copy of the config with the secrets replaced, fit to
+// be printed or logged.
+func (c Config) Redacted() Config {
+	for _, secret := range []*string{
+		&c.Database.Password, &c.Auth.SecretKey, &c.Auth.PasswordSecretKey,
+	} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	if u, err := url.Parse(c.Outbox.WebhookURL); err == nil {
+		c.Outbox.WebhookURL = u.Redacted()
+	}
+	return c
+}
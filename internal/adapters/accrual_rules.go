@@ -0,0 +1,123 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+type accrualRulesFile struct {
+	Rules domain.AccrualRules `yaml:"rules"`
+}
+
+type accrualRulesResponse struct {
+	Order   string `json:"order"`
+	Status  string `json:"status"`
+	Accrual *int   `json:"accrual,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Source  string `json:"source"`
+}
+
+// AccrualRules is a local accrual system that grants points by the rules
+// of a YAML file. The file is read again when it changes; if the new rules
+// are invalid they are ignored and the previous ones stay in use. Orders no
+// rule applies to are INVALID.
+type AccrualRules struct {
+	path           string
+	reloadInterval time.Duration
+	mu             sync.RWMutex
+	rules          domain.AccrualRules
+	modTime        time.Time
+	logger         *zap.Logger
+}
+
+// NewAccrualRules reads the rules of path, which Watch checks for changes
+// every reloadInterval.
+func NewAccrualRules(path string, reloadInterval time.Duration, logger *zap.Logger) (*AccrualRules, error) {
+	if reloadInterval <= 0 {
+		return nil, fmt.Errorf("reloadInterval[time.Duration] must be greater than zero")
+	}
+	r := &AccrualRules{path: path, reloadInterval: reloadInterval, logger: logger.Named("accrual-rules")}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the rules file if it changed since the last read and
+// reports whether new rules were loaded.
+func (r *AccrualRules) Reload() (bool, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false, fmt.Errorf("can't read the accrual rules: %w", err)
+	}
+	// The time is taken before the file is parsed, so invalid rules are
+	// reported once per change and not on every check.
+	r.mu.Lock()
+	unchanged := info.ModTime().Equal(r.modTime)
+	r.modTime = info.ModTime()
+	r.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return false, fmt.Errorf("can't read the accrual rules: %w", err)
+	}
+	var file accrualRulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return false, fmt.Errorf("%w: %w", domain.ErrInvalidAccrualRule, err)
+	}
+	if err := file.Rules.Validate(); err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	r.rules = file.Rules
+	r.mu.Unlock()
+	r.logger.Info("accrual rules loaded", zap.String("path", r.path), zap.Int("rules", len(file.Rules)))
+	return true, nil
+}
+
+// Watch reloads the rules every reload interval until ctx is done.
+func (r *AccrualRules) Watch(ctx context.Context) {
+	ticker := time.NewTicker(r.reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := r.Reload(); err != nil {
+			r.logger.Error("can't reload the accrual rules, keeping the previous ones", zap.Error(err))
+		}
+	}
+}
+
+func (r *AccrualRules) OrderInfo(_ context.Context, order domain.Order) (*domain.Order, []byte, error) {
+	r.mu.RLock()
+	rule, ok := r.rules.Match(&order)
+	r.mu.RUnlock()
+	response := accrualRulesResponse{Order: order.Number, Source: "local-rules"}
+	if ok {
+		accrual := rule.Accrual(&order)
+		order.Status = domain.PROCESSED
+		order.Accural = &accrual
+		response.Accrual = &accrual
+		response.Rule = rule.Name
+	} else {
+		order.Status = domain.INVALID
+		order.Accural = nil
+	}
+	response.Status = string(order.Status)
+	// The response is a plain struct, so marshalling can't fail.
+	body, _ := json.Marshal(response)
+	return &order, body, nil
+}
@@ -0,0 +1,77 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type APIKeyStorageImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewAPIKeyStorage(db *gorm.DB, logger *zap.Logger) *APIKeyStorageImpl {
+	err := db.AutoMigrate(domain.APIKey{})
+	if err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
+	return &APIKeyStorageImpl{db: db, logger: logger}
+}
+
+func (s *APIKeyStorageImpl) Save(ctx context.Context, key *domain.APIKey) error {
+	if err := s.db.WithContext(ctx).Create(key).Error; err != nil {
+		s.logger.Error("failed to save API key", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *APIKeyStorageImpl) GetByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	var key domain.APIKey
+	err := s.db.WithContext(ctx).Where("key_hash = ?", keyHash).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.Join(domain.ErrAPIKeyNotFound, err)
+	} else if err != nil {
+		s.logger.Error("failed to get API key", zap.Error(err))
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *APIKeyStorageImpl) ListByUser(ctx context.Context, userID uint) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at ASC").Find(&keys).Error
+	if err != nil {
+		s.logger.Error("failed to list API keys", zap.Uint("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *APIKeyStorageImpl) Revoke(ctx context.Context, userID, id uint) error {
+	result := s.db.WithContext(ctx).Model(&domain.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		s.logger.Error("failed to revoke API key", zap.Uint("id", id), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *APIKeyStorageImpl) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	err := s.db.WithContext(ctx).Model(&domain.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+	if err != nil {
+		s.logger.Warn("failed to update API key usage", zap.Uint("id", id), zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package adapters
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+// Postgres error codes of failures a new attempt may not hit.
+var transientSQLStates = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// SQLite result codes of a database locked by another connection.
+const (
+	sqliteBusy   = 5
+	sqliteLocked = 6
+)
+
+// classifyDBError marks the database failures that may go away if the
+// transaction is retried: lost or refused connections, serialization
+// failures, deadlocks and a busy SQLite database. Other errors, including
+// the domain errors of the repositories, are returned as they are.
+func classifyDBError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		state := pgErr.SQLState()
+		if transientSQLStates[state] || strings.HasPrefix(state, "08") {
+			return domain.Transient(err)
+		}
+		return err
+	}
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		if code := sqliteErr.Code() & 0xff; code == sqliteBusy || code == sqliteLocked {
+			return domain.Transient(err)
+		}
+		return err
+	}
+	var netErr net.Error
+	var retryable interface{ SafeToRetry() bool }
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) ||
+		(errors.As(err, &retryable) && retryable.SafeToRetry()) {
+		return domain.Transient(err)
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+// FileEventPublisher appends events to a file, or to stdout if the path is
+// empty, as JSON lines.
+type FileEventPublisher struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileEventPublisher(path string) *FileEventPublisher {
+	return &FileEventPublisher{path: path}
+}
+
+func (p *FileEventPublisher) Publish(_ context.Context, event *domain.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.path == "" {
+		_, err = os.Stdout.Write(append(line, '\n'))
+		return err
+	}
+	file, err := os.OpenFile(p.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("can't open the events file: %w", err)
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// WebhookEventPublisher posts every event as JSON to a URL. Any status
+// other than 2xx is a failed delivery and the event is sent again later.
+// The X-Event-ID header lets the receiver drop duplicates.
+type WebhookEventPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookEventPublisher(url string, timeout time.Duration) (*WebhookEventPublisher, error) {
+	if url == "" {
+		return nil, fmt.Errorf("webhookURL[string] must not be empty")
+	}
+	return &WebhookEventPublisher{url: url, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (p *WebhookEventPublisher) Publish(ctx context.Context, event *domain.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatUint(uint64(event.ID), 10))
+	req.Header.Set("X-Event-Type", string(event.Type))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -12,16 +12,18 @@ import (
 )
 
 type ProviderJWT struct {
-	tokenExp  time.Duration
-	logger    *zap.Logger
-	secretKey []byte
+	tokenExp      time.Duration
+	mfaPendingExp time.Duration
+	logger        *zap.Logger
+	secretKey     []byte
 }
 
 func NewProviderJWT(cfg *configs.Config, logger *zap.Logger) *ProviderJWT {
 	return &ProviderJWT{
-		tokenExp:  time.Duration(cfg.Auth.TokenExp),
-		secretKey: []byte(cfg.Auth.SecretKey),
-		logger:    logger,
+		tokenExp:      time.Duration(cfg.Auth.TokenExp) * time.Second,
+		mfaPendingExp: time.Duration(cfg.Auth.MFAPendingExp) * time.Second,
+		secretKey:     []byte(cfg.Auth.SecretKey),
+		logger:        logger,
 	}
 }
 
@@ -29,16 +31,30 @@ var (
 	ErrNotValidToken = errors.New("not valid token")
 )
 
-func (pj *ProviderJWT) BuildJWTString(id uint) (string, error) {
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodHS256,
-		ports.Claims{
-			RegisteredClaims: jwt.RegisteredClaims{
-				ExpiresAt: jwt.NewNumericDate(time.Now().Add(pj.tokenExp)),
-			},
-			UserID: id,
-		},
-	)
+func (pj *ProviderJWT) BuildJWTString(id uint, sessionVersion int, mfaAt time.Time) (string, error) {
+	claims := ports.Claims{
+		UserID:         id,
+		SessionVersion: sessionVersion,
+	}
+	if !mfaAt.IsZero() {
+		claims.MFAAt = mfaAt.Unix()
+	}
+	return pj.sign(claims, pj.tokenExp)
+}
+
+func (pj *ProviderJWT) BuildMFAPendingString(id uint, sessionVersion int) (string, error) {
+	return pj.sign(ports.Claims{
+		UserID:         id,
+		SessionVersion: sessionVersion,
+		Purpose:        ports.PurposeMFAPending,
+	}, pj.mfaPendingExp)
+}
+
+func (pj *ProviderJWT) sign(claims ports.Claims, exp time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp)),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString(pj.secretKey)
 	if err != nil {
@@ -71,4 +87,4 @@ func (pj *ProviderJWT) GetClaims(tokenString string) (*ports.Claims, error) {
 	}
 
 	return claims, nil
-}
\ No newline at end of file
+}
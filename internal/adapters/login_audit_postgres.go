@@ -0,0 +1,29 @@
+package adapters
+
+import (
+	"context"
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type LoginAuditImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewLoginAudit(db *gorm.DB, logger *zap.Logger) *LoginAuditImpl {
+	err := db.AutoMigrate(domain.FailedLogin{})
+	if err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
+	return &LoginAuditImpl{db: db, logger: logger}
+}
+
+func (a *LoginAuditImpl) RecordFailedLogin(ctx context.Context, attempt *domain.FailedLogin) error {
+	if err := a.db.WithContext(ctx).Create(attempt).Error; err != nil {
+		a.logger.Error("failed to record failed login", zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package adapters
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+func (s *MemoryStore) LoginAudit() *MemoryLoginAudit { return &MemoryLoginAudit{store: s} }
+
+func (s *MemoryStore) PasswordResets() *MemoryPasswordResetStorage {
+	return &MemoryPasswordResetStorage{store: s}
+}
+
+func (s *MemoryStore) APIKeys() *MemoryAPIKeyStorage { return &MemoryAPIKeyStorage{store: s} }
+
+func (s *MemoryStore) MFA() *MemoryMFAStorage { return &MemoryMFAStorage{store: s} }
+
+type MemoryLoginAudit struct {
+	store *MemoryStore
+}
+
+func (m *MemoryLoginAudit) RecordFailedLogin(ctx context.Context, attempt *domain.FailedLogin) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		attempt.ID = st.nextID("failed_logins")
+		attempt.CreatedAt = time.Now()
+		st.FailedLogins = append(st.FailedLogins, *attempt)
+		return nil
+	})
+}
+
+type MemoryPasswordResetStorage struct {
+	store *MemoryStore
+}
+
+func (m *MemoryPasswordResetStorage) Save(ctx context.Context, token *domain.PasswordResetToken) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		for _, other := range st.ResetTokens {
+			if other.TokenHash == token.TokenHash {
+				return domain.ErrDuplicateKey
+			}
+		}
+		token.ID = st.nextID("password_reset_tokens")
+		token.CreatedAt = time.Now()
+		st.ResetTokens[token.ID] = *token
+		return nil
+	})
+}
+
+func (m *MemoryPasswordResetStorage) Consume(ctx context.Context, tokenHash string) (*domain.PasswordResetToken, error) {
+	var consumed *domain.PasswordResetToken
+	err := m.store.update(ctx, nil, func(st *memoryState) error {
+		now := time.Now()
+		for id, token := range st.ResetTokens {
+			if token.TokenHash != tokenHash || token.UsedAt != nil || !token.ExpiresAt.After(now) {
+				continue
+			}
+			token.UsedAt = &now
+			st.ResetTokens[id] = token
+			consumed = &token
+			return nil
+		}
+		return domain.ErrResetTokenInvalid
+	})
+	return consumed, err
+}
+
+func (m *MemoryPasswordResetStorage) DeleteForUser(ctx context.Context, userID uint) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		for id, token := range st.ResetTokens {
+			if token.UserID == userID {
+				delete(st.ResetTokens, id)
+			}
+		}
+		return nil
+	})
+}
+
+type MemoryAPIKeyStorage struct {
+	store *MemoryStore
+}
+
+func (m *MemoryAPIKeyStorage) Save(ctx context.Context, key *domain.APIKey) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		for _, other := range st.APIKeys {
+			if other.KeyHash == key.KeyHash {
+				return domain.ErrDuplicateKey
+			}
+		}
+		key.ID = st.nextID("api_keys")
+		key.CreatedAt = time.Now()
+		st.APIKeys[key.ID] = *key
+		return nil
+	})
+}
+
+func (m *MemoryAPIKeyStorage) GetByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	var found *domain.APIKey
+	err := m.store.view(ctx, nil, func(st *memoryState) error {
+		for _, key := range st.APIKeys {
+			if key.KeyHash == keyHash {
+				key := key
+				found = &key
+				return nil
+			}
+		}
+		return domain.ErrAPIKeyNotFound
+	})
+	return found, err
+}
+
+func (m *MemoryAPIKeyStorage) ListByUser(ctx context.Context, userID uint) ([]*domain.APIKey, error) {
+	var keys []*domain.APIKey
+	err := m.store.view(ctx, nil, func(st *memoryState) error {
+		for _, key := range st.APIKeys {
+			if key.UserID == userID {
+				key := key
+				keys = append(keys, &key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (m *MemoryAPIKeyStorage) Revoke(ctx context.Context, userID, id uint) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		key, ok := st.APIKeys[id]
+		if !ok || key.UserID != userID || key.RevokedAt != nil {
+			return domain.ErrAPIKeyNotFound
+		}
+		now := time.Now()
+		key.RevokedAt = &now
+		st.APIKeys[id] = key
+		return nil
+	})
+}
+
+func (m *MemoryAPIKeyStorage) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		if key, ok := st.APIKeys[id]; ok {
+			key.LastUsedAt = &at
+			st.APIKeys[id] = key
+		}
+		return nil
+	})
+}
+
+type MemoryMFAStorage struct {
+	store *MemoryStore
+}
+
+func (m *MemoryMFAStorage) UpdateTOTP(ctx context.Context, user *domain.User) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		if stored, ok := st.Users[user.ID]; ok {
+			stored.TOTPSecret = user.TOTPSecret
+			stored.TOTPEnabled = user.TOTPEnabled
+			stored.TOTPLastStep = user.TOTPLastStep
+			st.Users[user.ID] = stored
+		}
+		return nil
+	})
+}
+
+func (m *MemoryMFAStorage) ReplaceRecoveryCodes(ctx context.Context, userID uint, codes []*domain.RecoveryCode) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		for id, code := range st.RecoveryCodes {
+			if code.UserID == userID {
+				delete(st.RecoveryCodes, id)
+			}
+		}
+		for _, code := range codes {
+			code.ID = st.nextID("recovery_codes")
+			code.CreatedAt = time.Now()
+			st.RecoveryCodes[code.ID] = *code
+		}
+		return nil
+	})
+}
+
+func (m *MemoryMFAStorage) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		for id, code := range st.RecoveryCodes {
+			if code.UserID == userID && code.CodeHash == codeHash && code.UsedAt == nil {
+				now := time.Now()
+				code.UsedAt = &now
+				st.RecoveryCodes[id] = code
+				return nil
+			}
+		}
+		return domain.ErrInvalidMFACode
+	})
+}
@@ -0,0 +1,608 @@
+package adapters
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type MemoryOrderRepository struct {
+	store *MemoryStore
+	tx    *memoryState
+}
+
+func (m *MemoryOrderRepository) Create(ctx context.Context, order *domain.Order) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		if order.ID != 0 {
+			if _, ok := st.Orders[order.ID]; ok {
+				return domain.ErrDuplicateKey
+			}
+		}
+		return saveOrder(st, order, time.Now().Truncate(time.Microsecond))
+	})
+}
+
+func (m *MemoryOrderRepository) GetByNumber(ctx context.Context, number string) (*domain.Order, error) {
+	var found *domain.Order
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, order := range st.Orders {
+			if order.Number == number {
+				order := order
+				found = &order
+				return nil
+			}
+		}
+		return domain.ErrOrderNotFound
+	})
+	return found, err
+}
+
+func (m *MemoryOrderRepository) List(ctx context.Context, userID uint, query domain.ListQuery) (*domain.Page[*domain.Order], error) {
+	var orders []*domain.Order
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, order := range st.Orders {
+			if order.UserID != userID || !hasStatus(query.Statuses, order.Status) {
+				continue
+			}
+			order := order
+			orders = append(orders, &order)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := func(o *domain.Order) domain.Cursor { return domain.Cursor{CreatedAt: o.CreatedAt, ID: o.ID} }
+	return newPage(memoryKeysetPage(orders, query, key), query.Limit, key), nil
+}
+
+func (m *MemoryOrderRepository) Complete(ctx context.Context, order *domain.Order) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		for id, stored := range st.Orders {
+			if stored.Number != order.Number {
+				continue
+			}
+			if stored.Completed {
+				return domain.ErrOrderAlreadyCompleted
+			}
+			stored.Status = order.Status
+			stored.Accural = order.Accural
+			stored.Completed = true
+			stored.Failure = ""
+			st.Orders[id] = stored
+			order.Completed = true
+			return nil
+		}
+		return domain.ErrOrderAlreadyCompleted
+	})
+}
+
+func (m *MemoryOrderRepository) MarkNeedsAttention(ctx context.Context, order *domain.Order) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		for id, stored := range st.Orders {
+			if stored.Number != order.Number {
+				continue
+			}
+			if stored.Completed {
+				return domain.ErrOrderAlreadyCompleted
+			}
+			stored.Status = domain.NEEDS_ATTENTION
+			stored.Failure = order.Failure
+			st.Orders[id] = stored
+			order.Status = domain.NEEDS_ATTENTION
+			return nil
+		}
+		return domain.ErrOrderAlreadyCompleted
+	})
+}
+
+func (m *MemoryOrderRepository) Correct(ctx context.Context, previous, order *domain.Order) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		for id, stored := range st.Orders {
+			if stored.Number != order.Number {
+				continue
+			}
+			if !stored.Completed || stored.Status != previous.Status || !sameAccrual(stored.Accural, previous.Accural) {
+				return domain.ErrOrderChanged
+			}
+			stored.Status = order.Status
+			stored.Accural = order.Accural
+			st.Orders[id] = stored
+			order.Completed = true
+			return nil
+		}
+		return domain.ErrOrderChanged
+	})
+}
+
+func (m *MemoryOrderRepository) ListAll(ctx context.Context, query domain.ListQuery) (*domain.Page[*domain.Order], error) {
+	var orders []*domain.Order
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, order := range st.Orders {
+			order := order
+			orders = append(orders, &order)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := func(o *domain.Order) domain.Cursor { return domain.Cursor{CreatedAt: o.CreatedAt, ID: o.ID} }
+	return newPage(memoryKeysetPage(orders, query, key), query.Limit, key), nil
+}
+
+func (m *MemoryOrderRepository) Accrued(ctx context.Context, userID uint) (int, error) {
+	accrued := 0
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, order := range st.Orders {
+			if order.UserID == userID && order.Status == domain.PROCESSED && order.Accural != nil {
+				accrued += *order.Accural
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return accrued, nil
+}
+
+func sameAccrual(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+type MemoryWithdrawalRepository struct {
+	store *MemoryStore
+	tx    *memoryState
+}
+
+func (m *MemoryWithdrawalRepository) Create(ctx context.Context, withdraw *domain.Withdraw) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		return saveWithdraw(st, withdraw, time.Now().Truncate(time.Microsecond))
+	})
+}
+
+func (m *MemoryWithdrawalRepository) GetByNumber(ctx context.Context, number string) (*domain.Withdraw, error) {
+	var withdraw *domain.Withdraw
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, stored := range st.Withdraws {
+			if stored.Number == number {
+				withdraw = &stored
+				return nil
+			}
+		}
+		return domain.ErrWithdrawalNotFound
+	})
+	return withdraw, err
+}
+
+func (m *MemoryWithdrawalRepository) Resolve(ctx context.Context, withdraw *domain.Withdraw) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		stored, ok := st.Withdraws[withdraw.ID]
+		if !ok || stored.Status != domain.HELD {
+			return domain.ErrWithdrawalNotHeld
+		}
+		stored.Status = withdraw.Status
+		stored.ResolvedAt = withdraw.ResolvedAt
+		st.Withdraws[withdraw.ID] = stored
+		return nil
+	})
+}
+
+func (m *MemoryWithdrawalRepository) ListExpiredHolds(ctx context.Context, now time.Time, limit int) ([]*domain.Withdraw, error) {
+	var withdraws []*domain.Withdraw
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, withdraw := range st.Withdraws {
+			if withdraw.Status == domain.HELD && withdraw.ExpiresAt != nil && !withdraw.ExpiresAt.After(now) {
+				withdraw := withdraw
+				withdraws = append(withdraws, &withdraw)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(withdraws, func(i, j int) bool {
+		if !withdraws[i].ExpiresAt.Equal(*withdraws[j].ExpiresAt) {
+			return withdraws[i].ExpiresAt.Before(*withdraws[j].ExpiresAt)
+		}
+		return withdraws[i].ID < withdraws[j].ID
+	})
+	if len(withdraws) > limit {
+		withdraws = withdraws[:limit]
+	}
+	return withdraws, nil
+}
+
+func (m *MemoryWithdrawalRepository) List(ctx context.Context, userID uint, query domain.ListQuery) (*domain.Page[*domain.Withdraw], error) {
+	var withdraws []*domain.Withdraw
+	id := strconv.FormatUint(uint64(userID), 10)
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, withdraw := range st.Withdraws {
+			if withdraw.UserID == id {
+				withdraw := withdraw
+				withdraws = append(withdraws, &withdraw)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := func(w *domain.Withdraw) domain.Cursor { return domain.Cursor{CreatedAt: w.CreatedAt, ID: w.ID} }
+	return newPage(memoryKeysetPage(withdraws, query, key), query.Limit, key), nil
+}
+
+// memoryKeysetPage mirrors keysetPage for rows already loaded in memory.
+func memoryKeysetPage[T any](items []T, query domain.ListQuery, key func(T) domain.Cursor) []T {
+	desc := query.Sort == domain.SortDesc
+	less := func(a, b domain.Cursor) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if desc {
+			return less(key(items[j]), key(items[i]))
+		}
+		return less(key(items[i]), key(items[j]))
+	})
+	result := items[:0]
+	for _, item := range items {
+		k := key(item)
+		if query.From != nil && k.CreatedAt.Before(*query.From) {
+			continue
+		}
+		if query.To != nil && !k.CreatedAt.Before(*query.To) {
+			continue
+		}
+		if query.Cursor != nil {
+			if desc && !less(k, *query.Cursor) || !desc && !less(*query.Cursor, k) {
+				continue
+			}
+		}
+		result = append(result, item)
+		if len(result) > query.Limit {
+			break
+		}
+	}
+	return result
+}
+
+func hasStatus[S comparable](statuses []S, status S) bool {
+	if len(statuses) == 0 {
+		return true
+	}
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+type MemoryOutbox struct {
+	store *MemoryStore
+	tx    *memoryState
+}
+
+func (m *MemoryOutbox) Add(ctx context.Context, events ...*domain.Event) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		for _, event := range events {
+			event.ID = st.nextID("outbox_events")
+			event.CreatedAt = time.Now()
+			st.Events[event.ID] = *event
+		}
+		return nil
+	})
+}
+
+func (m *MemoryOutbox) Pending(ctx context.Context, afterID uint, limit int) ([]*domain.Event, error) {
+	var events []*domain.Event
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, event := range st.Events {
+			if event.PublishedAt == nil && event.DeadAt == nil && event.ID > afterID {
+				event := event
+				events = append(events, &event)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (m *MemoryOutbox) Committed(ctx context.Context, afterID uint, limit int) ([]*domain.Event, error) {
+	var events []*domain.Event
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, event := range st.Events {
+			if event.ID > afterID {
+				events = append(events, &domain.Event{ID: event.ID, CreatedAt: event.CreatedAt})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (m *MemoryOutbox) MarkPublished(ctx context.Context, id uint, at time.Time) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		if event, ok := st.Events[id]; ok {
+			event.PublishedAt = &at
+			st.Events[id] = event
+		}
+		return nil
+	})
+}
+
+func (m *MemoryOutbox) MarkFailed(ctx context.Context, id uint, reason string, retryAt time.Time) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		if event, ok := st.Events[id]; ok {
+			event.Attempts++
+			event.LastError = reason
+			event.RetryAt = &retryAt
+			st.Events[id] = event
+		}
+		return nil
+	})
+}
+
+func (m *MemoryOutbox) MarkDead(ctx context.Context, id uint, reason string, at time.Time) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		if event, ok := st.Events[id]; ok {
+			event.Attempts++
+			event.LastError = reason
+			event.DeadAt = &at
+			st.Events[id] = event
+		}
+		return nil
+	})
+}
+
+type MemoryOrderHistory struct {
+	store *MemoryStore
+	tx    *memoryState
+}
+
+func (m *MemoryOrderHistory) Add(ctx context.Context, change *domain.OrderStatusChange) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		change.ID = st.nextID("order_status_history")
+		change.CreatedAt = time.Now()
+		st.History[change.ID] = *change
+		return nil
+	})
+}
+
+func (m *MemoryOrderHistory) List(ctx context.Context, number string) ([]*domain.OrderStatusChange, error) {
+	var changes []*domain.OrderStatusChange
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, change := range st.History {
+			if change.Number == number {
+				change := change
+				changes = append(changes, &change)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+	return changes, nil
+}
+
+type MemoryPointLots struct {
+	store *MemoryStore
+	tx    *memoryState
+}
+
+func (m *MemoryPointLots) Add(ctx context.Context, lot *domain.PointLot) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		lot.ID = st.nextID("point_lots")
+		lot.CreatedAt = time.Now()
+		st.Lots[lot.ID] = *lot
+		return nil
+	})
+}
+
+func (m *MemoryPointLots) Available(ctx context.Context, userID uint) ([]*domain.PointLot, error) {
+	return m.find(ctx, func(lot domain.PointLot) bool {
+		return lot.UserID == userID && lot.Remaining > 0
+	}, 0)
+}
+
+func (m *MemoryPointLots) Take(ctx context.Context, usages []*domain.PointLotUsage) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		for _, usage := range usages {
+			lot, ok := st.Lots[usage.LotID]
+			if !ok || lot.Remaining < usage.Amount {
+				return domain.ErrPointLotChanged
+			}
+			lot.Remaining -= usage.Amount
+			st.Lots[lot.ID] = lot
+			usage.ID = st.nextID("point_lot_usages")
+			usage.CreatedAt = time.Now()
+			st.LotUsages[usage.ID] = *usage
+		}
+		return nil
+	})
+}
+
+func (m *MemoryPointLots) Release(ctx context.Context, number string) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		for id, usage := range st.LotUsages {
+			if usage.Number != number {
+				continue
+			}
+			if lot, ok := st.Lots[usage.LotID]; ok {
+				lot.Remaining += usage.Amount
+				st.Lots[lot.ID] = lot
+			}
+			delete(st.LotUsages, id)
+		}
+		return nil
+	})
+}
+
+func (m *MemoryPointLots) ListExpired(ctx context.Context, now time.Time, after *domain.PointLot, limit int) ([]*domain.PointLot, error) {
+	return m.find(ctx, func(lot domain.PointLot) bool {
+		if after != nil && (lot.ExpiresAt.Before(after.ExpiresAt) ||
+			lot.ExpiresAt.Equal(after.ExpiresAt) && lot.ID <= after.ID) {
+			return false
+		}
+		return lot.Remaining > 0 && !lot.ExpiresAt.After(now)
+	}, limit)
+}
+
+func (m *MemoryPointLots) Expire(ctx context.Context, expiry *domain.PointExpiry, remaining int) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		lot, ok := st.Lots[expiry.LotID]
+		if !ok || lot.Remaining != remaining {
+			return domain.ErrPointLotChanged
+		}
+		lot.Remaining = 0
+		st.Lots[lot.ID] = lot
+		expiry.ID = st.nextID("point_expiries")
+		st.Expiries[expiry.ID] = *expiry
+		return nil
+	})
+}
+
+func (m *MemoryPointLots) Upcoming(ctx context.Context, userID uint, until time.Time) ([]*domain.PointLot, error) {
+	return m.find(ctx, func(lot domain.PointLot) bool {
+		return lot.UserID == userID && lot.Remaining > 0 && lot.ExpiresAt.Before(until)
+	}, 0)
+}
+
+func (m *MemoryPointLots) Expired(ctx context.Context, userID uint) (int, error) {
+	expired := 0
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, expiry := range st.Expiries {
+			if expiry.UserID == userID {
+				expired += expiry.Amount
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return expired, nil
+}
+
+// find returns the matching lots, the ones that expire first first. A
+// limit of zero returns all of them.
+func (m *MemoryPointLots) find(ctx context.Context, match func(lot domain.PointLot) bool, limit int) ([]*domain.PointLot, error) {
+	var lots []*domain.PointLot
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, lot := range st.Lots {
+			if match(lot) {
+				lot := lot
+				lots = append(lots, &lot)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(lots, func(i, j int) bool {
+		if !lots[i].ExpiresAt.Equal(lots[j].ExpiresAt) {
+			return lots[i].ExpiresAt.Before(lots[j].ExpiresAt)
+		}
+		return lots[i].ID < lots[j].ID
+	})
+	if limit > 0 && len(lots) > limit {
+		lots = lots[:limit]
+	}
+	return lots, nil
+}
+
+type MemoryTransferRepository struct {
+	store *MemoryStore
+	tx    *memoryState
+}
+
+func (m *MemoryTransferRepository) Create(ctx context.Context, transfer *domain.Transfer) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		transfer.ID = st.nextID("transfers")
+		transfer.CreatedAt = time.Now().Truncate(time.Microsecond)
+		st.Transfers[transfer.ID] = *transfer
+		return nil
+	})
+}
+
+func (m *MemoryTransferRepository) SentSince(ctx context.Context, userID uint, since time.Time) (domain.TransferTotals, error) {
+	var totals domain.TransferTotals
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, transfer := range st.Transfers {
+			if transfer.SenderID == userID && !transfer.CreatedAt.Before(since) {
+				totals.Sum += transfer.Sum
+				totals.Count++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return domain.TransferTotals{}, err
+	}
+	return totals, nil
+}
+
+func (m *MemoryTransferRepository) List(ctx context.Context, userID uint, query domain.ListQuery) (*domain.Page[*domain.Transfer], error) {
+	var transfers []*domain.Transfer
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, transfer := range st.Transfers {
+			if transfer.SenderID == userID || transfer.RecipientID == userID {
+				transfer := transfer
+				transfers = append(transfers, &transfer)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := func(t *domain.Transfer) domain.Cursor { return domain.Cursor{CreatedAt: t.CreatedAt, ID: t.ID} }
+	return newPage(memoryKeysetPage(transfers, query, key), query.Limit, key), nil
+}
+
+func (m *MemoryTransferRepository) Net(ctx context.Context, userID uint) (int, error) {
+	net := 0
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, transfer := range st.Transfers {
+			if transfer.RecipientID == userID {
+				net += transfer.Sum
+			}
+			if transfer.SenderID == userID {
+				net -= transfer.Sum
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return net, nil
+}
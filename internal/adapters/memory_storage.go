@@ -0,0 +1,462 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"go.uber.org/zap"
+)
+
+// memoryState holds all tables of the in-memory backend. It is written
+// with gob rather than JSON because the domain types hide fields such as
+// password hashes from their JSON form.
+type memoryState struct {
+	LastID        map[string]uint
+	Users         map[uint]domain.User
+	Orders        map[uint]domain.Order
+	Withdraws     map[uint]domain.Withdraw
+	FailedLogins  []domain.FailedLogin
+	ResetTokens   map[uint]domain.PasswordResetToken
+	APIKeys       map[uint]domain.APIKey
+	RecoveryCodes map[uint]domain.RecoveryCode
+	Events        map[uint]domain.Event
+	Webhooks      map[uint]domain.Webhook
+	Deliveries    map[uint]domain.WebhookDelivery
+	History       map[uint]domain.OrderStatusChange
+	Lots          map[uint]domain.PointLot
+	LotUsages     map[uint]domain.PointLotUsage
+	Expiries      map[uint]domain.PointExpiry
+	Transfers     map[uint]domain.Transfer
+}
+
+func newMemoryState() *memoryState {
+	return &memoryState{
+		LastID:        make(map[string]uint),
+		Users:         make(map[uint]domain.User),
+		Orders:        make(map[uint]domain.Order),
+		Withdraws:     make(map[uint]domain.Withdraw),
+		ResetTokens:   make(map[uint]domain.PasswordResetToken),
+		APIKeys:       make(map[uint]domain.APIKey),
+		RecoveryCodes: make(map[uint]domain.RecoveryCode),
+		Events:        make(map[uint]domain.Event),
+		Webhooks:      make(map[uint]domain.Webhook),
+		Deliveries:    make(map[uint]domain.WebhookDelivery),
+		History:       make(map[uint]domain.OrderStatusChange),
+		Lots:          make(map[uint]domain.PointLot),
+		LotUsages:     make(map[uint]domain.PointLotUsage),
+		Expiries:      make(map[uint]domain.PointExpiry),
+		Transfers:     make(map[uint]domain.Transfer),
+	}
+}
+
+func (st *memoryState) nextID(table string) uint {
+	st.LastID[table]++
+	return st.LastID[table]
+}
+
+func (st *memoryState) clone() *memoryState {
+	c := newMemoryState()
+	for k, v := range st.LastID {
+		c.LastID[k] = v
+	}
+	copyMap(c.Users, st.Users)
+	copyMap(c.Orders, st.Orders)
+	copyMap(c.Withdraws, st.Withdraws)
+	c.FailedLogins = append(c.FailedLogins, st.FailedLogins...)
+	copyMap(c.ResetTokens, st.ResetTokens)
+	copyMap(c.APIKeys, st.APIKeys)
+	copyMap(c.RecoveryCodes, st.RecoveryCodes)
+	copyMap(c.Events, st.Events)
+	copyMap(c.Webhooks, st.Webhooks)
+	copyMap(c.Deliveries, st.Deliveries)
+	copyMap(c.History, st.History)
+	copyMap(c.Lots, st.Lots)
+	copyMap(c.LotUsages, st.LotUsages)
+	copyMap(c.Expiries, st.Expiries)
+	copyMap(c.Transfers, st.Transfers)
+	return c
+}
+
+func copyMap[T any](dst, src map[uint]T) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+// MemoryStore is an in-memory implementation of the storage ports with the
+// same uniqueness rules and errors as the Postgres adapters. It is meant
+// for tests and local runs; if savePath is not empty the state is loaded
+// from the file on start and written back after every change.
+type MemoryStore struct {
+	mu       sync.Mutex
+	state    *memoryState
+	savePath string
+	logger   *zap.Logger
+}
+
+func NewMemoryStore(savePath string, logger *zap.Logger) (*MemoryStore, error) {
+	s := &MemoryStore{state: newMemoryState(), savePath: savePath, logger: logger}
+	if savePath == "" {
+		return s, nil
+	}
+	file, err := os.Open(savePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("can't read the storage file: %w", err)
+	}
+	defer file.Close()
+	state := newMemoryState()
+	if err := gob.NewDecoder(file).Decode(state); err != nil {
+		return nil, fmt.Errorf("can't decode the storage file: %w", err)
+	}
+	// Tables added after the file was written are decoded as nil maps.
+	if state.Events == nil {
+		state.Events = make(map[uint]domain.Event)
+	}
+	if state.Webhooks == nil {
+		state.Webhooks = make(map[uint]domain.Webhook)
+		state.Deliveries = make(map[uint]domain.WebhookDelivery)
+	}
+	if state.History == nil {
+		state.History = make(map[uint]domain.OrderStatusChange)
+	}
+	if state.Lots == nil {
+		state.Lots = make(map[uint]domain.PointLot)
+		state.LotUsages = make(map[uint]domain.PointLotUsage)
+		state.Expiries = make(map[uint]domain.PointExpiry)
+	}
+	if state.Transfers == nil {
+		state.Transfers = make(map[uint]domain.Transfer)
+	}
+	s.state = state
+	return s, nil
+}
+
+// view runs fn under the store lock unless it is already held by a
+// transaction. Like a query of the database, it fails once ctx is done.
+func (s *MemoryStore) view(ctx context.Context, tx *memoryState, fn func(st *memoryState) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if tx != nil {
+		return fn(tx)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s.state)
+}
+
+// update is view for changes: a failed fn leaves the state untouched and a
+// successful one is persisted.
+func (s *MemoryStore) update(ctx context.Context, tx *memoryState, fn func(st *memoryState) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if tx != nil {
+		return fn(tx)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.state.clone()
+	if err := fn(next); err != nil {
+		return err
+	}
+	s.state = next
+	return s.persist()
+}
+
+func (s *MemoryStore) persist() error {
+	if s.savePath == "" {
+		return nil
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(s.state); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.savePath), 0o755); err != nil {
+		return err
+	}
+	tmp := s.savePath + ".tmp"
+	if err := os.WriteFile(tmp, data.Bytes(), 0o600); err != nil {
+		s.logger.Error("failed to save the in-memory storage", zap.Error(err))
+		return err
+	}
+	return os.Rename(tmp, s.savePath)
+}
+
+func (s *MemoryStore) Users() *MemoryUserStorage { return &MemoryUserStorage{store: s} }
+
+func (s *MemoryStore) Orders() *MemoryOrderRepository { return &MemoryOrderRepository{store: s} }
+
+func (s *MemoryStore) Withdrawals() *MemoryWithdrawalRepository {
+	return &MemoryWithdrawalRepository{store: s}
+}
+
+func (s *MemoryStore) Outbox() *MemoryOutbox { return &MemoryOutbox{store: s} }
+
+func (s *MemoryStore) History() *MemoryOrderHistory { return &MemoryOrderHistory{store: s} }
+
+func (s *MemoryStore) Lots() *MemoryPointLots { return &MemoryPointLots{store: s} }
+
+func (s *MemoryStore) Transfers() *MemoryTransferRepository {
+	return &MemoryTransferRepository{store: s}
+}
+
+func (s *MemoryStore) UnitOfWork() *MemoryUnitOfWork { return &MemoryUnitOfWork{store: s} }
+
+type MemoryUnitOfWork struct {
+	store *MemoryStore
+}
+
+// Do works on a copy of the state that replaces the store state only if fn
+// succeeds. The store is locked for the whole transaction, which is rolled
+// back if ctx is done by the time fn returns.
+func (u *MemoryUnitOfWork) Do(ctx context.Context, fn func(repos ports.Repositories) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	u.store.mu.Lock()
+	defer u.store.mu.Unlock()
+	tx := u.store.state.clone()
+	err := fn(ports.Repositories{
+		Users:       &MemoryUserStorage{store: u.store, tx: tx},
+		Orders:      &MemoryOrderRepository{store: u.store, tx: tx},
+		Withdrawals: &MemoryWithdrawalRepository{store: u.store, tx: tx},
+		Outbox:      &MemoryOutbox{store: u.store, tx: tx},
+		History:     &MemoryOrderHistory{store: u.store, tx: tx},
+		Lots:        &MemoryPointLots{store: u.store, tx: tx},
+		Transfers:   &MemoryTransferRepository{store: u.store, tx: tx},
+	})
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	u.store.state = tx
+	return u.store.persist()
+}
+
+type MemoryUserStorage struct {
+	store *MemoryStore
+	tx    *memoryState
+}
+
+func (m *MemoryUserStorage) GetByID(ctx context.Context, id uint) (*domain.User, error) {
+	var user domain.User
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		u, ok := st.Users[id]
+		if !ok {
+			return domain.ErrUserNotExist
+		}
+		user = u
+		user.Orders = nil
+		user.Withdraws = nil
+		for _, order := range st.Orders {
+			if order.UserID == id {
+				order := order
+				user.Orders = append(user.Orders, &order)
+			}
+		}
+		userID := strconv.FormatUint(uint64(id), 10)
+		for _, withdraw := range st.Withdraws {
+			if withdraw.UserID == userID {
+				withdraw := withdraw
+				user.Withdraws = append(user.Withdraws, &withdraw)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(user.Orders, func(i, j int) bool { return user.Orders[i].CreatedAt.Before(user.Orders[j].CreatedAt) })
+	sort.Slice(user.Withdraws, func(i, j int) bool {
+		return user.Withdraws[i].CreatedAt.Before(user.Withdraws[j].CreatedAt)
+	})
+	return &user, nil
+}
+
+func (m *MemoryUserStorage) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	var user *domain.User
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		for _, u := range st.Users {
+			if strings.EqualFold(u.Email, email) {
+				u := u
+				user = &u
+				return nil
+			}
+		}
+		return domain.ErrUserNotExist
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.Orders = nil
+	user.Withdraws = nil
+	return user, nil
+}
+
+func (m *MemoryUserStorage) AddAccural(ctx context.Context, id uint, accural int) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		user, ok := st.Users[id]
+		if !ok {
+			return domain.ErrUserNotExist
+		}
+		user.CurrentBalance += accural
+		if accural < 0 {
+			user.Withdrawn -= accural
+		}
+		user.UpdatedAt = time.Now()
+		st.Users[id] = user
+		return nil
+	})
+}
+
+func (m *MemoryUserStorage) UserBalance(ctx context.Context, id uint) (domain.Balance, error) {
+	var balance domain.Balance
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		user, ok := st.Users[id]
+		if !ok {
+			return domain.ErrUserNotExist
+		}
+		balance = user.Balance()
+		return nil
+	})
+	return balance, err
+}
+
+// LockBalance is UserBalance: a transaction holds the store lock anyway.
+func (m *MemoryUserStorage) LockBalance(ctx context.Context, id uint) (domain.Balance, error) {
+	return m.UserBalance(ctx, id)
+}
+
+func (m *MemoryUserStorage) AdjustBalance(ctx context.Context, id uint, delta domain.Balance) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		user, ok := st.Users[id]
+		if !ok {
+			return domain.ErrUserNotExist
+		}
+		if user.CurrentBalance+delta.Current < 0 || user.Held+delta.Held < 0 {
+			return domain.ErrNotEnoughPoints
+		}
+		user.CurrentBalance += delta.Current
+		user.Held += delta.Held
+		user.Withdrawn += delta.Withdrawn
+		user.UpdatedAt = time.Now()
+		st.Users[id] = user
+		return nil
+	})
+}
+
+func (m *MemoryUserStorage) SessionVersion(ctx context.Context, id uint) (int, error) {
+	var version int
+	err := m.store.view(ctx, m.tx, func(st *memoryState) error {
+		user, ok := st.Users[id]
+		if !ok {
+			return domain.ErrUserNotExist
+		}
+		version = user.SessionVersion
+		return nil
+	})
+	return version, err
+}
+
+func (m *MemoryUserStorage) UpdatePassword(ctx context.Context, user *domain.User) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		stored, ok := st.Users[user.ID]
+		if !ok {
+			return nil
+		}
+		stored.Password = user.Password
+		stored.SessionVersion = user.SessionVersion
+		st.Users[user.ID] = stored
+		return nil
+	})
+}
+
+// Save stores the user with its new orders and withdrawals. Like the
+// Postgres adapter it fails with domain.ErrDuplicateKey when the email or
+// a number is already taken.
+func (m *MemoryUserStorage) Save(ctx context.Context, user *domain.User) error {
+	return m.store.update(ctx, m.tx, func(st *memoryState) error {
+		now := time.Now().Truncate(time.Microsecond)
+		for id, other := range st.Users {
+			if id != user.ID && strings.EqualFold(other.Email, user.Email) {
+				return errors.Join(domain.ErrUserAlreadyExists, domain.ErrDuplicateKey)
+			}
+		}
+		if user.ID == 0 {
+			user.ID = st.nextID("users")
+		}
+		if user.CreatedAt.IsZero() {
+			user.CreatedAt = now
+		}
+		user.UpdatedAt = now
+		stored := *user
+		stored.Orders = nil
+		stored.Withdraws = nil
+		st.Users[user.ID] = stored
+		for _, order := range user.Orders {
+			order.UserID = user.ID
+			if err := saveOrder(st, order, now); err != nil {
+				return err
+			}
+		}
+		for _, withdraw := range user.Withdraws {
+			withdraw.UserID = strconv.FormatUint(uint64(user.ID), 10)
+			if err := saveWithdraw(st, withdraw, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func saveOrder(st *memoryState, order *domain.Order, now time.Time) error {
+	for id, other := range st.Orders {
+		if id != order.ID && other.Number == order.Number {
+			return errors.Join(domain.ErrOrderConflict, domain.ErrDuplicateKey)
+		}
+	}
+	if order.ID == 0 {
+		order.ID = st.nextID("orders")
+	}
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = now
+	}
+	st.Orders[order.ID] = *order
+	return nil
+}
+
+func saveWithdraw(st *memoryState, withdraw *domain.Withdraw, now time.Time) error {
+	for id, other := range st.Withdraws {
+		if id != withdraw.ID && other.Number == withdraw.Number {
+			return errors.Join(domain.ErrOrderConflict, domain.ErrDuplicateKey)
+		}
+	}
+	if withdraw.ID == 0 {
+		withdraw.ID = st.nextID("withdraws")
+	}
+	if withdraw.CreatedAt.IsZero() {
+		withdraw.CreatedAt = now
+	}
+	if withdraw.Status == "" {
+		withdraw.Status = domain.CONFIRMED
+	}
+	st.Withdraws[withdraw.ID] = *withdraw
+	return nil
+}
@@ -0,0 +1,19 @@
+package adapters_test
+
+import (
+	"testing"
+
+	"github.com/OrtemRepos/go_store/internal/adapters"
+	"github.com/OrtemRepos/go_store/internal/adapters/storagetest"
+	"go.uber.org/zap"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+		store, err := adapters.NewMemoryStore("", zap.NewNop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return storagetest.Memory(store)
+	})
+}
@@ -0,0 +1,109 @@
+package adapters
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+func (s *MemoryStore) Webhooks() *MemoryWebhookStorage { return &MemoryWebhookStorage{store: s} }
+
+type MemoryWebhookStorage struct {
+	store *MemoryStore
+}
+
+func (m *MemoryWebhookStorage) Save(ctx context.Context, webhook *domain.Webhook) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		webhook.ID = st.nextID("webhooks")
+		webhook.CreatedAt = time.Now()
+		st.Webhooks[webhook.ID] = *webhook
+		return nil
+	})
+}
+
+func (m *MemoryWebhookStorage) Get(ctx context.Context, userID, id uint) (*domain.Webhook, error) {
+	var found *domain.Webhook
+	err := m.store.view(ctx, nil, func(st *memoryState) error {
+		webhook, ok := st.Webhooks[id]
+		if !ok || webhook.UserID != userID {
+			return domain.ErrWebhookNotFound
+		}
+		found = &webhook
+		return nil
+	})
+	return found, err
+}
+
+func (m *MemoryWebhookStorage) ListByUser(ctx context.Context, userID uint) ([]*domain.Webhook, error) {
+	var webhooks []*domain.Webhook
+	err := m.store.view(ctx, nil, func(st *memoryState) error {
+		for _, webhook := range st.Webhooks {
+			if webhook.UserID == userID {
+				webhook := webhook
+				webhooks = append(webhooks, &webhook)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+func (m *MemoryWebhookStorage) Delete(ctx context.Context, userID, id uint) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		webhook, ok := st.Webhooks[id]
+		if !ok || webhook.UserID != userID {
+			return domain.ErrWebhookNotFound
+		}
+		delete(st.Webhooks, id)
+		return nil
+	})
+}
+
+func (m *MemoryWebhookStorage) SaveDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	return m.store.update(ctx, nil, func(st *memoryState) error {
+		delivery.ID = st.nextID("webhook_deliveries")
+		delivery.CreatedAt = time.Now()
+		st.Deliveries[delivery.ID] = *delivery
+		return nil
+	})
+}
+
+func (m *MemoryWebhookStorage) GetDelivery(ctx context.Context, userID, id uint) (*domain.WebhookDelivery, error) {
+	var found *domain.WebhookDelivery
+	err := m.store.view(ctx, nil, func(st *memoryState) error {
+		delivery, ok := st.Deliveries[id]
+		if !ok || delivery.UserID != userID {
+			return domain.ErrWebhookDeliveryNotFound
+		}
+		found = &delivery
+		return nil
+	})
+	return found, err
+}
+
+func (m *MemoryWebhookStorage) ListDeliveries(ctx context.Context, userID, webhookID uint, limit int) ([]*domain.WebhookDelivery, error) {
+	var deliveries []*domain.WebhookDelivery
+	err := m.store.view(ctx, nil, func(st *memoryState) error {
+		for _, delivery := range st.Deliveries {
+			if delivery.UserID == userID && delivery.WebhookID == webhookID {
+				delivery := delivery
+				deliveries = append(deliveries, &delivery)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
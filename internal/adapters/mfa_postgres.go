@@ -0,0 +1,67 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type MFAStorageImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewMFAStorage(db *gorm.DB, logger *zap.Logger) *MFAStorageImpl {
+	err := db.AutoMigrate(domain.RecoveryCode{})
+	if err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
+	return &MFAStorageImpl{db: db, logger: logger}
+}
+
+func (s *MFAStorageImpl) UpdateTOTP(ctx context.Context, user *domain.User) error {
+	err := s.db.WithContext(ctx).Model(&domain.User{ID: user.ID}).Updates(map[string]interface{}{
+		"totp_secret":    user.TOTPSecret,
+		"totp_enabled":   user.TOTPEnabled,
+		"totp_last_step": user.TOTPLastStep,
+	}).Error
+	if err != nil {
+		s.logger.Error("failed to update TOTP settings", zap.Uint("id", user.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *MFAStorageImpl) ReplaceRecoveryCodes(ctx context.Context, userID uint, codes []*domain.RecoveryCode) error {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&domain.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(codes).Error
+	})
+	if err != nil {
+		s.logger.Error("failed to replace recovery codes", zap.Uint("user_id", userID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *MFAStorageImpl) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) error {
+	result := s.db.WithContext(ctx).Model(&domain.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		s.logger.Error("failed to use a recovery code", zap.Uint("user_id", userID), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrInvalidMFACode
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+)
+
+// LogNotifier writes notifications to the application log. It is meant
+// for local runs where no mail delivery is configured. Only the recipient
+// and the subject are logged: the body carries secrets such as password
+// reset tokens, which the file notifier can be used to read locally.
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger.Named("notifier")}
+}
+
+func (n *LogNotifier) Notify(_ context.Context, notification domain.Notification) error {
+	n.logger.Info("notification",
+		zap.String("to", notification.To),
+		zap.String("subject", notification.Subject),
+	)
+	return nil
+}
+
+// FileNotifier appends notifications to a file as JSON lines.
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) *FileNotifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Notify(_ context.Context, notification domain.Notification) error {
+	line, err := json.Marshal(struct {
+		domain.Notification
+		SentAt time.Time `json:"sent_at"`
+	}{notification, time.Now()})
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	file, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("can't open notification file: %w", err)
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,36 @@
+package adapters_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/OrtemRepos/go_store/internal/adapters"
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogNotifierLeavesOutTheBody(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	notifier := adapters.NewLogNotifier(zap.New(core))
+	err := notifier.Notify(context.Background(), domain.Notification{
+		To:      "a@example.com",
+		Subject: "Password reset",
+		Body:    "Use this token to reset your password: s3cr3t",
+	})
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	for _, entry := range logs.All() {
+		for key, value := range entry.ContextMap() {
+			if strings.Contains(key, "body") || strings.Contains(value.(string), "s3cr3t") {
+				t.Errorf("the body was logged: %s=%v", key, value)
+			}
+		}
+	}
+	if logs.FilterField(zap.String("to", "a@example.com")).Len() != 1 {
+		t.Errorf("the recipient was not logged: %v", logs.All())
+	}
+}
@@ -0,0 +1,39 @@
+package adapters
+
+import (
+	"context"
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type OrderHistoryImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewOrderHistory(db *gorm.DB, logger *zap.Logger) *OrderHistoryImpl {
+	err := db.AutoMigrate(domain.OrderStatusChange{})
+	if err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
+	return &OrderHistoryImpl{db: db, logger: logger}
+}
+
+func (h *OrderHistoryImpl) Add(ctx context.Context, change *domain.OrderStatusChange) error {
+	if err := h.db.WithContext(ctx).Create(change).Error; err != nil {
+		h.logger.Error("failed to add an order status change", zap.String("number", change.Number), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (h *OrderHistoryImpl) List(ctx context.Context, number string) ([]*domain.OrderStatusChange, error) {
+	var changes []*domain.OrderStatusChange
+	err := h.db.WithContext(ctx).Where("number = ?", number).Order("id ASC").Find(&changes).Error
+	if err != nil {
+		h.logger.Error("failed to list order status changes", zap.String("number", number), zap.Error(err))
+		return nil, err
+	}
+	return changes, nil
+}
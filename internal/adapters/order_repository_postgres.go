@@ -0,0 +1,184 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type OrderRepositoryImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewOrderRepository(db *gorm.DB, logger *zap.Logger) *OrderRepositoryImpl {
+	err := db.AutoMigrate(domain.Order{})
+	if err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
+	return &OrderRepositoryImpl{db: db, logger: logger}
+}
+
+func (r *OrderRepositoryImpl) Create(ctx context.Context, order *domain.Order) error {
+	err := r.db.WithContext(ctx).Create(order).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errors.Join(domain.ErrOrderConflict, domain.ErrDuplicateKey, err)
+	} else if err != nil {
+		r.logger.Error("failed to create order", zap.String("number", order.Number), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *OrderRepositoryImpl) GetByNumber(ctx context.Context, number string) (*domain.Order, error) {
+	var order domain.Order
+	err := r.db.WithContext(ctx).Where("number = ?", number).First(&order).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.Join(domain.ErrOrderNotFound, err)
+	} else if err != nil {
+		r.logger.Error("failed to get order", zap.String("number", number), zap.Error(err))
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *OrderRepositoryImpl) List(ctx context.Context, userID uint, query domain.ListQuery) (*domain.Page[*domain.Order], error) {
+	var orders []*domain.Order
+	stmt := r.db.WithContext(ctx).Model(&domain.Order{}).Where("user_id = ?", userID)
+	if len(query.Statuses) > 0 {
+		stmt = stmt.Where("status IN ?", query.Statuses)
+	}
+	err := keysetPage(stmt, "orders", query).Find(&orders).Error
+	if err != nil {
+		r.logger.Error("failed to list orders", zap.Uint("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	return newPage(orders, query.Limit, func(o *domain.Order) domain.Cursor {
+		return domain.Cursor{CreatedAt: o.CreatedAt, ID: o.ID}
+	}), nil
+}
+
+func (r *OrderRepositoryImpl) Complete(ctx context.Context, order *domain.Order) error {
+	result := r.db.WithContext(ctx).Model(&domain.Order{}).
+		Where("number = ? AND completed = ?", order.Number, false).
+		Updates(map[string]interface{}{
+			"status":    order.Status,
+			"accural":   order.Accural,
+			"completed": true,
+			"failure":   "",
+		})
+	if result.Error != nil {
+		r.logger.Error("failed to complete order", zap.String("number", order.Number), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrOrderAlreadyCompleted
+	}
+	order.Completed = true
+	return nil
+}
+
+func (r *OrderRepositoryImpl) MarkNeedsAttention(ctx context.Context, order *domain.Order) error {
+	result := r.db.WithContext(ctx).Model(&domain.Order{}).
+		Where("number = ? AND completed = ?", order.Number, false).
+		Updates(map[string]interface{}{
+			"status":  domain.NEEDS_ATTENTION,
+			"failure": order.Failure,
+		})
+	if result.Error != nil {
+		r.logger.Error("failed to mark order", zap.String("number", order.Number), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrOrderAlreadyCompleted
+	}
+	order.Status = domain.NEEDS_ATTENTION
+	return nil
+}
+
+func (r *OrderRepositoryImpl) Correct(ctx context.Context, previous, order *domain.Order) error {
+	stmt := r.db.WithContext(ctx).Model(&domain.Order{}).
+		Where("number = ? AND completed = ? AND status = ?", order.Number, true, previous.Status)
+	if previous.Accural == nil {
+		stmt = stmt.Where("accural IS NULL")
+	} else {
+		stmt = stmt.Where("accural = ?", *previous.Accural)
+	}
+	result := stmt.Updates(map[string]interface{}{
+		"status":  order.Status,
+		"accural": order.Accural,
+	})
+	if result.Error != nil {
+		r.logger.Error("failed to correct order", zap.String("number", order.Number), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrOrderChanged
+	}
+	order.Completed = true
+	return nil
+}
+
+func (r *OrderRepositoryImpl) ListAll(ctx context.Context, query domain.ListQuery) (*domain.Page[*domain.Order], error) {
+	var orders []*domain.Order
+	err := keysetPage(r.db.WithContext(ctx).Model(&domain.Order{}), "orders", query).Find(&orders).Error
+	if err != nil {
+		r.logger.Error("failed to list all orders", zap.Error(err))
+		return nil, err
+	}
+	return newPage(orders, query.Limit, func(o *domain.Order) domain.Cursor {
+		return domain.Cursor{CreatedAt: o.CreatedAt, ID: o.ID}
+	}), nil
+}
+
+func (r *OrderRepositoryImpl) Accrued(ctx context.Context, userID uint) (int, error) {
+	var accrued int
+	err := r.db.WithContext(ctx).Model(&domain.Order{}).
+		Where("user_id = ? AND status = ?", userID, domain.PROCESSED).
+		Select("COALESCE(SUM(accural), 0)").
+		Scan(&accrued).Error
+	if err != nil {
+		r.logger.Error("failed to sum accruals", zap.Uint("user_id", userID), zap.Error(err))
+		return 0, err
+	}
+	return accrued, nil
+}
+
+// keysetPage applies the date range, the cursor and the ordering by
+// (created_at, id). One extra row is fetched to know if there is a next page.
+// Times are passed in UTC, as the SQLite backend compares them as text.
+func keysetPage(stmt *gorm.DB, table string, query domain.ListQuery) *gorm.DB {
+	if query.From != nil {
+		stmt = stmt.Where(table+".created_at >= ?", query.From.UTC())
+	}
+	if query.To != nil {
+		stmt = stmt.Where(table+".created_at < ?", query.To.UTC())
+	}
+	op, direction := ">", "ASC"
+	if query.Sort == domain.SortDesc {
+		op, direction = "<", "DESC"
+	}
+	if query.Cursor != nil {
+		stmt = stmt.Where(
+			fmt.Sprintf("(%[1]s.created_at, %[1]s.id) %[2]s (?, ?)", table, op),
+			query.Cursor.CreatedAt.UTC(), query.Cursor.ID,
+		)
+	}
+	return stmt.
+		Order(fmt.Sprintf("%s.created_at %s", table, direction)).
+		Order(fmt.Sprintf("%s.id %s", table, direction)).
+		Limit(query.Limit + 1)
+}
+
+func newPage[T any](items []T, limit int, cursor func(T) domain.Cursor) *domain.Page[T] {
+	page := &domain.Page[T]{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.NextCursor = cursor(items[limit-1]).Encode()
+	}
+	return page
+}
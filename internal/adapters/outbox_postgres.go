@@ -0,0 +1,75 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type OutboxImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewOutbox(db *gorm.DB, logger *zap.Logger) *OutboxImpl {
+	err := db.AutoMigrate(domain.Event{})
+	if err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
+	return &OutboxImpl{db: db, logger: logger}
+}
+
+func (o *OutboxImpl) Add(ctx context.Context, events ...*domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	err := o.db.WithContext(ctx).Create(events).Error
+	if err != nil {
+		o.logger.Error("failed to add events to the outbox", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (o *OutboxImpl) Pending(ctx context.Context, afterID uint, limit int) ([]*domain.Event, error) {
+	var events []*domain.Event
+	err := o.db.WithContext(ctx).Where("published_at IS NULL AND dead_at IS NULL AND id > ?", afterID).Order("id ASC").Limit(limit).Find(&events).Error
+	if err != nil {
+		o.logger.Error("failed to get pending events", zap.Error(err))
+		return nil, err
+	}
+	return events, nil
+}
+
+func (o *OutboxImpl) Committed(ctx context.Context, afterID uint, limit int) ([]*domain.Event, error) {
+	var events []*domain.Event
+	err := o.db.WithContext(ctx).Select("id", "created_at").Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&events).Error
+	if err != nil {
+		o.logger.Error("failed to get committed events", zap.Error(err))
+		return nil, err
+	}
+	return events, nil
+}
+
+func (o *OutboxImpl) MarkPublished(ctx context.Context, id uint, at time.Time) error {
+	return o.db.WithContext(ctx).Model(&domain.Event{}).Where("id = ?", id).Update("published_at", at.UTC()).Error
+}
+
+func (o *OutboxImpl) MarkFailed(ctx context.Context, id uint, reason string, retryAt time.Time) error {
+	return o.db.WithContext(ctx).Model(&domain.Event{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": reason,
+		"retry_at":   retryAt.UTC(),
+	}).Error
+}
+
+func (o *OutboxImpl) MarkDead(ctx context.Context, id uint, reason string, at time.Time) error {
+	return o.db.WithContext(ctx).Model(&domain.Event{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": reason,
+		"dead_at":    at.UTC(),
+	}).Error
+}
@@ -0,0 +1,233 @@
+package adapters
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/OrtemRepos/go_store/configs"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// pepperPrefix marks hashes computed over the HMAC of the password with the
+// pepper, so that hashes created before the pepper was configured can still
+// be verified and then upgraded.
+const pepperPrefix = "$hmac-sha256"
+
+var (
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+	ErrPepperRequired    = errors.New("password hash requires a pepper")
+)
+
+type algorithmHasher interface {
+	name() string
+	matches(encoded string) bool
+	hash(password []byte) (string, error)
+	verify(encoded string, password []byte) (bool, error)
+	outdated(encoded string) bool
+}
+
+type PasswordHasherImpl struct {
+	current    algorithmHasher
+	algorithms []algorithmHasher
+	pepper     []byte
+}
+
+func NewPasswordHasher(cfg *configs.Config) (*PasswordHasherImpl, error) {
+	bcryptHasher := &bcryptHasher{cost: cfg.Auth.BcryptCost}
+	if bcryptHasher.cost < bcrypt.MinCost || bcryptHasher.cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcryptCost[int] must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	// The parameters are checked before they are narrowed, so an out of
+	// range value is reported instead of wrapping around.
+	if cfg.Auth.Argon2Time < 1 || int64(cfg.Auth.Argon2Time) > math.MaxUint32 {
+		return nil, fmt.Errorf("argon2Time[int] must be between 1 and %d", uint32(math.MaxUint32))
+	}
+	if cfg.Auth.Argon2Memory < 1 || int64(cfg.Auth.Argon2Memory) > math.MaxUint32 {
+		return nil, fmt.Errorf("argon2Memory[int] must be between 1 and %d", uint32(math.MaxUint32))
+	}
+	if cfg.Auth.Argon2Threads < 1 || cfg.Auth.Argon2Threads > math.MaxUint8 {
+		return nil, fmt.Errorf("argon2Threads[int] must be between 1 and %d", math.MaxUint8)
+	}
+	argonHasher := &argon2idHasher{
+		time:    uint32(cfg.Auth.Argon2Time),
+		memory:  uint32(cfg.Auth.Argon2Memory),
+		threads: uint8(cfg.Auth.Argon2Threads),
+		keyLen:  32,
+		saltLen: 16,
+	}
+	h := &PasswordHasherImpl{
+		algorithms: []algorithmHasher{bcryptHasher, argonHasher},
+		pepper:     []byte(cfg.Auth.PasswordSecretKey),
+	}
+	for _, algorithm := range h.algorithms {
+		if algorithm.name() == cfg.Auth.PasswordHashAlgorithm {
+			h.current = algorithm
+		}
+	}
+	if h.current == nil {
+		return nil, fmt.Errorf("unsupported password hash algorithm: %q", cfg.Auth.PasswordHashAlgorithm)
+	}
+	return h, nil
+}
+
+func (h *PasswordHasherImpl) Hash(password string) (string, error) {
+	encoded, err := h.current.hash(h.prepare(password, len(h.pepper) > 0))
+	if err != nil {
+		return "", err
+	}
+	if len(h.pepper) > 0 {
+		return pepperPrefix + encoded, nil
+	}
+	return encoded, nil
+}
+
+func (h *PasswordHasherImpl) Verify(hash, password string) (bool, error) {
+	encoded, peppered := strings.CutPrefix(hash, pepperPrefix)
+	if peppered && len(h.pepper) == 0 {
+		return false, ErrPepperRequired
+	}
+	algorithm := h.algorithm(encoded)
+	if algorithm == nil {
+		return false, ErrUnknownHashFormat
+	}
+	return algorithm.verify(encoded, h.prepare(password, peppered))
+}
+
+func (h *PasswordHasherImpl) NeedsRehash(hash string) bool {
+	encoded, peppered := strings.CutPrefix(hash, pepperPrefix)
+	if peppered != (len(h.pepper) > 0) {
+		return true
+	}
+	return h.algorithm(encoded) != h.current || h.current.outdated(encoded)
+}
+
+func (h *PasswordHasherImpl) algorithm(encoded string) algorithmHasher {
+	for _, algorithm := range h.algorithms {
+		if algorithm.matches(encoded) {
+			return algorithm
+		}
+	}
+	return nil
+}
+
+// prepare applies the pepper. The MAC is base64-encoded so it fits into
+// the 72 bytes bcrypt looks at.
+func (h *PasswordHasherImpl) prepare(password string, peppered bool) []byte {
+	if !peppered {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write([]byte(password))
+	return []byte(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func (b *bcryptHasher) name() string { return "bcrypt" }
+
+func (b *bcryptHasher) matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2")
+}
+
+func (b *bcryptHasher) hash(password []byte) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword(password, b.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b *bcryptHasher) verify(encoded string, password []byte) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), password)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *bcryptHasher) outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != b.cost
+}
+
+// argon2idHasher stores hashes in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+type argon2idHasher struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	keyLen  uint32
+	saltLen uint32
+}
+
+func (a *argon2idHasher) name() string { return "argon2id" }
+
+func (a *argon2idHasher) matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (a *argon2idHasher) hash(password []byte) (string, error) {
+	salt := make([]byte, a.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey(password, salt, a.time, a.memory, a.threads, a.keyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.memory, a.time, a.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *argon2idHasher) verify(encoded string, password []byte) (bool, error) {
+	params, salt, key, err := a.decode(encoded)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey(password, salt, params.time, params.memory, params.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (a *argon2idHasher) outdated(encoded string) bool {
+	params, _, key, err := a.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return params.time != a.time || params.memory != a.memory ||
+		params.threads != a.threads || uint32(len(key)) != a.keyLen
+}
+
+func (a *argon2idHasher) decode(encoded string) (*argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, ErrUnknownHashFormat
+	}
+	params := &argon2idHasher{}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads)
+	if err != nil {
+		return nil, nil, nil, ErrUnknownHashFormat
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrUnknownHashFormat
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,65 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type PasswordResetStorageImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewPasswordResetStorage(db *gorm.DB, logger *zap.Logger) *PasswordResetStorageImpl {
+	err := db.AutoMigrate(domain.PasswordResetToken{})
+	if err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
+	return &PasswordResetStorageImpl{db: db, logger: logger}
+}
+
+func (s *PasswordResetStorageImpl) Save(ctx context.Context, token *domain.PasswordResetToken) error {
+	if err := s.db.WithContext(ctx).Create(token).Error; err != nil {
+		s.logger.Error("failed to save password reset token", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *PasswordResetStorageImpl) Consume(ctx context.Context, tokenHash string) (*domain.PasswordResetToken, error) {
+	var token domain.PasswordResetToken
+	now := time.Now().UTC()
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&domain.PasswordResetToken{}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return domain.ErrResetTokenInvalid
+		}
+		return tx.Where("token_hash = ?", tokenHash).First(&token).Error
+	})
+	if errors.Is(err, domain.ErrResetTokenInvalid) {
+		return nil, err
+	} else if err != nil {
+		s.logger.Error("failed to consume password reset token", zap.Error(err))
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *PasswordResetStorageImpl) DeleteForUser(ctx context.Context, userID uint) error {
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&domain.PasswordResetToken{}).Error
+	if err != nil {
+		s.logger.Error("failed to delete password reset tokens", zap.Uint("user_id", userID), zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type PointLotsImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewPointLots(db *gorm.DB, logger *zap.Logger) *PointLotsImpl {
+	err := db.AutoMigrate(domain.PointLot{}, domain.PointLotUsage{}, domain.PointExpiry{})
+	if err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
+	// The lot of an expiry used to be unique, which failed every run of
+	// the expiry job once a lot expired twice.
+	if m := db.Migrator(); m.HasIndex(&domain.PointExpiry{}, "idx_point_expiries_lot_id") {
+		if err := m.DropIndex(&domain.PointExpiry{}, "idx_point_expiries_lot_id"); err != nil {
+			logger.Fatal("migration error", zap.Error(err))
+		}
+	}
+	return &PointLotsImpl{db: db, logger: logger}
+}
+
+func (p *PointLotsImpl) Add(ctx context.Context, lot *domain.PointLot) error {
+	if err := p.db.WithContext(ctx).Create(lot).Error; err != nil {
+		p.logger.Error("failed to add a point lot", zap.Uint("user_id", lot.UserID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (p *PointLotsImpl) Available(ctx context.Context, userID uint) ([]*domain.PointLot, error) {
+	var lots []*domain.PointLot
+	err := p.db.WithContext(ctx).Where("user_id = ? AND remaining > 0", userID).
+		Order("expires_at ASC, id ASC").
+		Find(&lots).Error
+	if err != nil {
+		p.logger.Error("failed to list point lots", zap.Uint("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	return lots, nil
+}
+
+func (p *PointLotsImpl) Take(ctx context.Context, usages []*domain.PointLotUsage) error {
+	for _, usage := range usages {
+		result := p.db.WithContext(ctx).Model(&domain.PointLot{}).
+			Where("id = ? AND remaining >= ?", usage.LotID, usage.Amount).
+			Update("remaining", gorm.Expr("remaining - ?", usage.Amount))
+		if result.Error != nil {
+			p.logger.Error("failed to take points from a lot", zap.Uint("lot_id", usage.LotID), zap.Error(result.Error))
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return domain.ErrPointLotChanged
+		}
+		if err := p.db.WithContext(ctx).Create(usage).Error; err != nil {
+			p.logger.Error("failed to add a point lot usage", zap.Uint("lot_id", usage.LotID), zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PointLotsImpl) Release(ctx context.Context, number string) error {
+	var usages []*domain.PointLotUsage
+	if err := p.db.WithContext(ctx).Where("number = ?", number).Find(&usages).Error; err != nil {
+		p.logger.Error("failed to list point lot usages", zap.String("number", number), zap.Error(err))
+		return err
+	}
+	for _, usage := range usages {
+		err := p.db.WithContext(ctx).Model(&domain.PointLot{}).
+			Where("id = ?", usage.LotID).
+			Update("remaining", gorm.Expr("remaining + ?", usage.Amount)).Error
+		if err != nil {
+			p.logger.Error("failed to put points back into a lot", zap.Uint("lot_id", usage.LotID), zap.Error(err))
+			return err
+		}
+		if err := p.db.WithContext(ctx).Delete(usage).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListExpired returns the lots with points left that expired by now, the
+// oldest first.
+func (p *PointLotsImpl) ListExpired(ctx context.Context, now time.Time, after *domain.PointLot, limit int) ([]*domain.PointLot, error) {
+	var lots []*domain.PointLot
+	query := p.db.WithContext(ctx).Where("remaining > 0 AND expires_at <= ?", now.UTC())
+	if after != nil {
+		query = query.Where("(expires_at > ? OR (expires_at = ? AND id > ?))", after.ExpiresAt, after.ExpiresAt, after.ID)
+	}
+	err := query.Order("expires_at ASC, id ASC").
+		Limit(limit).
+		Find(&lots).Error
+	if err != nil {
+		p.logger.Error("failed to list expired point lots", zap.Error(err))
+		return nil, err
+	}
+	return lots, nil
+}
+
+func (p *PointLotsImpl) Expire(ctx context.Context, expiry *domain.PointExpiry, remaining int) error {
+	result := p.db.WithContext(ctx).Model(&domain.PointLot{}).
+		Where("id = ? AND remaining = ?", expiry.LotID, remaining).
+		Update("remaining", 0)
+	if result.Error != nil {
+		p.logger.Error("failed to expire a point lot", zap.Uint("lot_id", expiry.LotID), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrPointLotChanged
+	}
+	if err := p.db.WithContext(ctx).Create(expiry).Error; err != nil {
+		p.logger.Error("failed to add a point expiry", zap.Uint("lot_id", expiry.LotID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (p *PointLotsImpl) Upcoming(ctx context.Context, userID uint, until time.Time) ([]*domain.PointLot, error) {
+	var lots []*domain.PointLot
+	err := p.db.WithContext(ctx).Where("user_id = ? AND remaining > 0 AND expires_at < ?", userID, until.UTC()).
+		Order("expires_at ASC, id ASC").
+		Find(&lots).Error
+	if err != nil {
+		p.logger.Error("failed to list upcoming point expirations", zap.Uint("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	return lots, nil
+}
+
+func (p *PointLotsImpl) Expired(ctx context.Context, userID uint) (int, error) {
+	var expired int
+	err := p.db.WithContext(ctx).Model(&domain.PointExpiry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("user_id = ?", userID).
+		Scan(&expired).Error
+	if err != nil {
+		p.logger.Error("failed to sum expired points", zap.Uint("user_id", userID), zap.Error(err))
+		return 0, err
+	}
+	return expired, nil
+}
@@ -0,0 +1,88 @@
+package adapters_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/adapters/storagetest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// postgresDSNEnv names the database the Postgres suite runs against. The
+// suite is skipped if it is not set. Every check gets a schema of its own,
+// dropped when the check ends.
+const postgresDSNEnv = "STORE_TEST_POSTGRES_DSN"
+
+func TestPostgresStorage(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+	newDB := newPostgresSchemas(t, dsn)
+	storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+		return storagetest.Gorm(newDB(t))
+	})
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+	storagetest.RunMigrations(t, newPostgresSchemas(t, dsn))
+}
+
+// newPostgresSchemas returns a function that opens a new schema of the
+// database, dropped when the check that opened it ends.
+func newPostgresSchemas(t *testing.T, dsn string) func(t *testing.T) *gorm.DB {
+	admin := openPostgres(t, dsn)
+	var schemas atomic.Int64
+	return func(t *testing.T) *gorm.DB {
+		schema := fmt.Sprintf("storagetest_%d_%d", time.Now().UnixNano(), schemas.Add(1))
+		if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+			t.Fatalf("can't create the schema: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := admin.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+				t.Errorf("can't drop the schema: %v", err)
+			}
+		})
+		return openPostgres(t, withSearchPath(dsn, schema))
+	}
+}
+
+func openPostgres(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		TranslateError: true,
+		Logger:         logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("can't open the database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return db
+}
+
+// withSearchPath adds the search_path runtime parameter to a URL or a
+// key=value DSN.
+func withSearchPath(dsn, schema string) string {
+	switch {
+	case !strings.Contains(dsn, "://"):
+		return dsn + " search_path=" + schema
+	case strings.Contains(dsn, "?"):
+		return dsn + "&search_path=" + schema
+	default:
+		return dsn + "?search_path=" + schema
+	}
+}
@@ -6,23 +6,47 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/OrtemRepos/go_store/configs"
 	"github.com/OrtemRepos/go_store/internal/auth"
 	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/logging"
 	"github.com/OrtemRepos/go_store/internal/ports"
 	"github.com/OrtemRepos/go_store/internal/service/order-service"
+	"github.com/OrtemRepos/go_store/internal/service/order-stream"
+	"github.com/OrtemRepos/go_store/internal/service/transfer-service"
+	"github.com/OrtemRepos/go_store/internal/service/webhook-service"
+	"github.com/OrtemRepos/go_store/internal/service/withdrawal-service"
+	"github.com/OrtemRepos/go_store/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
 type RestAPI struct {
-	logger       *zap.Logger
-	jwt          ports.JWT
-	userStorage  ports.UserStorage
-	cfg          *configs.Config
-	orderService *orderservice.OrderService
+	logger            *zap.Logger
+	jwt               ports.JWT
+	userStorage       ports.UserStorage
+	orders            ports.OrderRepository
+	withdrawals       ports.WithdrawalRepository
+	uow               ports.UnitOfWork
+	cfg               *configs.Config
+	orderService      *orderservice.OrderService
+	loginLimiter      *auth.LoginLimiter
+	loginAudit        ports.LoginAudit
+	pwdPolicy         *auth.PasswordPolicy
+	resetStorage      ports.PasswordResetStorage
+	notifier          ports.Notifier
+	hasher            ports.PasswordHasher
+	apiKeys           ports.APIKeyStorage
+	mfaStorage        ports.MFAStorage
+	webhooks          ports.WebhookStorage
+	webhookService    *webhookservice.WebhookService
+	orderStream       *orderstream.Broker
+	withdrawalService *withdrawalservice.WithdrawalService
+	transferService   *transferservice.TransferService
+	dummyHash         string
 	*gin.Engine
 }
 
@@ -31,38 +55,138 @@ func NewRestAPI(
 	logger *zap.Logger,
 	jwt ports.JWT,
 	userStorage ports.UserStorage,
+	orders ports.OrderRepository,
+	withdrawals ports.WithdrawalRepository,
+	uow ports.UnitOfWork,
 	enginge *gin.Engine,
 	orderService *orderservice.OrderService,
+	loginLimiter *auth.LoginLimiter,
+	loginAudit ports.LoginAudit,
+	pwdPolicy *auth.PasswordPolicy,
+	resetStorage ports.PasswordResetStorage,
+	notifier ports.Notifier,
+	hasher ports.PasswordHasher,
+	apiKeys ports.APIKeyStorage,
+	mfaStorage ports.MFAStorage,
+	webhooks ports.WebhookStorage,
+	webhookService *webhookservice.WebhookService,
+	orderStream *orderstream.Broker,
+	withdrawalService *withdrawalservice.WithdrawalService,
+	transferService *transferservice.TransferService,
 ) *RestAPI {
+	// dummyHash is verified against when the user does not exist, so that
+	// a login for an unknown email takes as long as one with a wrong password.
+	dummyHash, err := hasher.Hash("dummy password")
+	if err != nil {
+		logger.Warn("can't create the dummy password hash", zap.Error(err))
+	}
 	return &RestAPI{
-		logger:      logger,
-		jwt:         jwt,
-		userStorage: userStorage,
-		cfg:         cfg,
-		Engine:      enginge,
-		orderService: orderService,
+		logger:            logger,
+		jwt:               jwt,
+		userStorage:       userStorage,
+		orders:            orders,
+		withdrawals:       withdrawals,
+		uow:               uow,
+		cfg:               cfg,
+		Engine:            enginge,
+		orderService:      orderService,
+		loginLimiter:      loginLimiter,
+		loginAudit:        loginAudit,
+		pwdPolicy:         pwdPolicy,
+		resetStorage:      resetStorage,
+		notifier:          notifier,
+		hasher:            hasher,
+		apiKeys:           apiKeys,
+		mfaStorage:        mfaStorage,
+		webhooks:          webhooks,
+		webhookService:    webhookService,
+		orderStream:       orderStream,
+		withdrawalService: withdrawalService,
+		transferService:   transferService,
+		dummyHash:         dummyHash,
 	}
 }
 
 func (r *RestAPI) Serve() {
+	r.Use(tracing.Middleware(), logging.AccessLog(r.logger))
 	r.NoRoute(r.noPage)
-	r.POST("/api/auth", r.authUser)
-	r.POST("/api/register", r.registerUser)
-	protectedRouter := r.Group("/api", auth.AuthMiddleware(r.jwt, r.logger))
-	protectedRouter.POST("/user/orders", r.addOrder)
-	protectedRouter.GET("/user/orders", r.getOrders)
-	protectedRouter.GET("/user/balance", r.getBalance)
-	protectedRouter.POST("/user/withdraw", r.newOrderWithdrawn)
-	protectedRouter.GET("/user/withdraw", r.getWithdraws)
+	router := r.Group("/api", requestTimeout(time.Duration(r.cfg.Timeouts.Request)*time.Second))
+	router.POST("/auth", r.authUser)
+	router.POST("/auth/mfa", r.verifyMFALogin)
+	router.POST("/register", r.registerUser)
+	router.POST("/password/reset", r.requestPasswordReset)
+	router.POST("/password/reset/confirm", r.confirmPasswordReset)
+	authMiddleware := auth.AuthMiddleware(r.jwt, r.userStorage, r.apiKeys, r.logger)
+	// The order stream stays open as long as the client listens, so it is
+	// the only route without a request timeout.
+	r.GET("/api/user/orders/stream", authMiddleware, auth.RequireScope(domain.ScopeOrdersRead), r.streamOrders)
+	protectedRouter := router.Group("", authMiddleware)
+	protectedRouter.POST("/user/password", auth.RequireSession(), r.changePassword)
+	protectedRouter.POST("/user/mfa/totp", auth.RequireSession(), r.enrollTOTP)
+	protectedRouter.POST("/user/mfa/totp/verify", auth.RequireSession(), r.enableTOTP)
+	protectedRouter.DELETE("/user/mfa/totp", auth.RequireSession(), r.disableTOTP)
+	protectedRouter.POST("/user/mfa/recovery-codes", auth.RequireSession(), r.regenerateRecoveryCodes)
+	protectedRouter.POST("/user/mfa/step-up", auth.RequireSession(), r.stepUpMFA)
+	protectedRouter.POST("/user/api-keys", auth.RequireSession(), r.createAPIKey)
+	protectedRouter.GET("/user/api-keys", auth.RequireSession(), r.listAPIKeys)
+	protectedRouter.DELETE("/user/api-keys/:id", auth.RequireSession(), r.revokeAPIKey)
+	protectedRouter.POST("/user/webhooks", auth.RequireSession(), r.createWebhook)
+	protectedRouter.GET("/user/webhooks", auth.RequireSession(), r.listWebhooks)
+	protectedRouter.DELETE("/user/webhooks/:id", auth.RequireSession(), r.deleteWebhook)
+	protectedRouter.GET("/user/webhooks/:id/deliveries", auth.RequireSession(), r.listWebhookDeliveries)
+	protectedRouter.POST("/user/webhooks/deliveries/:id/replay", auth.RequireSession(), r.replayWebhookDelivery)
+	protectedRouter.POST("/user/orders", auth.RequireScope(domain.ScopeOrdersWrite), r.addOrder)
+	protectedRouter.POST("/user/orders/batch", auth.RequireScope(domain.ScopeOrdersWrite), r.addOrdersBatch)
+	protectedRouter.GET("/user/orders", auth.RequireScope(domain.ScopeOrdersRead), r.getOrders)
+	protectedRouter.GET("/user/orders/:number", auth.RequireScope(domain.ScopeOrdersRead), r.getOrder)
+	protectedRouter.GET("/user/balance", auth.RequireScope(domain.ScopeBalanceRead), r.getBalance)
+	protectedRouter.POST("/user/withdraw", auth.RequireScope(domain.ScopeWithdrawalsWrite), r.newOrderWithdrawn)
+	protectedRouter.GET("/user/withdraw", auth.RequireScope(domain.ScopeWithdrawalsRead), r.getWithdraws)
+	protectedRouter.POST("/user/withdraw/hold", auth.RequireScope(domain.ScopeWithdrawalsWrite), r.holdWithdrawn)
+	protectedRouter.POST("/user/withdraw/:number/confirm", auth.RequireScope(domain.ScopeWithdrawalsWrite), r.confirmWithdrawn)
+	protectedRouter.POST("/user/withdraw/:number/cancel", auth.RequireScope(domain.ScopeWithdrawalsWrite), r.cancelWithdrawn)
+	protectedRouter.POST("/user/transfer", auth.RequireScope(domain.ScopeTransfersWrite), r.transferPoints)
+	protectedRouter.GET("/user/transfers", auth.RequireScope(domain.ScopeTransfersRead), r.getTransfers)
 
 	r.orderService.Start(context.Background())
 
-	err := r.Run("localhost:8080")
+	server := &http.Server{
+		Addr:              r.cfg.Server.HostAddress,
+		Handler:           r.Engine,
+		ReadHeaderTimeout: time.Duration(r.cfg.Server.ReadHeaderTimeout) * time.Second,
+		ReadTimeout:       time.Duration(r.cfg.Server.ReadTimeout) * time.Second,
+		WriteTimeout:      time.Duration(r.cfg.Server.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(r.cfg.Server.IdleTimeout) * time.Second,
+		MaxHeaderBytes:    r.cfg.Server.MaxHeaderBytes,
+	}
+	r.logger.Info("listening", zap.String("address", server.Addr))
+	err := server.ListenAndServe()
 	if err != nil {
 		r.logger.Error("error when starting the gin server", zap.Error(err))
 	}
 }
 
+// requestTimeout makes the context of the request done after timeout, so
+// the storage and accrual system calls of a slow request are abandoned.
+// Zero leaves the request without a deadline.
+func requestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// log returns the logger with the request ID and the trace ID of ctx.
+func (r *RestAPI) log(ctx context.Context) *zap.Logger {
+	return tracing.Logger(ctx, r.logger)
+}
+
 func (r *RestAPI) authUser(c *gin.Context) {
 	email := c.PostForm("email")
 	password := c.PostForm("password")
@@ -75,36 +199,104 @@ func (r *RestAPI) authUser(c *gin.Context) {
 		)
 		return
 	}
-	user, err := r.userStorage.GetByEmail(email)
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	account, err := domain.NormalizeEmail(email)
+	if err != nil {
+		account = strings.ToLower(strings.TrimSpace(email))
+	}
+	ip := c.ClientIP()
+	if wait := r.loginLimiter.Locked(account, ip); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
 		c.AbortWithStatusJSON(
-			http.StatusNotFound,
-			gin.H{
-				"error": fmt.Sprintf("user with email=%s does not exist", email),
-			},
+			http.StatusTooManyRequests,
+			gin.H{"error": "too many login attempts, try again later"},
 		)
 		return
+	}
+	user, err := r.userStorage.GetByEmail(c.Request.Context(), account)
+	if errors.Is(err, domain.ErrUserNotExist) {
+		_, _ = r.hasher.Verify(r.dummyHash, password)
+		r.failLogin(c, account, ip, "unknown email")
+		return
 	} else if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	if !user.ValidatePassword(password) {
-		c.AbortWithStatusJSON(
-			http.StatusUnauthorized,
-			gin.H{"error": "wrong email or password"},
-		)
+	if !r.checkPassword(c.Request.Context(), user, password) {
+		r.failLogin(c, account, ip, "wrong password")
 		return
 	}
-	token, err := r.jwt.BuildJWTString(user.ID)
-	if err != nil {
-		r.logger.Error("error when creating a jwt-token", zap.Error(err))
-		c.AbortWithStatus(http.StatusInternalServerError)
+	if user.TOTPEnabled {
+		r.startMFALogin(c, user)
+		return
+	}
+	r.loginLimiter.Reset(account)
+	if !r.setAuthCookie(c, user, time.Time{}) {
 		return
 	}
-	c.SetCookie("authGoOrder", token, r.cfg.Auth.TokenExp, "/", "", false, true)
 	c.JSON(http.StatusOK, gin.H{"UserID": user.ID, "msg": "successful authorization"})
 }
 
+// checkPassword verifies the password and transparently upgrades the stored
+// hash when it was produced with another algorithm or outdated parameters.
+func (r *RestAPI) checkPassword(ctx context.Context, user *domain.User, password string) bool {
+	ok, err := r.hasher.Verify(user.Password, password)
+	if err != nil {
+		r.log(ctx).Warn("can't verify a password hash", zap.Uint("id", user.ID), zap.Error(err))
+		return false
+	}
+	if !ok || !r.hasher.NeedsRehash(user.Password) {
+		return ok
+	}
+	hash, err := r.hasher.Hash(password)
+	if err != nil {
+		r.log(ctx).Warn("can't rehash a password", zap.Uint("id", user.ID), zap.Error(err))
+		return true
+	}
+	user.RehashPassword(hash)
+	if err := r.userStorage.UpdatePassword(ctx, user); err != nil {
+		r.log(ctx).Warn("can't save a rehashed password", zap.Uint("id", user.ID), zap.Error(err))
+	}
+	return true
+}
+
+func (r *RestAPI) setAuthCookie(c *gin.Context, user *domain.User, mfaAt time.Time) bool {
+	token, err := r.jwt.BuildJWTString(user.ID, user.SessionVersion, mfaAt)
+	if err != nil {
+		r.log(c.Request.Context()).Error("error when creating a jwt-token", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	r.setCookie(c, "authGoOrder", token, r.cfg.Auth.TokenExp, "/")
+	return true
+}
+
+var sameSiteModes = map[string]http.SameSite{
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// setCookie sets an HTTP-only cookie with the domain, Secure and SameSite
+// attributes of the cookie config.
+func (r *RestAPI) setCookie(c *gin.Context, name, value string, maxAge int, path string) {
+	c.SetSameSite(sameSiteModes[r.cfg.Cookie.SameSite])
+	c.SetCookie(name, value, maxAge, path, r.cfg.Cookie.Domain, r.cfg.Cookie.Secure, true)
+}
+
+// failLogin answers every failed login the same way, whether the email is
+// unknown or the password is wrong, so the response does not reveal which
+// accounts exist.
+func (r *RestAPI) failLogin(c *gin.Context, account, ip, reason string) {
+	r.loginLimiter.Fail(account, ip)
+	if err := r.loginAudit.RecordFailedLogin(c.Request.Context(), domain.NewFailedLogin(account, ip, reason)); err != nil {
+		r.log(c.Request.Context()).Warn("can't record a failed login", zap.Error(err))
+	}
+	c.AbortWithStatusJSON(
+		http.StatusUnauthorized,
+		gin.H{"error": "wrong email or password"},
+	)
+}
+
 func (r *RestAPI) registerUser(c *gin.Context) {
 	email := c.PostForm("email")
 	password := c.PostForm("password")
@@ -117,14 +309,35 @@ func (r *RestAPI) registerUser(c *gin.Context) {
 		)
 		return
 	}
-	user, err := domain.NewUser(email, password)
+	if err := r.pwdPolicy.Validate(password); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hash, err := r.hasher.Hash(password)
 	if err != nil {
 		_ = c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
-	err = r.userStorage.Save(user)
-	if err != nil {
-		_ = c.AbortWithError(http.StatusBadRequest, err)
+	user, err := domain.NewUser(email, hash)
+	if errors.Is(err, domain.ErrInvalidEmail) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	ctx := c.Request.Context()
+	err = r.uow.Do(ctx, func(repos ports.Repositories) error {
+		if err := repos.Users.Save(ctx, user); err != nil {
+			return err
+		}
+		return repos.Outbox.Add(ctx, domain.NewUserRegisteredEvent(user))
+	})
+	if errors.Is(err, domain.ErrDuplicateKey) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": domain.ErrUserAlreadyExists.Error()})
+		return
+	} else if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 	c.JSON(http.StatusCreated, gin.H{"UserID": user.ID, "msg": "registered user"})
@@ -138,9 +351,9 @@ func (r *RestAPI) addOrder(c *gin.Context) {
 		return
 	}
 
-	user, err := r.userStorage.GetByID(userID)
+	user, err := r.userStorage.GetByID(c.Request.Context(), userID)
 	if err != nil {
-		r.logger.Error("can't get a user from the database", zap.Error(err))
+		r.log(c.Request.Context()).Error("can't get a user from the database", zap.Error(err))
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
@@ -155,15 +368,38 @@ func (r *RestAPI) addOrder(c *gin.Context) {
 		c.AbortWithStatus(http.StatusOK)
 		return
 	}
-	err = r.userStorage.Save(user)
-	if errors.Is(err, gorm.ErrDuplicatedKey) {
+	// The purchase amount is optional; percentage accrual rules need it.
+	if amount, ok := c.GetPostForm("amount"); ok {
+		sum, err := strconv.Atoi(amount)
+		if err == nil {
+			err = order.SetAmount(sum)
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": domain.ErrInvalidOrderAmount.Error()})
+			return
+		}
+	}
+	// Only the order is written: saving the whole user would overwrite a
+	// balance changed meanwhile.
+	ctx := c.Request.Context()
+	err = r.uow.Do(ctx, func(repos ports.Repositories) error {
+		if err := repos.Orders.Create(ctx, order); err != nil {
+			return err
+		}
+		if err := repos.History.Add(ctx, domain.NewOrderStatusChange(order, nil)); err != nil {
+			return err
+		}
+		return repos.Outbox.Add(ctx, domain.NewOrderEvent(order))
+	})
+	if errors.Is(err, domain.ErrDuplicateKey) {
 		c.AbortWithStatus(http.StatusConflict)
 		return
 	} else if err != nil {
-		r.logger.Error("error when saving to the database", zap.Error(err))
+		r.log(c.Request.Context()).Error("error when saving to the database", zap.Error(err))
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	r.orderStream.OrderStatusChanged(c.Request.Context(), order)
 	if err := r.orderService.AsyncProcessOrder(c.Request.Context(), *order); err != nil {
 		c.AbortWithError(http.StatusTooManyRequests, err)
 		return
@@ -173,82 +409,102 @@ func (r *RestAPI) addOrder(c *gin.Context) {
 
 func (r *RestAPI) getOrders(c *gin.Context) {
 	userID := c.GetUint("UserID")
-	user, err := r.userStorage.GetByID(userID)
+	query, err := parseListQuery(c, true)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := r.orders.List(c.Request.Context(), userID, query)
 	if err != nil {
-		r.logger.Error(
-			"error when retrieving a user from the database by id",
+		r.log(c.Request.Context()).Error(
+			"error when retrieving orders from the database",
 			zap.Uint("id", userID),
 			zap.Error(err),
 		)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	if len(user.Orders) == 0 {
+	if len(page.Items) == 0 && query.Cursor == nil {
 		c.AbortWithStatus(http.StatusNoContent)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"orders": user.Orders})
+	c.JSON(http.StatusOK, gin.H{"orders": page.Items, "next_cursor": page.NextCursor})
 }
 
-func (r *RestAPI) getBalance(c *gin.Context) {
+// getOrder returns one order of the user with its status history. Orders
+// of other users are reported as not found.
+func (r *RestAPI) getOrder(c *gin.Context) {
 	userID := c.GetUint("UserID")
-	balance, withdrawn, err := r.userStorage.UserBalance(userID)
-	if err != nil {
+	number := c.Param("number")
+	var order *domain.Order
+	var history []*domain.OrderStatusChange
+	ctx := c.Request.Context()
+	err := r.uow.Do(ctx, func(repos ports.Repositories) error {
+		var err error
+		order, err = repos.Orders.GetByNumber(ctx, number)
+		if err != nil {
+			return err
+		}
+		if order.UserID != userID {
+			return domain.ErrOrderNotFound
+		}
+		history, err = repos.History.List(ctx, number)
+		return err
+	})
+	if errors.Is(err, domain.ErrOrderNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": domain.ErrOrderNotFound.Error()})
+		return
+	} else if err != nil {
+		r.log(c.Request.Context()).Error("error when retrieving an order", zap.String("number", number), zap.Error(err))
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"current": balance, "withdrawn": withdrawn})
+	c.JSON(http.StatusOK, gin.H{"order": order, "history": history})
 }
 
-func (r *RestAPI) newOrderWithdrawn(c *gin.Context) {
+// getBalance also lists the points expiring within the configured number
+// of days, the soonest first.
+func (r *RestAPI) getBalance(c *gin.Context) {
 	userID := c.GetUint("UserID")
-	sumString := c.PostForm("sum")
-	number := c.PostForm("order")
-	if number == "" {
-		r.logger.Debug("empty number")
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
-	sum, err := strconv.Atoi(sumString)
-	if err != nil {
-		r.logger.Debug("sum parsing error", zap.String("sum", sumString), zap.Error(err))
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
-	if sum <= 0 {
-		r.logger.Debug("amount less than zero", zap.Int("sum", sum))
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
-	}
-	user, err := r.userStorage.GetByID(userID)
+	until := time.Now().AddDate(0, 0, r.cfg.Points.UpcomingDays)
+	var balance domain.Balance
+	var expiring []*domain.PointLot
+	ctx := c.Request.Context()
+	err := r.uow.Do(ctx, func(repos ports.Repositories) error {
+		var err error
+		balance, err = repos.Users.UserBalance(ctx, userID)
+		if err != nil {
+			return err
+		}
+		expiring, err = repos.Lots.Upcoming(ctx, userID, until)
+		return err
+	})
 	if err != nil {
-		r.logger.Error(
-			"error when retrieving a user from the database by id",
-			zap.Uint("id", userID),
-			zap.Error(err),
-		)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	
-	withdrawn, err := user.AddWithdrawn(number, sum)
-	if errors.Is(err, domain.ErrNotEnoughPoints) {
-		c.AbortWithStatus(http.StatusPaymentRequired)
-		return
-	} else if errors.Is(err, domain.ErrOrderAlreadyExistsForUser) {
-		c.AbortWithStatus(http.StatusAlreadyReported)
-		return
-	} else if err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
-		return
+	upcoming := make([]gin.H, 0, len(expiring))
+	for _, lot := range expiring {
+		upcoming = append(upcoming, gin.H{"points": lot.Remaining, "expires_at": lot.ExpiresAt})
 	}
-	err = r.userStorage.Save(user)
-	if errors.Is(err, gorm.ErrDuplicatedKey) {
-		c.AbortWithStatus(http.StatusConflict)
+	// current is kept for older clients; it is the available balance.
+	c.JSON(http.StatusOK, gin.H{
+		"current":   balance.Current,
+		"available": balance.Current,
+		"held":      balance.Held,
+		"withdrawn": balance.Withdrawn,
+		"expiring":  upcoming,
+	})
+}
+
+func (r *RestAPI) newOrderWithdrawn(c *gin.Context) {
+	user, number, sum, ok := r.withdrawRequest(c)
+	if !ok {
 		return
-	} else if err != nil {
-		r.logger.Warn("error when updating user data", zap.Error(err))
-		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+	withdrawn, err := r.withdrawalService.Withdraw(c.Request.Context(), user, number, sum)
+	if err != nil {
+		r.abortWithdrawal(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, withdrawn)
@@ -256,21 +512,71 @@ func (r *RestAPI) newOrderWithdrawn(c *gin.Context) {
 
 func (r *RestAPI) getWithdraws(c *gin.Context) {
 	userID := c.GetUint("UserID")
-	user, err := r.userStorage.GetByID(userID)
+	query, err := parseListQuery(c, false)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := r.withdrawals.List(c.Request.Context(), userID, query)
 	if err != nil {
-		r.logger.Error(
-			"error when retrieving a user from the database by id",
+		r.log(c.Request.Context()).Error(
+			"error when retrieving withdrawals from the database",
 			zap.Uint("id", userID),
 			zap.Error(err),
 		)
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	if len(user.Withdraws) == 0 {
+	if len(page.Items) == 0 && query.Cursor == nil {
 		c.AbortWithStatus(http.StatusNoContent)
 		return
 	}
-	c.JSON(http.StatusOK, user.Withdraws)
+	c.JSON(http.StatusOK, gin.H{"withdrawals": page.Items, "next_cursor": page.NextCursor})
+}
+
+// parseListQuery reads limit, cursor, sort, from, to and, for orders,
+// status query parameters. Dates are RFC 3339, statuses may be repeated
+// or comma separated.
+func parseListQuery(c *gin.Context, withStatus bool) (domain.ListQuery, error) {
+	var query domain.ListQuery
+	var err error
+	if limit := c.Query("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 {
+			return query, fmt.Errorf("%w: limit must be a positive number", domain.ErrInvalidListQuery)
+		}
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		if query.Cursor, err = domain.DecodeCursor(cursor); err != nil {
+			return query, err
+		}
+	}
+	if query.Sort, err = domain.ParseSortOrder(c.Query("sort")); err != nil {
+		return query, err
+	}
+	for name, target := range map[string]**time.Time{"from": &query.From, "to": &query.To} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return query, fmt.Errorf("%w: %s must be an RFC 3339 date", domain.ErrInvalidListQuery, name)
+		}
+		*target = &t
+	}
+	if withStatus {
+		for _, field := range c.QueryArray("status") {
+			for _, value := range strings.Split(field, ",") {
+				status, err := domain.ParseOrderStatus(strings.TrimSpace(value))
+				if err != nil {
+					return query, err
+				}
+				query.Statuses = append(query.Statuses, status)
+			}
+		}
+	}
+	return query, query.Normalize()
 }
 
 func (r *RestAPI) noPage(c *gin.Context) {
@@ -0,0 +1,76 @@
+package adapters
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (r *RestAPI) createAPIKey(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	name := c.PostForm("name")
+	var scopes []domain.Scope
+	for _, field := range c.PostFormArray("scopes") {
+		for _, scope := range strings.Split(field, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, domain.Scope(scope))
+			}
+		}
+	}
+	if name == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "empty name"})
+		return
+	}
+	key, plain, err := domain.NewAPIKey(userID, name, scopes)
+	if errors.Is(err, domain.ErrUnknownScope) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if err := r.apiKeys.Save(c.Request.Context(), key); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	r.log(c.Request.Context()).Info("API key created", zap.Uint("UserID", userID), zap.Uint("key_id", key.ID))
+	// The plain key is returned only once, it can't be recovered later.
+	c.JSON(http.StatusCreated, gin.H{"key": plain, "apiKey": key})
+}
+
+func (r *RestAPI) listAPIKeys(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	keys, err := r.apiKeys.ListByUser(c.Request.Context(), userID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if len(keys) == 0 {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"apiKeys": keys})
+}
+
+func (r *RestAPI) revokeAPIKey(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	err = r.apiKeys.Revoke(c.Request.Context(), userID, uint(id))
+	if errors.Is(err, domain.ErrAPIKeyNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "API key revoked"})
+}
@@ -0,0 +1,271 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/common/totp"
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const mfaPendingCookie = "mfaPending"
+
+// startMFALogin is the first login step for users with two-factor
+// authentication: the password was right, but the access token is issued
+// only by verifyMFALogin.
+func (r *RestAPI) startMFALogin(c *gin.Context, user *domain.User) {
+	token, err := r.jwt.BuildMFAPendingString(user.ID, user.SessionVersion)
+	if err != nil {
+		r.log(c.Request.Context()).Error("error when creating an mfa pending token", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	r.setCookie(c, mfaPendingCookie, token, r.cfg.Auth.MFAPendingExp, "/api/auth/mfa")
+	c.JSON(http.StatusAccepted, gin.H{"UserID": user.ID, "msg": "second factor required", "mfa_required": true})
+}
+
+func (r *RestAPI) verifyMFALogin(c *gin.Context) {
+	tokenString, err := c.Cookie(mfaPendingCookie)
+	if err != nil || tokenString == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "no pending login"})
+		return
+	}
+	claims, err := r.jwt.GetClaims(tokenString)
+	if err != nil || claims.Purpose != ports.PurposeMFAPending {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "no pending login"})
+		return
+	}
+	user, err := r.userStorage.GetByID(c.Request.Context(), claims.UserID)
+	if errors.Is(err, domain.ErrUserNotExist) || (err == nil && user.SessionVersion != claims.SessionVersion) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "no pending login"})
+		return
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	ip := c.ClientIP()
+	if wait := r.loginLimiter.Locked(user.Email, ip); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.AbortWithStatusJSON(
+			http.StatusTooManyRequests,
+			gin.H{"error": "too many login attempts, try again later"},
+		)
+		return
+	}
+	ok, err := r.verifySecondFactor(c.Request.Context(), user, c.PostForm("code"), c.PostForm("recovery_code"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		r.failLogin(c, user.Email, ip, "wrong second factor")
+		return
+	}
+	r.loginLimiter.Reset(user.Email)
+	r.setCookie(c, mfaPendingCookie, "", -1, "/api/auth/mfa")
+	if !r.setAuthCookie(c, user, time.Now()) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"UserID": user.ID, "msg": "successful authorization"})
+}
+
+func (r *RestAPI) enrollTOTP(c *gin.Context) {
+	user, ok := r.currentUser(c)
+	if !ok {
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	err = user.EnrollTOTP(secret)
+	if errors.Is(err, domain.ErrMFAAlreadyEnabled) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err := r.mfaStorage.UpdateTOTP(c.Request.Context(), user); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret": secret,
+		"uri":    totp.URI(r.cfg.Auth.TOTPIssuer, user.Email, secret),
+	})
+}
+
+func (r *RestAPI) enableTOTP(c *gin.Context) {
+	user, ok := r.currentUser(c)
+	if !ok {
+		return
+	}
+	err := user.EnableTOTP(c.PostForm("code"), time.Now())
+	switch {
+	case errors.Is(err, domain.ErrMFAAlreadyEnabled):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, domain.ErrMFANotEnrolled), errors.Is(err, domain.ErrInvalidMFACode):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := r.mfaStorage.UpdateTOTP(c.Request.Context(), user); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	codes, ok := r.replaceRecoveryCodes(c, user)
+	if !ok {
+		return
+	}
+	if !r.setAuthCookie(c, user, time.Now()) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "two-factor authentication enabled", "recovery_codes": codes})
+}
+
+func (r *RestAPI) disableTOTP(c *gin.Context) {
+	user, ok := r.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": domain.ErrMFANotEnrolled.Error()})
+		return
+	}
+	if !r.checkPassword(c.Request.Context(), user, c.PostForm("password")) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": domain.ErrWrongPassword.Error()})
+		return
+	}
+	if !r.checkSecondFactor(c, user) {
+		return
+	}
+	user.DisableTOTP()
+	if err := r.mfaStorage.UpdateTOTP(c.Request.Context(), user); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := r.mfaStorage.ReplaceRecoveryCodes(c.Request.Context(), user.ID, nil); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "two-factor authentication disabled"})
+}
+
+func (r *RestAPI) regenerateRecoveryCodes(c *gin.Context) {
+	user, ok := r.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": domain.ErrMFANotEnrolled.Error()})
+		return
+	}
+	if !r.checkSecondFactor(c, user) {
+		return
+	}
+	codes, ok := r.replaceRecoveryCodes(c, user)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// stepUpMFA refreshes the second factor of the current session, e.g.
+// before a withdrawal above the threshold.
+func (r *RestAPI) stepUpMFA(c *gin.Context) {
+	user, ok := r.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": domain.ErrMFANotEnrolled.Error()})
+		return
+	}
+	if !r.checkSecondFactor(c, user) {
+		return
+	}
+	if !r.setAuthCookie(c, user, time.Now()) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "second factor verified"})
+}
+
+func (r *RestAPI) currentUser(c *gin.Context) (*domain.User, bool) {
+	userID := c.GetUint("UserID")
+	user, err := r.userStorage.GetByID(c.Request.Context(), userID)
+	if err != nil {
+		r.log(c.Request.Context()).Error("can't get a user from the database", zap.Uint("id", userID), zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+func (r *RestAPI) checkSecondFactor(c *gin.Context, user *domain.User) bool {
+	ok, err := r.verifySecondFactor(c.Request.Context(), user, c.PostForm("code"), c.PostForm("recovery_code"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": domain.ErrInvalidMFACode.Error()})
+		return false
+	}
+	return true
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (r *RestAPI) verifySecondFactor(ctx context.Context, user *domain.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		if !user.VerifyTOTP(code, time.Now()) {
+			return false, nil
+		}
+		// The last used step is persisted so the code can't be replayed.
+		return true, r.mfaStorage.UpdateTOTP(ctx, user)
+	}
+	if recoveryCode == "" {
+		return false, nil
+	}
+	err := r.mfaStorage.UseRecoveryCode(ctx, user.ID, domain.HashRecoveryCode(recoveryCode))
+	if errors.Is(err, domain.ErrInvalidMFACode) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *RestAPI) replaceRecoveryCodes(c *gin.Context, user *domain.User) ([]string, bool) {
+	codes, plain, err := domain.NewRecoveryCodes(user.ID)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if err := r.mfaStorage.ReplaceRecoveryCodes(c.Request.Context(), user.ID, codes); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	return plain, true
+}
+
+// freshMFA reports whether the session verified a second factor recently.
+// API keys never pass this check.
+func (r *RestAPI) freshMFA(c *gin.Context) bool {
+	at := mfaAt(c)
+	return !at.IsZero() && time.Since(at) <= time.Duration(r.cfg.Auth.MFAFreshness)*time.Second
+}
+
+func mfaAt(c *gin.Context) time.Time {
+	value, ok := c.Get("claims")
+	if !ok {
+		return time.Time{}
+	}
+	claims, ok := value.(*ports.Claims)
+	if !ok || claims.MFAAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.MFAAt, 0)
+}
@@ -0,0 +1,201 @@
+package adapters
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/OrtemRepos/go_store/internal/common/luhn"
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	maxBatchOrders  = 1000
+	maxBatchBody    = 1 << 20
+	batchTxAttempts = 3
+)
+
+const (
+	batchAccepted  = "accepted"
+	batchDuplicate = "duplicate"
+	batchConflict  = "conflict"
+	batchInvalid   = "invalid"
+)
+
+var (
+	errBatchRace = errors.New("an order of the batch was added concurrently")
+	errJSONBatch = errors.New("the body must be a JSON array of order numbers")
+)
+
+type batchResult struct {
+	Number string `json:"number"`
+	Status string `json:"status"`
+}
+
+// addOrdersBatch registers many orders in one transaction. The body is a
+// JSON array of numbers or CSV. Every number gets its own result:
+// accepted, duplicate (already uploaded by the user or repeated in the
+// batch), conflict (uploaded by another user) or invalid.
+func (r *RestAPI) addOrdersBatch(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	numbers, err := parseBatchNumbers(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(numbers) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "no order numbers"})
+		return
+	}
+	if len(numbers) > maxBatchOrders {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "at most 1000 orders per batch"})
+		return
+	}
+
+	var results []batchResult
+	var accepted []*domain.Order
+	// A concurrent upload of the same number aborts the transaction; it is
+	// run again and the number is then reported as a duplicate or conflict.
+	for attempt := 0; attempt < batchTxAttempts; attempt++ {
+		results, accepted, err = r.saveBatch(c.Request.Context(), userID, numbers)
+		if !errors.Is(err, errBatchRace) {
+			break
+		}
+	}
+	if err != nil {
+		r.log(c.Request.Context()).Error("error when saving the batch", zap.Uint("UserID", userID), zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	queued := make([]domain.Order, 0, len(accepted))
+	for _, order := range accepted {
+		r.orderStream.OrderStatusChanged(c.Request.Context(), order)
+		queued = append(queued, *order)
+	}
+	r.orderService.AsyncProcessOrders(c.Request.Context(), queued)
+
+	status := http.StatusOK
+	if len(accepted) > 0 {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, gin.H{"accepted": len(accepted), "results": results})
+}
+
+func (r *RestAPI) saveBatch(ctx context.Context, userID uint, numbers []string) ([]batchResult, []*domain.Order, error) {
+	results := make([]batchResult, 0, len(numbers))
+	var accepted []*domain.Order
+	err := r.uow.Do(ctx, func(repos ports.Repositories) error {
+		results, accepted = results[:0], accepted[:0]
+		seen := make(map[string]bool, len(numbers))
+		var events []*domain.Event
+		for _, number := range numbers {
+			status, order, err := r.saveBatchOrder(ctx, repos, userID, number, seen)
+			if err != nil {
+				return err
+			}
+			results = append(results, batchResult{Number: number, Status: status})
+			if order != nil {
+				accepted = append(accepted, order)
+				events = append(events, domain.NewOrderEvent(order))
+			}
+		}
+		return repos.Outbox.Add(ctx, events...)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return results, accepted, nil
+}
+
+// saveBatchOrder returns the result of one number and the order if it was
+// accepted.
+func (r *RestAPI) saveBatchOrder(ctx context.Context, repos ports.Repositories, userID uint, number string, seen map[string]bool) (string, *domain.Order, error) {
+	if !luhn.CheckValidNumber(number) {
+		return batchInvalid, nil, nil
+	}
+	if seen[number] {
+		return batchDuplicate, nil, nil
+	}
+	seen[number] = true
+	existing, err := repos.Orders.GetByNumber(ctx, number)
+	if err == nil {
+		if existing.UserID == userID {
+			return batchDuplicate, nil, nil
+		}
+		return batchConflict, nil, nil
+	} else if !errors.Is(err, domain.ErrOrderNotFound) {
+		return "", nil, err
+	}
+	order, err := domain.NewOrder(number, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := repos.Orders.Create(ctx, order); errors.Is(err, domain.ErrDuplicateKey) {
+		return "", nil, errors.Join(errBatchRace, err)
+	} else if err != nil {
+		return "", nil, err
+	}
+	if err := repos.History.Add(ctx, domain.NewOrderStatusChange(order, nil)); err != nil {
+		return "", nil, err
+	}
+	return batchAccepted, order, nil
+}
+
+// parseBatchNumbers reads a JSON array of strings or numbers, or CSV with
+// any number of numbers per line and an optional "number" header.
+func parseBatchNumbers(c *gin.Context) ([]string, error) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchBody)
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var raw []any
+		decoder := json.NewDecoder(body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, errJSONBatch
+		}
+		numbers := make([]string, 0, len(raw))
+		for _, item := range raw {
+			switch number := item.(type) {
+			case string:
+				numbers = append(numbers, strings.TrimSpace(number))
+			case json.Number:
+				numbers = append(numbers, number.String())
+			default:
+				return nil, errJSONBatch
+			}
+		}
+		return numbers, nil
+	case "text/csv":
+		reader := csv.NewReader(body)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		var numbers []string
+		for line := 0; ; line++ {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return numbers, nil
+			} else if err != nil {
+				return nil, errors.New("malformed CSV")
+			}
+			for _, field := range record {
+				field = strings.TrimSpace(field)
+				if field == "" || line == 0 && strings.EqualFold(field, "number") {
+					continue
+				}
+				numbers = append(numbers, field)
+			}
+		}
+	default:
+		return nil, errors.New("Content-Type must be application/json or text/csv")
+	}
+}
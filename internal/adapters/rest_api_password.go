@@ -0,0 +1,149 @@
+package adapters
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (r *RestAPI) changePassword(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	current := c.PostForm("current_password")
+	password := c.PostForm("new_password")
+	if current == "" || password == "" {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": "empty current or new password"},
+		)
+		return
+	}
+	if err := r.pwdPolicy.Validate(password); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := r.userStorage.GetByID(c.Request.Context(), userID)
+	if err != nil {
+		r.log(c.Request.Context()).Error("can't get a user from the database", zap.Uint("id", userID), zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if !r.checkPassword(c.Request.Context(), user, current) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": domain.ErrWrongPassword.Error()})
+		return
+	}
+	hash, err := r.hasher.Hash(password)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	user.SetPassword(hash)
+	if err := r.userStorage.UpdatePassword(c.Request.Context(), user); err != nil {
+		r.log(c.Request.Context()).Error("error when saving a new password", zap.Uint("id", userID), zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := r.resetStorage.DeleteForUser(c.Request.Context(), user.ID); err != nil {
+		r.log(c.Request.Context()).Warn("can't delete password reset tokens", zap.Uint("id", userID), zap.Error(err))
+	}
+	// Other sessions are revoked by the new session version, the current
+	// one gets a fresh token.
+	if !r.setAuthCookie(c, user, mfaAt(c)) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"UserID": user.ID, "msg": "password changed"})
+}
+
+func (r *RestAPI) requestPasswordReset(c *gin.Context) {
+	// The response is the same whether the account exists or not. Failures
+	// after the account is found are logged instead of answered with an
+	// error: only existing accounts could get one.
+	accepted := gin.H{"msg": "if the account exists, a reset token has been sent"}
+	email, err := domain.NormalizeEmail(c.PostForm("email"))
+	if err != nil {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+	user, err := r.userStorage.GetByEmail(c.Request.Context(), email)
+	if errors.Is(err, domain.ErrUserNotExist) {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	ttl := time.Duration(r.cfg.Auth.ResetTokenTTL) * time.Second
+	token, plain, err := domain.NewPasswordResetToken(user.ID, ttl)
+	if err != nil {
+		r.log(c.Request.Context()).Error("can't create a password reset token", zap.Uint("id", user.ID), zap.Error(err))
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+	if err := r.resetStorage.Save(c.Request.Context(), token); err != nil {
+		r.log(c.Request.Context()).Error("can't save a password reset token", zap.Uint("id", user.ID), zap.Error(err))
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+	err = r.notifier.Notify(c.Request.Context(), domain.Notification{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"Use this token to reset your password: %s\nIt expires at %s.",
+			plain, token.ExpiresAt.Format(time.RFC3339),
+		),
+	})
+	if err != nil {
+		r.log(c.Request.Context()).Error("can't send a password reset token", zap.Uint("id", user.ID), zap.Error(err))
+	}
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+func (r *RestAPI) confirmPasswordReset(c *gin.Context) {
+	plain := c.PostForm("token")
+	password := c.PostForm("password")
+	if plain == "" || password == "" {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": "empty token or password"},
+		)
+		return
+	}
+	if err := r.pwdPolicy.Validate(password); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	token, err := r.resetStorage.Consume(c.Request.Context(), domain.HashResetToken(plain))
+	if errors.Is(err, domain.ErrResetTokenInvalid) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	user, err := r.userStorage.GetByID(c.Request.Context(), token.UserID)
+	if err != nil {
+		r.log(c.Request.Context()).Error("can't get a user from the database", zap.Uint("id", token.UserID), zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	hash, err := r.hasher.Hash(password)
+	if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	user.SetPassword(hash)
+	if err := r.userStorage.UpdatePassword(c.Request.Context(), user); err != nil {
+		r.log(c.Request.Context()).Error("error when saving a new password", zap.Uint("id", user.ID), zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := r.resetStorage.DeleteForUser(c.Request.Context(), user.ID); err != nil {
+		r.log(c.Request.Context()).Warn("can't delete password reset tokens", zap.Uint("id", user.ID), zap.Error(err))
+	}
+	r.loginLimiter.Reset(user.Email)
+	c.JSON(http.StatusOK, gin.H{"UserID": user.ID, "msg": "password has been reset"})
+}
@@ -0,0 +1,85 @@
+package adapters
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/service/order-stream"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// streamRetry is how long browsers wait before reconnecting.
+	streamRetry            = 3 * time.Second
+	defaultStreamHeartbeat = 15 * time.Second
+)
+
+// streamOrders pushes the order status and balance changes of the user as
+// Server-Sent Events. A reconnecting client sends the Last-Event-ID header
+// and gets the events it missed.
+func (r *RestAPI) streamOrders(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	var lastEventID orderstream.EventID
+	if raw := c.GetHeader("Last-Event-ID"); raw != "" {
+		id, err := orderstream.ParseEventID(raw)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+			return
+		}
+		lastEventID = id
+	}
+	sub, replay := r.orderStream.Subscribe(userID, lastEventID)
+	defer r.orderStream.Unsubscribe(sub)
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", sse.ContentType)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	if _, err := fmt.Fprintf(c.Writer, "retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+		return
+	}
+	for _, event := range replay {
+		if writeStreamEvent(c, event) != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	interval := time.Duration(r.cfg.Stream.Heartbeat) * time.Second
+	if interval <= 0 {
+		interval = defaultStreamHeartbeat
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				// The client fell behind; it reconnects and catches up.
+				return
+			}
+			if writeStreamEvent(c, event) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := c.Writer.WriteString(": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+func writeStreamEvent(c *gin.Context, event orderstream.Event) error {
+	return sse.Encode(c.Writer, sse.Event{
+		Id:    event.ID.String(),
+		Event: event.Name,
+		Data:  event.Data,
+	})
+}
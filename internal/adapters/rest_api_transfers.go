@@ -0,0 +1,77 @@
+package adapters
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (r *RestAPI) transferPoints(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	email := c.PostForm("email")
+	sum, err := strconv.Atoi(c.PostForm("sum"))
+	if email == "" || err != nil || sum <= 0 {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if sum > r.cfg.Auth.MFAWithdrawThreshold {
+		user, err := r.userStorage.GetByID(c.Request.Context(), userID)
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if user.TOTPEnabled && !r.freshMFA(c) {
+			c.AbortWithStatusJSON(
+				http.StatusForbidden,
+				gin.H{"error": "fresh two-factor verification required", "mfa_required": true},
+			)
+			return
+		}
+	}
+	transfer, err := r.transferService.Transfer(c.Request.Context(), userID, email, sum)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, transfer)
+	case errors.Is(err, domain.ErrInvalidEmail), errors.Is(err, domain.ErrTransferToSelf),
+		errors.Is(err, domain.ErrTransferRecipientRejected):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrNotEnoughPoints):
+		c.AbortWithStatus(http.StatusPaymentRequired)
+	case errors.Is(err, domain.ErrTransferLimitExceeded):
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		r.log(c.Request.Context()).Error("error when transferring points", zap.Uint("UserID", userID), zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
+
+// getTransfers lists the transfers the user has sent and received.
+func (r *RestAPI) getTransfers(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	query, err := parseListQuery(c, false)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var page *domain.Page[*domain.Transfer]
+	ctx := c.Request.Context()
+	err = r.uow.Do(ctx, func(repos ports.Repositories) error {
+		page, err = repos.Transfers.List(ctx, userID, query)
+		return err
+	})
+	if err != nil {
+		r.log(c.Request.Context()).Error("error when retrieving transfers", zap.Uint("UserID", userID), zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if len(page.Items) == 0 && query.Cursor == nil {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"transfers": page.Items, "next_cursor": page.NextCursor})
+}
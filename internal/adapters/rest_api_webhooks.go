@@ -0,0 +1,117 @@
+package adapters
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const maxDeliveriesLimit = 100
+
+func (r *RestAPI) createWebhook(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	webhook, err := domain.NewWebhook(userID, c.PostForm("url"))
+	if errors.Is(err, domain.ErrInvalidWebhookURL) || errors.Is(err, domain.ErrWebhookAddressNotAllowed) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if err := r.webhooks.Save(c.Request.Context(), webhook); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	r.log(c.Request.Context()).Info("webhook created", zap.Uint("UserID", userID), zap.Uint("webhook_id", webhook.ID))
+	// The secret is returned only once; receivers need it to check the
+	// signature of the payloads.
+	c.JSON(http.StatusCreated, gin.H{"secret": webhook.Secret, "webhook": webhook})
+}
+
+func (r *RestAPI) listWebhooks(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	webhooks, err := r.webhooks.ListByUser(c.Request.Context(), userID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if len(webhooks) == 0 {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+func (r *RestAPI) deleteWebhook(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	err = r.webhooks.Delete(c.Request.Context(), userID, uint(id))
+	if errors.Is(err, domain.ErrWebhookNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "webhook deleted"})
+}
+
+func (r *RestAPI) listWebhookDeliveries(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	limit := maxDeliveriesLimit
+	if raw := c.Query("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxDeliveriesLimit {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+	}
+	if _, err := r.webhooks.Get(c.Request.Context(), userID, uint(id)); errors.Is(err, domain.ErrWebhookNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	deliveries, err := r.webhooks.ListDeliveries(c.Request.Context(), userID, uint(id), limit)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if len(deliveries) == 0 {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+func (r *RestAPI) replayWebhookDelivery(c *gin.Context) {
+	userID := c.GetUint("UserID")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	err = r.webhookService.Replay(c.Request.Context(), userID, uint(id))
+	if errors.Is(err, domain.ErrWebhookDeliveryNotFound) || errors.Is(err, domain.ErrWebhookNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		_ = c.AbortWithError(http.StatusTooManyRequests, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"msg": "delivery queued"})
+}
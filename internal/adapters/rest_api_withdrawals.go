@@ -0,0 +1,109 @@
+package adapters
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// holdWithdrawn reserves points for a withdrawal that has to be confirmed
+// or cancelled before expires_at; otherwise the points are released.
+func (r *RestAPI) holdWithdrawn(c *gin.Context) {
+	user, number, sum, ok := r.withdrawRequest(c)
+	if !ok {
+		return
+	}
+	withdrawn, err := r.withdrawalService.Hold(c.Request.Context(), user, number, sum)
+	if err != nil {
+		r.abortWithdrawal(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, withdrawn)
+}
+
+func (r *RestAPI) confirmWithdrawn(c *gin.Context) {
+	withdrawn, err := r.withdrawalService.Confirm(c.Request.Context(), c.GetUint("UserID"), c.Param("number"))
+	if err != nil {
+		r.abortWithdrawal(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, withdrawn)
+}
+
+func (r *RestAPI) cancelWithdrawn(c *gin.Context) {
+	withdrawn, err := r.withdrawalService.Cancel(c.Request.Context(), c.GetUint("UserID"), c.Param("number"))
+	if err != nil {
+		r.abortWithdrawal(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, withdrawn)
+}
+
+// withdrawRequest reads the order and sum of a new withdrawal and loads the
+// user. It aborts the request and returns false if they are not valid or
+// the sum needs a fresh second factor.
+func (r *RestAPI) withdrawRequest(c *gin.Context) (*domain.User, string, int, bool) {
+	userID := c.GetUint("UserID")
+	sumString := c.PostForm("sum")
+	number := c.PostForm("order")
+	if number == "" {
+		r.log(c.Request.Context()).Debug("empty number")
+		c.AbortWithStatus(http.StatusBadRequest)
+		return nil, "", 0, false
+	}
+	sum, err := strconv.Atoi(sumString)
+	if err != nil {
+		r.log(c.Request.Context()).Debug("sum parsing error", zap.String("sum", sumString), zap.Error(err))
+		c.AbortWithStatus(http.StatusBadRequest)
+		return nil, "", 0, false
+	}
+	if sum <= 0 {
+		r.log(c.Request.Context()).Debug("amount less than zero", zap.Int("sum", sum))
+		c.AbortWithStatus(http.StatusBadRequest)
+		return nil, "", 0, false
+	}
+	user, err := r.userStorage.GetByID(c.Request.Context(), userID)
+	if err != nil {
+		r.log(c.Request.Context()).Error(
+			"error when retrieving a user from the database by id",
+			zap.Uint("id", userID),
+			zap.Error(err),
+		)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, "", 0, false
+	}
+	if user.TOTPEnabled && sum > r.cfg.Auth.MFAWithdrawThreshold && !r.freshMFA(c) {
+		c.AbortWithStatusJSON(
+			http.StatusForbidden,
+			gin.H{"error": "fresh two-factor verification required", "mfa_required": true},
+		)
+		return nil, "", 0, false
+	}
+	return user, number, sum, true
+}
+
+func (r *RestAPI) abortWithdrawal(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domain.ErrNotEnoughPoints):
+		c.AbortWithStatus(http.StatusPaymentRequired)
+	case errors.Is(err, domain.ErrOrderAlreadyExistsForUser):
+		c.AbortWithStatus(http.StatusAlreadyReported)
+	case errors.Is(err, domain.ErrDuplicateKey):
+		c.AbortWithStatus(http.StatusConflict)
+	case errors.Is(err, domain.ErrInvalidOrderNubmer):
+		c.AbortWithStatus(http.StatusBadRequest)
+	case errors.Is(err, domain.ErrWithdrawalNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrWithdrawalNotHeld):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrWithdrawalHoldExpired):
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": err.Error()})
+	default:
+		r.log(c.Request.Context()).Warn("error when updating user data", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
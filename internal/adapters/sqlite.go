@@ -0,0 +1,48 @@
+package adapters
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// OpenSQLite opens the database used by the gorm adapters on SQLite. The
+// adapters are written against Postgres, so the connection is set up to
+// keep their semantics:
+//   - SQLite has no row locks and allows one writer at a time, so the pool
+//     is limited to one connection and transactions are serialized instead
+//     of failing with SQLITE_BUSY;
+//   - times are stored as text and compared as strings, so they are always
+//     written in UTC;
+//   - constraint errors are translated to gorm.ErrDuplicatedKey like the
+//     Postgres driver does.
+//
+// path may be ":memory:" for a database that lives as long as the process.
+func OpenSQLite(path string) (*gorm.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	if path != ":memory:" {
+		params.Add("_pragma", "journal_mode(WAL)")
+	}
+	params.Set("_time_format", "sqlite")
+	db, err := gorm.Open(
+		sqlite.Open(path+"?"+params.Encode()),
+		&gorm.Config{
+			TranslateError: true,
+			NowFunc:        func() time.Time { return time.Now().UTC() },
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening the sqlite database: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return db, nil
+}
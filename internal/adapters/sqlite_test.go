@@ -0,0 +1,37 @@
+package adapters_test
+
+import (
+	"testing"
+
+	"github.com/OrtemRepos/go_store/internal/adapters"
+	"github.com/OrtemRepos/go_store/internal/adapters/storagetest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestSQLiteStorage holds SQLite to the behavior of Postgres: both run the
+// same suite.
+func TestSQLiteStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+		return storagetest.Gorm(openSQLite(t))
+	})
+}
+
+// TestSQLiteMigrations runs the migrations on tables created before them.
+func TestSQLiteMigrations(t *testing.T) {
+	storagetest.RunMigrations(t, openSQLite)
+}
+
+func openSQLite(t *testing.T) *gorm.DB {
+	db, err := adapters.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Discard
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return db
+}
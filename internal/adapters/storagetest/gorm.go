@@ -0,0 +1,123 @@
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/OrtemRepos/go_store/internal/adapters"
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Gorm returns the gorm adapters on db, which must be empty.
+func Gorm(db *gorm.DB) Backend {
+	logger := zap.NewNop()
+	return Backend{
+		Repos: ports.Repositories{
+			Users:       adapters.NewUserStorage(db, logger),
+			Orders:      adapters.NewOrderRepository(db, logger),
+			Withdrawals: adapters.NewWithdrawalRepository(db, logger),
+			Outbox:      adapters.NewOutbox(db, logger),
+			History:     adapters.NewOrderHistory(db, logger),
+			Lots:        adapters.NewPointLots(db, logger),
+			Transfers:   adapters.NewTransferRepository(db, logger),
+		},
+		UoW: adapters.NewUnitOfWork(db, 0, logger),
+	}
+}
+
+// Memory returns the adapters of store.
+func Memory(store *adapters.MemoryStore) Backend {
+	return Backend{
+		Repos: ports.Repositories{
+			Users:       store.Users(),
+			Orders:      store.Orders(),
+			Withdrawals: store.Withdrawals(),
+			Outbox:      store.Outbox(),
+			History:     store.History(),
+			Lots:        store.Lots(),
+			Transfers:   store.Transfers(),
+		},
+		UoW: store.UnitOfWork(),
+	}
+}
+
+// RunMigrations runs the checks of the migrations the gorm adapters run
+// on a database created before them. newDB must return an empty database
+// for every call.
+func RunMigrations(t *testing.T, newDB func(t *testing.T) *gorm.DB) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, db *gorm.DB)
+	}{
+		{"LowercaseEmails", testLowercaseEmails},
+		{"EmailCollision", testEmailCollision},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newDB(t)
+			adapters.NewUserStorage(db, zap.NewNop())
+			tt.fn(t, db)
+		})
+	}
+}
+
+// createUsers stores the emails as they were stored before they were
+// normalized and returns the IDs of the users.
+func createUsers(t *testing.T, db *gorm.DB, emails ...string) []uint {
+	t.Helper()
+	ids := make([]uint, len(emails))
+	for i, email := range emails {
+		user := domain.User{Email: email, Password: "hash"}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("Create(%s): %v", email, err)
+		}
+		ids[i] = user.ID
+	}
+	return ids
+}
+
+func storedEmails(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var emails []string
+	if err := db.Model(&domain.User{}).Order("id").Pluck("email", &emails).Error; err != nil {
+		t.Fatal(err)
+	}
+	return emails
+}
+
+func testLowercaseEmails(t *testing.T, db *gorm.DB) {
+	createUsers(t, db, "Mixed@Example.com", "lower@example.com")
+
+	if err := adapters.LowercaseEmails(db); err != nil {
+		t.Fatalf("LowercaseEmails: %v", err)
+	}
+	if emails := storedEmails(t, db); !slices.Equal(emails, []string{"mixed@example.com", "lower@example.com"}) {
+		t.Errorf("emails = %v, want them in lower case", emails)
+	}
+	users := adapters.NewUserStorage(db, zap.NewNop())
+	if _, err := users.GetByEmail(ctx, "Mixed@example.com"); err != nil {
+		t.Errorf("GetByEmail(Mixed@example.com): %v", err)
+	}
+}
+
+func testEmailCollision(t *testing.T, db *gorm.DB) {
+	ids := createUsers(t, db, "Mixed@Example.com", "Twin@example.com", "twin@Example.com", "TWIN@example.com")
+
+	err := adapters.LowercaseEmails(db)
+	if !errors.Is(err, adapters.ErrEmailCollision) {
+		t.Fatalf("LowercaseEmails error = %v, want ErrEmailCollision", err)
+	}
+	if want := fmt.Sprintf("ids %d, %d, %d", ids[1], ids[2], ids[3]); !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("LowercaseEmails error = %q, want it to list %s", err, want)
+	}
+	want := []string{"Mixed@Example.com", "Twin@example.com", "twin@Example.com", "TWIN@example.com"}
+	if emails := storedEmails(t, db); !slices.Equal(emails, want) {
+		t.Errorf("emails = %v, want them unchanged", emails)
+	}
+}
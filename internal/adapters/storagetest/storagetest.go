@@ -0,0 +1,891 @@
+// Package storagetest is a conformance suite for the storage ports. Every
+// backend runs the same checks, so they agree on uniqueness rules, errors,
+// pagination and transactions:
+//
+//	func TestSQLiteStorage(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+//			db, err := adapters.OpenSQLite(":memory:")
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return storagetest.Gorm(db)
+//		})
+//	}
+//
+// The adapters package runs the suite against the memory store, SQLite
+// and, when STORE_TEST_POSTGRES_DSN names a database, Postgres. The two
+// databases also run RunMigrations.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+)
+
+type Backend struct {
+	Repos ports.Repositories
+	UoW   ports.UnitOfWork
+}
+
+// NewBackend must return an empty backend for every call.
+type NewBackend func(t *testing.T) Backend
+
+func Run(t *testing.T, newBackend NewBackend) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, b Backend)
+	}{
+		{"UserRoundTrip", testUserRoundTrip},
+		{"UnknownUser", testUnknownUser},
+		{"DuplicateEmail", testDuplicateEmail},
+		{"OrdersOfUser", testOrdersOfUser},
+		{"OrderConflict", testOrderConflict},
+		{"CompleteOrderOnce", testCompleteOrderOnce},
+		{"Balance", testBalance},
+		{"UnitOfWorkRollback", testUnitOfWorkRollback},
+		{"UnitOfWorkCommit", testUnitOfWorkCommit},
+		{"CanceledContext", testCanceledContext},
+		{"OrderPagination", testOrderPagination},
+		{"WithdrawalList", testWithdrawalList},
+		{"ConcurrentAccural", testConcurrentAccural},
+		{"PaginationAcrossTimeZones", testPaginationAcrossTimeZones},
+		{"Outbox", testOutbox},
+		{"OrderHistory", testOrderHistory},
+		{"AdjustBalance", testAdjustBalance},
+		{"WithdrawalHolds", testWithdrawalHolds},
+		{"PointLots", testPointLots},
+		{"ReleaseIntoExpiredLot", testReleaseIntoExpiredLot},
+		{"ExpiredLotsAfter", testExpiredLotsAfter},
+		{"Transfers", testTransfers},
+		{"Reconciliation", testReconciliation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newBackend(t))
+		})
+	}
+}
+
+// ctx is the context of the storage calls of the checks that don't test
+// cancellation.
+var ctx = context.Background()
+
+// Numbers that pass the Luhn check.
+var numbers = []string{
+	"12345678903", "9278923470", "2377225624", "346436439",
+	"79927398713", "4561261212345467", "5062821234567892", "49927398716",
+}
+
+func newUser(t *testing.T, b Backend, email string) *domain.User {
+	t.Helper()
+	user, err := domain.NewUser(email, "hash")
+	if err != nil {
+		t.Fatalf("NewUser: %v", err)
+	}
+	if err := b.Repos.Users.Save(ctx, user); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if user.ID == 0 {
+		t.Fatal("Save did not assign an ID")
+	}
+	return user
+}
+
+func addOrder(t *testing.T, b Backend, user *domain.User, number string) *domain.Order {
+	t.Helper()
+	order, err := domain.NewOrder(number, user.ID)
+	if err != nil {
+		t.Fatalf("NewOrder(%s): %v", number, err)
+	}
+	if err := b.Repos.Orders.Create(ctx, order); err != nil {
+		t.Fatalf("Create(%s): %v", number, err)
+	}
+	return order
+}
+
+func testUserRoundTrip(t *testing.T, b Backend) {
+	user := newUser(t, b, "Foo@Example.com")
+	byID, err := b.Repos.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if byID.Email != "foo@example.com" || byID.Password != "hash" || byID.SessionVersion != user.SessionVersion {
+		t.Errorf("GetByID returned %+v", byID)
+	}
+	byEmail, err := b.Repos.Users.GetByEmail(ctx, "FOO@example.com")
+	if err != nil {
+		t.Fatalf("GetByEmail: %v", err)
+	}
+	if byEmail.ID != user.ID {
+		t.Errorf("GetByEmail returned user %d, want %d", byEmail.ID, user.ID)
+	}
+	user.SetPassword("other")
+	if err := b.Repos.Users.UpdatePassword(ctx, user); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	version, err := b.Repos.Users.SessionVersion(ctx, user.ID)
+	if err != nil || version != user.SessionVersion {
+		t.Errorf("SessionVersion = %d, %v; want %d", version, err, user.SessionVersion)
+	}
+}
+
+func testUnknownUser(t *testing.T, b Backend) {
+	if _, err := b.Repos.Users.GetByID(ctx, 404); !errors.Is(err, domain.ErrUserNotExist) {
+		t.Errorf("GetByID error = %v, want ErrUserNotExist", err)
+	}
+	if _, err := b.Repos.Users.GetByEmail(ctx, "nobody@example.com"); !errors.Is(err, domain.ErrUserNotExist) {
+		t.Errorf("GetByEmail error = %v, want ErrUserNotExist", err)
+	}
+	if _, err := b.Repos.Users.UserBalance(ctx, 404); !errors.Is(err, domain.ErrUserNotExist) {
+		t.Errorf("UserBalance error = %v, want ErrUserNotExist", err)
+	}
+	if _, err := b.Repos.Users.SessionVersion(ctx, 404); !errors.Is(err, domain.ErrUserNotExist) {
+		t.Errorf("SessionVersion error = %v, want ErrUserNotExist", err)
+	}
+}
+
+func testDuplicateEmail(t *testing.T, b Backend) {
+	newUser(t, b, "dup@example.com")
+	user, _ := domain.NewUser("dup@example.com", "hash")
+	if err := b.Repos.Users.Save(ctx, user); !errors.Is(err, domain.ErrDuplicateKey) {
+		t.Errorf("Save error = %v, want ErrDuplicateKey", err)
+	}
+}
+
+func testOrdersOfUser(t *testing.T, b Backend) {
+	user := newUser(t, b, "orders@example.com")
+	if _, err := user.AddOrder(numbers[0]); err != nil {
+		t.Fatalf("AddOrder: %v", err)
+	}
+	if err := b.Repos.Users.Save(ctx, user); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := b.Repos.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if len(loaded.Orders) != 1 || loaded.Orders[0].Number != numbers[0] {
+		t.Fatalf("GetByID orders = %+v", loaded.Orders)
+	}
+	order, err := b.Repos.Orders.GetByNumber(ctx, numbers[0])
+	if err != nil || order.UserID != user.ID || order.Status != domain.REGISTERED {
+		t.Errorf("GetByNumber = %+v, %v", order, err)
+	}
+	if _, err := b.Repos.Orders.GetByNumber(ctx, numbers[1]); !errors.Is(err, domain.ErrOrderNotFound) {
+		t.Errorf("GetByNumber error = %v, want ErrOrderNotFound", err)
+	}
+}
+
+func testOrderConflict(t *testing.T, b Backend) {
+	first := newUser(t, b, "first@example.com")
+	second := newUser(t, b, "second@example.com")
+	addOrder(t, b, first, numbers[0])
+	order, _ := domain.NewOrder(numbers[0], second.ID)
+	if err := b.Repos.Orders.Create(ctx, order); !errors.Is(err, domain.ErrOrderConflict) {
+		t.Errorf("Create error = %v, want ErrOrderConflict", err)
+	}
+	if _, err := second.AddOrder(numbers[0]); err != nil {
+		t.Fatalf("AddOrder: %v", err)
+	}
+	if err := b.Repos.Users.Save(ctx, second); !errors.Is(err, domain.ErrDuplicateKey) {
+		t.Errorf("Save error = %v, want ErrDuplicateKey", err)
+	}
+}
+
+func testCompleteOrderOnce(t *testing.T, b Backend) {
+	user := newUser(t, b, "complete@example.com")
+	addOrder(t, b, user, numbers[0])
+	failed := &domain.Order{Number: numbers[0], Failure: "accrual system answered 400"}
+	if err := b.Repos.Orders.MarkNeedsAttention(ctx, failed); err != nil {
+		t.Fatalf("MarkNeedsAttention: %v", err)
+	}
+	order, err := b.Repos.Orders.GetByNumber(ctx, numbers[0])
+	if err != nil || order.Completed || order.Status != domain.NEEDS_ATTENTION || order.Failure != failed.Failure {
+		t.Errorf("GetByNumber after MarkNeedsAttention = %+v, %v", order, err)
+	}
+	accural := 100
+	processed := &domain.Order{Number: numbers[0], Status: domain.PROCESSED, Accural: &accural}
+	if err := b.Repos.Orders.Complete(ctx, processed); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if err := b.Repos.Orders.MarkNeedsAttention(ctx, failed); !errors.Is(err, domain.ErrOrderAlreadyCompleted) {
+		t.Errorf("MarkNeedsAttention of a completed order error = %v, want ErrOrderAlreadyCompleted", err)
+	}
+	if err := b.Repos.Orders.Complete(ctx, processed); !errors.Is(err, domain.ErrOrderAlreadyCompleted) {
+		t.Errorf("second Complete error = %v, want ErrOrderAlreadyCompleted", err)
+	}
+	order, err = b.Repos.Orders.GetByNumber(ctx, numbers[0])
+	if err != nil || !order.Completed || order.Status != domain.PROCESSED || order.Accural == nil || *order.Accural != 100 {
+		t.Errorf("GetByNumber = %+v, %v", order, err)
+	}
+}
+
+func testBalance(t *testing.T, b Backend) {
+	user := newUser(t, b, "balance@example.com")
+	if err := b.Repos.Users.AddAccural(ctx, user.ID, 500); err != nil {
+		t.Fatalf("AddAccural: %v", err)
+	}
+	if err := b.Repos.Users.AddAccural(ctx, user.ID, -200); err != nil {
+		t.Fatalf("AddAccural: %v", err)
+	}
+	balance, err := b.Repos.Users.UserBalance(ctx, user.ID)
+	if err != nil || balance.Current != 300 || balance.Withdrawn != 200 {
+		t.Errorf("UserBalance = %+v, %v; want 300, 200", balance, err)
+	}
+	if err := b.Repos.Users.AddAccural(ctx, 404, 100); !errors.Is(err, domain.ErrUserNotExist) {
+		t.Errorf("AddAccural of an unknown user error = %v, want ErrUserNotExist", err)
+	}
+}
+
+func testUnitOfWorkRollback(t *testing.T, b Backend) {
+	user := newUser(t, b, "rollback@example.com")
+	addOrder(t, b, user, numbers[0])
+	errAbort := errors.New("abort")
+	err := b.UoW.Do(ctx, func(repos ports.Repositories) error {
+		accural := 50
+		if err := repos.Orders.Complete(ctx, &domain.Order{Number: numbers[0], Status: domain.PROCESSED, Accural: &accural}); err != nil {
+			return err
+		}
+		if err := repos.Users.AddAccural(ctx, user.ID, accural); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Do error = %v, want the error of fn", err)
+	}
+	balance, _ := b.Repos.Users.UserBalance(ctx, user.ID)
+	current := balance.Current
+	order, _ := b.Repos.Orders.GetByNumber(ctx, numbers[0])
+	if current != 0 || order == nil || order.Completed {
+		t.Errorf("rolled back transaction left balance %d and order %+v", current, order)
+	}
+}
+
+func testUnitOfWorkCommit(t *testing.T, b Backend) {
+	user := newUser(t, b, "commit@example.com")
+	addOrder(t, b, user, numbers[0])
+	err := b.UoW.Do(ctx, func(repos ports.Repositories) error {
+		accural := 50
+		if err := repos.Orders.Complete(ctx, &domain.Order{Number: numbers[0], Status: domain.PROCESSED, Accural: &accural}); err != nil {
+			return err
+		}
+		return repos.Users.AddAccural(ctx, user.ID, accural)
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	balance, _ := b.Repos.Users.UserBalance(ctx, user.ID)
+	current := balance.Current
+	order, _ := b.Repos.Orders.GetByNumber(ctx, numbers[0])
+	if current != 50 || order == nil || !order.Completed {
+		t.Errorf("committed transaction left balance %d and order %+v", current, order)
+	}
+}
+
+func testCanceledContext(t *testing.T, b Backend) {
+	user := newUser(t, b, "canceled@example.com")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := b.Repos.Users.GetByID(canceled, user.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetByID with a canceled context error = %v, want context.Canceled", err)
+	}
+	err := b.UoW.Do(canceled, func(repos ports.Repositories) error {
+		return repos.Users.AddAccural(canceled, user.ID, 10)
+	})
+	if err == nil {
+		t.Error("Do with a canceled context succeeded")
+	}
+
+	// A context done while the transaction is open rolls it back.
+	txCtx, cancelTx := context.WithCancel(context.Background())
+	err = b.UoW.Do(txCtx, func(repos ports.Repositories) error {
+		if err := repos.Users.AddAccural(txCtx, user.ID, 10); err != nil {
+			return err
+		}
+		cancelTx()
+		return nil
+	})
+	if err == nil {
+		t.Error("Do succeeded although its context was canceled before the commit")
+	}
+	balance, err := b.Repos.Users.UserBalance(ctx, user.ID)
+	if err != nil || balance.Current != 0 {
+		t.Errorf("balance after canceled transactions = %+v, %v, want 0", balance, err)
+	}
+}
+
+func testOrderPagination(t *testing.T, b Backend) {
+	user := newUser(t, b, "pages@example.com")
+	other := newUser(t, b, "other@example.com")
+	for _, number := range numbers[:5] {
+		addOrder(t, b, user, number)
+	}
+	addOrder(t, b, other, numbers[5])
+
+	for _, sort := range []domain.SortOrder{domain.SortAsc, domain.SortDesc} {
+		var seen []string
+		query := domain.ListQuery{Limit: 2, Sort: sort}
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatalf("%s: too many pages", sort)
+			}
+			page, err := b.Repos.Orders.List(ctx, user.ID, query)
+			if err != nil {
+				t.Fatalf("%s: List: %v", sort, err)
+			}
+			for _, order := range page.Items {
+				seen = append(seen, order.Number)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			if query.Cursor, err = domain.DecodeCursor(page.NextCursor); err != nil {
+				t.Fatalf("%s: DecodeCursor: %v", sort, err)
+			}
+		}
+		want := append([]string(nil), numbers[:5]...)
+		if sort == domain.SortDesc {
+			for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+				want[i], want[j] = want[j], want[i]
+			}
+		}
+		if fmt.Sprint(seen) != fmt.Sprint(want) {
+			t.Errorf("%s: pages returned %v, want %v", sort, seen, want)
+		}
+	}
+
+	page, err := b.Repos.Orders.List(ctx, user.ID, domain.ListQuery{Limit: 10, Statuses: append(domain.ListQuery{}.Statuses, domain.PROCESSED)})
+	if err != nil || len(page.Items) != 0 {
+		t.Errorf("List by status = %+v, %v; want no orders", page, err)
+	}
+}
+
+func testWithdrawalList(t *testing.T, b Backend) {
+	user := newUser(t, b, "withdraw@example.com")
+	if err := b.Repos.Users.AddAccural(ctx, user.ID, 100); err != nil {
+		t.Fatalf("AddAccural: %v", err)
+	}
+	user, err := b.Repos.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if _, err := user.AddWithdrawn(numbers[0], 40); err != nil {
+		t.Fatalf("AddWithdrawn: %v", err)
+	}
+	if err := b.Repos.Users.Save(ctx, user); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	page, err := b.Repos.Withdrawals.List(ctx, user.ID, domain.ListQuery{Limit: 10})
+	if err != nil || len(page.Items) != 1 || page.Items[0].Sum != 40 || page.NextCursor != "" {
+		t.Errorf("List = %+v, %v", page, err)
+	}
+}
+
+// testConcurrentAccural checks that balance updates are applied atomically
+// by the storage and not read-modify-written by the caller.
+func testConcurrentAccural(t *testing.T, b Backend) {
+	user := newUser(t, b, "concurrent@example.com")
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- b.Repos.Users.AddAccural(ctx, user.ID, 10)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("AddAccural: %v", err)
+		}
+	}
+	balance, err := b.Repos.Users.UserBalance(ctx, user.ID)
+	if err != nil || balance.Current != 200 {
+		t.Errorf("UserBalance = %d, %v; want 200", balance.Current, err)
+	}
+}
+
+// testPaginationAcrossTimeZones checks that a cursor and a date range given
+// in a time zone other than the stored one select the same rows.
+func testPaginationAcrossTimeZones(t *testing.T, b Backend) {
+	user := newUser(t, b, "zones@example.com")
+	for _, number := range numbers[:3] {
+		addOrder(t, b, user, number)
+	}
+	zone := time.FixedZone("UTC+5", 5*60*60)
+	first, err := b.Repos.Orders.List(ctx, user.ID, domain.ListQuery{Limit: 1})
+	if err != nil || first.NextCursor == "" {
+		t.Fatalf("List = %+v, %v", first, err)
+	}
+	cursor, err := domain.DecodeCursor(first.NextCursor)
+	if err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+	cursor.CreatedAt = cursor.CreatedAt.In(zone)
+	from := first.Items[0].CreatedAt.In(zone)
+	rest, err := b.Repos.Orders.List(ctx, user.ID, domain.ListQuery{Limit: 10, Cursor: cursor, From: &from})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(rest.Items) != 2 || rest.Items[0].Number != numbers[1] || rest.Items[1].Number != numbers[2] {
+		t.Errorf("List after the cursor returned %+v", rest.Items)
+	}
+}
+
+func testOutbox(t *testing.T, b Backend) {
+	user := newUser(t, b, "outbox@example.com")
+	errAbort := errors.New("abort")
+	err := b.UoW.Do(ctx, func(repos ports.Repositories) error {
+		if err := repos.Outbox.Add(ctx, domain.NewUserRegisteredEvent(user)); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Do error = %v, want the error of fn", err)
+	}
+	if events, err := b.Repos.Outbox.Pending(ctx, 0, 10); err != nil || len(events) != 0 {
+		t.Fatalf("Pending after rollback = %+v, %v; want no events", events, err)
+	}
+
+	err = b.UoW.Do(ctx, func(repos ports.Repositories) error {
+		return repos.Outbox.Add(ctx,
+			domain.NewUserRegisteredEvent(user),
+			domain.NewOrderEvent(&domain.Order{UserID: user.ID, Number: numbers[0], Status: domain.REGISTERED}),
+			domain.NewWithdrawalEvent(user.ID, &domain.Withdraw{Number: numbers[1], Sum: 10, Status: domain.CONFIRMED}),
+		)
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	events, err := b.Repos.Outbox.Pending(ctx, 0, 10)
+	if err != nil || len(events) != 3 {
+		t.Fatalf("Pending = %+v, %v; want 3 events", events, err)
+	}
+	want := []domain.EventType{domain.EventUserRegistered, domain.EventOrderRegistered, domain.EventPointsWithdrawn}
+	for i, event := range events {
+		if event.Type != want[i] || event.UserID != user.ID || len(event.Payload) == 0 {
+			t.Errorf("event %d = %+v, want type %s", i, event, want[i])
+		}
+	}
+	retryAt := time.Now().Add(time.Minute)
+	if err := b.Repos.Outbox.MarkFailed(ctx, events[0].ID, "down", retryAt); err != nil {
+		t.Fatalf("MarkFailed: %v", err)
+	}
+	if err := b.Repos.Outbox.MarkPublished(ctx, events[1].ID, time.Now()); err != nil {
+		t.Fatalf("MarkPublished: %v", err)
+	}
+	rest, err := b.Repos.Outbox.Pending(ctx, 0, 10)
+	if err != nil || len(rest) != 2 || rest[0].ID != events[0].ID || rest[0].Attempts != 1 || rest[1].ID != events[2].ID {
+		t.Fatalf("Pending after publishing = %+v, %v", rest, err)
+	}
+	if rest[0].RetryAt == nil || rest[0].RetryAt.Sub(retryAt).Abs() > time.Millisecond {
+		t.Errorf("RetryAt = %v, want %v", rest[0].RetryAt, retryAt)
+	}
+	after, err := b.Repos.Outbox.Pending(ctx, events[0].ID, 1)
+	if err != nil || len(after) != 1 || after[0].ID != events[2].ID {
+		t.Errorf("Pending after the first event = %+v, %v", after, err)
+	}
+
+	if err := b.Repos.Outbox.MarkDead(ctx, events[0].ID, "bad payload", time.Now()); err != nil {
+		t.Fatalf("MarkDead: %v", err)
+	}
+	rest, err = b.Repos.Outbox.Pending(ctx, 0, 10)
+	if err != nil || len(rest) != 1 || rest[0].ID != events[2].ID {
+		t.Errorf("Pending after the first event died = %+v, %v", rest, err)
+	}
+	committed, err := b.Repos.Outbox.Committed(ctx, events[0].ID, 10)
+	if err != nil || len(committed) != 2 || committed[0].ID != events[1].ID || committed[1].ID != events[2].ID {
+		t.Fatalf("Committed = %+v, %v; want the published and the pending event", committed, err)
+	}
+	if committed[0].CreatedAt.IsZero() {
+		t.Errorf("Committed left out CreatedAt: %+v", committed[0])
+	}
+}
+
+func testOrderHistory(t *testing.T, b Backend) {
+	user := newUser(t, b, "history@example.com")
+	order := addOrder(t, b, user, numbers[0])
+	other := addOrder(t, b, user, numbers[1])
+	accural := 70
+	changes := []*domain.OrderStatusChange{
+		domain.NewOrderStatusChange(order, nil),
+		domain.NewOrderStatusChange(other, nil),
+		domain.NewOrderStatusChange(&domain.Order{Number: numbers[0], Status: domain.PROCESSING}, []byte(`{"status":"PROCESSING"}`)),
+		domain.NewOrderStatusChange(&domain.Order{Number: numbers[0], Status: domain.PROCESSED, Accural: &accural}, []byte(`{"status":"PROCESSED","accrual":70}`)),
+	}
+	for _, change := range changes {
+		if err := b.Repos.History.Add(ctx, change); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	history, err := b.Repos.History.List(ctx, numbers[0])
+	if err != nil || len(history) != 3 {
+		t.Fatalf("List = %+v, %v; want 3 changes", history, err)
+	}
+	want := []domain.OrderStatusChange{*changes[0], *changes[2], *changes[3]}
+	for i, change := range history {
+		if change.Status != want[i].Status || change.Response != want[i].Response || change.CreatedAt.IsZero() {
+			t.Errorf("change %d = %+v, want %+v", i, change, want[i])
+		}
+	}
+	if history[2].Accural == nil || *history[2].Accural != accural {
+		t.Errorf("last change has accural %v, want %d", history[2].Accural, accural)
+	}
+}
+
+func testAdjustBalance(t *testing.T, b Backend) {
+	user := newUser(t, b, "adjust@example.com")
+	if err := b.Repos.Users.AdjustBalance(ctx, user.ID, domain.Balance{Current: 100}); err != nil {
+		t.Fatalf("AdjustBalance: %v", err)
+	}
+	err := b.Repos.Users.AdjustBalance(ctx, user.ID, domain.Balance{Current: -150, Held: 150})
+	if !errors.Is(err, domain.ErrNotEnoughPoints) {
+		t.Errorf("AdjustBalance over the balance error = %v, want ErrNotEnoughPoints", err)
+	}
+	if err := b.Repos.Users.AdjustBalance(ctx, user.ID, domain.Balance{Current: -60, Held: 60}); err != nil {
+		t.Fatalf("AdjustBalance: %v", err)
+	}
+	err = b.Repos.Users.AdjustBalance(ctx, user.ID, domain.Balance{Held: -70, Withdrawn: 70})
+	if !errors.Is(err, domain.ErrNotEnoughPoints) {
+		t.Errorf("AdjustBalance over the held points error = %v, want ErrNotEnoughPoints", err)
+	}
+	if err := b.Repos.Users.AdjustBalance(ctx, 404, domain.Balance{Current: 1}); !errors.Is(err, domain.ErrUserNotExist) {
+		t.Errorf("AdjustBalance of an unknown user error = %v, want ErrUserNotExist", err)
+	}
+	balance, err := b.Repos.Users.UserBalance(ctx, user.ID)
+	if err != nil || balance != (domain.Balance{Current: 40, Held: 60}) {
+		t.Errorf("UserBalance = %+v, %v; want 40 current and 60 held", balance, err)
+	}
+}
+
+func testWithdrawalHolds(t *testing.T, b Backend) {
+	user := newUser(t, b, "holds@example.com")
+	if err := b.Repos.Users.AdjustBalance(ctx, user.ID, domain.Balance{Current: 100}); err != nil {
+		t.Fatalf("AdjustBalance: %v", err)
+	}
+	user.CurrentBalance = 100
+	now := time.Now().UTC().Truncate(time.Second)
+	expired, err := user.HoldWithdrawn(numbers[0], 30, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("HoldWithdrawn: %v", err)
+	}
+	active, err := user.HoldWithdrawn(numbers[1], 20, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("HoldWithdrawn: %v", err)
+	}
+	for _, withdraw := range []*domain.Withdraw{expired, active} {
+		if err := b.Repos.Withdrawals.Create(ctx, withdraw); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	holds, err := b.Repos.Withdrawals.ListExpiredHolds(ctx, now, 10)
+	if err != nil || len(holds) != 1 || holds[0].Number != numbers[0] {
+		t.Fatalf("ListExpiredHolds = %+v, %v; want only %s", holds, err, numbers[0])
+	}
+	if _, err := holds[0].Expire(now); err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if err := b.Repos.Withdrawals.Resolve(ctx, holds[0]); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	stale, _ := b.Repos.Withdrawals.GetByNumber(ctx, numbers[0])
+	stale.Status = domain.HELD
+	if _, err := stale.Cancel(now); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if err := b.Repos.Withdrawals.Resolve(ctx, stale); !errors.Is(err, domain.ErrWithdrawalNotHeld) {
+		t.Errorf("second Resolve error = %v, want ErrWithdrawalNotHeld", err)
+	}
+
+	stored, err := b.Repos.Withdrawals.GetByNumber(ctx, numbers[0])
+	if err != nil || stored.Status != domain.EXPIRED || stored.ResolvedAt == nil {
+		t.Errorf("GetByNumber = %+v, %v; want an expired withdrawal", stored, err)
+	}
+	stored, err = b.Repos.Withdrawals.GetByNumber(ctx, numbers[1])
+	if err != nil || stored.Status != domain.HELD || stored.ExpiresAt == nil || !stored.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("GetByNumber = %+v, %v; want a held withdrawal", stored, err)
+	}
+	if _, err := b.Repos.Withdrawals.GetByNumber(ctx, numbers[2]); !errors.Is(err, domain.ErrWithdrawalNotFound) {
+		t.Errorf("GetByNumber of an unknown number error = %v, want ErrWithdrawalNotFound", err)
+	}
+	if holds, err := b.Repos.Withdrawals.ListExpiredHolds(ctx, now, 10); err != nil || len(holds) != 0 {
+		t.Errorf("ListExpiredHolds after Resolve = %+v, %v; want none", holds, err)
+	}
+}
+
+func testPointLots(t *testing.T, b Backend) {
+	user := newUser(t, b, "lots@example.com")
+	now := time.Now().UTC().Truncate(time.Second)
+	old := domain.NewPointLot(user.ID, numbers[0], 50, now.AddDate(0, -2, 0), 1)
+	recent := domain.NewPointLot(user.ID, numbers[1], 70, now, 1)
+	for _, lot := range []*domain.PointLot{recent, old} {
+		if err := b.Repos.Lots.Add(ctx, lot); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	lots, err := b.Repos.Lots.Available(ctx, user.ID)
+	if err != nil || len(lots) != 2 || lots[0].ID != old.ID {
+		t.Fatalf("Available = %+v, %v; want the old lot first", lots, err)
+	}
+	if err := b.Repos.Lots.Take(ctx, domain.TakeFromLots(lots, numbers[2], 60)); err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	lots, _ = b.Repos.Lots.Available(ctx, user.ID)
+	if len(lots) != 1 || lots[0].ID != recent.ID || lots[0].Remaining != 60 {
+		t.Errorf("Available after Take = %+v; want 60 left in the recent lot", lots)
+	}
+	if err := b.Repos.Lots.Release(ctx, numbers[2]); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := b.Repos.Lots.Release(ctx, numbers[2]); err != nil {
+		t.Fatalf("second Release: %v", err)
+	}
+	lots, _ = b.Repos.Lots.Available(ctx, user.ID)
+	if len(lots) != 2 || lots[0].Remaining != 50 || lots[1].Remaining != 70 {
+		t.Errorf("Available after Release = %+v; want the lots restored once", lots)
+	}
+
+	upcoming, err := b.Repos.Lots.Upcoming(ctx, user.ID, now.AddDate(0, 0, 7))
+	if err != nil || len(upcoming) != 1 || upcoming[0].ID != old.ID {
+		t.Errorf("Upcoming = %+v, %v; want the old lot", upcoming, err)
+	}
+	expired, err := b.Repos.Lots.ListExpired(ctx, now, nil, 10)
+	if err != nil || len(expired) != 1 || expired[0].ID != old.ID {
+		t.Fatalf("ListExpired = %+v, %v; want the old lot", expired, err)
+	}
+	expiry, err := expired[0].Expire(now, 100)
+	if err != nil || expiry.Amount != 50 {
+		t.Fatalf("Expire = %+v, %v; want 50 points", expiry, err)
+	}
+	if err := b.Repos.Lots.Expire(ctx, expiry, 40); !errors.Is(err, domain.ErrPointLotChanged) {
+		t.Errorf("Expire with stale remaining error = %v, want ErrPointLotChanged", err)
+	}
+	if err := b.Repos.Lots.Expire(ctx, expiry, 50); err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if expired, err := b.Repos.Lots.ListExpired(ctx, now, nil, 10); err != nil || len(expired) != 0 {
+		t.Errorf("ListExpired after Expire = %+v, %v; want none", expired, err)
+	}
+}
+
+// testExpiredLotsAfter pages through expired lots, two of which expired at
+// the same time.
+func testExpiredLotsAfter(t *testing.T, b Backend) {
+	user := newUser(t, b, "cursor@example.com")
+	now := time.Now().UTC().Truncate(time.Second)
+	lots := []*domain.PointLot{
+		domain.NewPointLot(user.ID, numbers[0], 10, now.AddDate(0, -3, 0), 1),
+		domain.NewPointLot(user.ID, numbers[1], 20, now.AddDate(0, -2, 0), 1),
+		domain.NewPointLot(user.ID, numbers[2], 30, now.AddDate(0, -2, 0), 1),
+	}
+	for _, lot := range lots {
+		if err := b.Repos.Lots.Add(ctx, lot); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	first, err := b.Repos.Lots.ListExpired(ctx, now, nil, 2)
+	if err != nil || len(first) != 2 || first[0].ID != lots[0].ID || first[1].ID != lots[1].ID {
+		t.Fatalf("ListExpired = %+v, %v; want the first two lots", first, err)
+	}
+	rest, err := b.Repos.Lots.ListExpired(ctx, now, first[1], 2)
+	if err != nil || len(rest) != 1 || rest[0].ID != lots[2].ID {
+		t.Errorf("ListExpired after the second lot = %+v, %v; want the third lot", rest, err)
+	}
+}
+
+// testReleaseIntoExpiredLot cancels a hold after the lot it took points
+// from expired: the points put back expire on the next run, as a second
+// expiry of the same lot.
+func testReleaseIntoExpiredLot(t *testing.T, b Backend) {
+	user := newUser(t, b, "released@example.com")
+	now := time.Now()
+	lot := domain.NewPointLot(user.ID, numbers[0], 50, now.AddDate(0, -2, 0), 1)
+	if err := b.Repos.Lots.Add(ctx, lot); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	lots, _ := b.Repos.Lots.Available(ctx, user.ID)
+	if err := b.Repos.Lots.Take(ctx, domain.TakeFromLots(lots, numbers[1], 30)); err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+
+	expire := func(want int) {
+		t.Helper()
+		expired, err := b.Repos.Lots.ListExpired(ctx, now, nil, 10)
+		if err != nil || len(expired) != 1 || expired[0].Remaining != want {
+			t.Fatalf("ListExpired = %+v, %v; want the lot with %d points", expired, err, want)
+		}
+		expiry, err := expired[0].Expire(now, 100)
+		if err != nil {
+			t.Fatalf("Expire: %v", err)
+		}
+		if err := b.Repos.Lots.Expire(ctx, expiry, want); err != nil {
+			t.Fatalf("Lots.Expire: %v", err)
+		}
+	}
+	expire(20)
+	if err := b.Repos.Lots.Release(ctx, numbers[1]); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	expire(30)
+	if expired, err := b.Repos.Lots.ListExpired(ctx, now, nil, 10); err != nil || len(expired) != 0 {
+		t.Errorf("ListExpired after both expiries = %+v, %v; want none", expired, err)
+	}
+	if expired, err := b.Repos.Lots.Expired(ctx, user.ID); err != nil || expired != 50 {
+		t.Errorf("Expired = %d, %v; want 50", expired, err)
+	}
+}
+
+func testTransfers(t *testing.T, b Backend) {
+	alice := newUser(t, b, "alice@example.com")
+	bob := newUser(t, b, "bob@example.com")
+	carol := newUser(t, b, "carol@example.com")
+	start := time.Now().UTC().Add(-time.Second)
+	for _, transfer := range []*domain.Transfer{
+		{SenderID: alice.ID, RecipientID: bob.ID, SenderEmail: alice.Email, RecipientEmail: bob.Email, Sum: 10},
+		{SenderID: bob.ID, RecipientID: alice.ID, SenderEmail: bob.Email, RecipientEmail: alice.Email, Sum: 20},
+		{SenderID: alice.ID, RecipientID: carol.ID, SenderEmail: alice.Email, RecipientEmail: carol.Email, Sum: 30},
+	} {
+		if err := b.Repos.Transfers.Create(ctx, transfer); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	sent, err := b.Repos.Transfers.SentSince(ctx, alice.ID, start)
+	if err != nil || sent != (domain.TransferTotals{Sum: 40, Count: 2}) {
+		t.Errorf("SentSince = %+v, %v; want 40 in 2 transfers", sent, err)
+	}
+	sent, err = b.Repos.Transfers.SentSince(ctx, carol.ID, start)
+	if err != nil || sent != (domain.TransferTotals{}) {
+		t.Errorf("SentSince of a recipient only = %+v, %v; want nothing", sent, err)
+	}
+	sent, err = b.Repos.Transfers.SentSince(ctx, alice.ID, time.Now().Add(time.Hour))
+	if err != nil || sent != (domain.TransferTotals{}) {
+		t.Errorf("SentSince in the future = %+v, %v; want nothing", sent, err)
+	}
+
+	page, err := b.Repos.Transfers.List(ctx, alice.ID, domain.ListQuery{Limit: 2})
+	if err != nil || len(page.Items) != 2 || page.NextCursor == "" {
+		t.Fatalf("List = %+v, %v; want a full first page", page, err)
+	}
+	cursor, err := domain.DecodeCursor(page.NextCursor)
+	if err != nil {
+		t.Fatalf("DecodeCursor: %v", err)
+	}
+	page, err = b.Repos.Transfers.List(ctx, alice.ID, domain.ListQuery{Limit: 2, Cursor: cursor})
+	if err != nil || len(page.Items) != 1 || page.Items[0].Sum != 30 || page.NextCursor != "" {
+		t.Errorf("List second page = %+v, %v; want the transfer to carol", page, err)
+	}
+	page, err = b.Repos.Transfers.List(ctx, carol.ID, domain.ListQuery{Limit: 10})
+	if err != nil || len(page.Items) != 1 || page.Items[0].SenderEmail != alice.Email {
+		t.Errorf("List of the recipient = %+v, %v; want the transfer from alice", page, err)
+	}
+}
+
+func testReconciliation(t *testing.T, b Backend) {
+	alice := newUser(t, b, "ledger-alice@example.com")
+	bob := newUser(t, b, "ledger-bob@example.com")
+	for _, number := range numbers[:3] {
+		addOrder(t, b, alice, number)
+	}
+	addOrder(t, b, bob, numbers[3])
+	accural, more := 100, 150
+	processed := &domain.Order{Number: numbers[0], Status: domain.PROCESSED, Accural: &accural}
+	invalid := &domain.Order{Number: numbers[1], Status: domain.INVALID}
+	for _, order := range []*domain.Order{processed, invalid} {
+		if err := b.Repos.Orders.Complete(ctx, order); err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+	}
+
+	page, err := b.Repos.Orders.ListAll(ctx, domain.ListQuery{Limit: 3})
+	if err != nil || len(page.Items) != 3 || page.NextCursor == "" {
+		t.Fatalf("ListAll = %+v, %v; want a full first page", page, err)
+	}
+	last := page.Items[2]
+	page, err = b.Repos.Orders.ListAll(ctx, domain.ListQuery{Limit: 3, Cursor: &domain.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}})
+	if err != nil || len(page.Items) != 1 || page.Items[0].UserID != bob.ID {
+		t.Errorf("ListAll second page = %+v, %v; want the order of bob", page, err)
+	}
+
+	corrected := &domain.Order{Number: numbers[0], Status: domain.PROCESSED, Accural: &more}
+	stale := &domain.Order{Number: numbers[0], Status: domain.PROCESSED}
+	if err := b.Repos.Orders.Correct(ctx, stale, corrected); !errors.Is(err, domain.ErrOrderChanged) {
+		t.Errorf("Correct with a stale order error = %v, want ErrOrderChanged", err)
+	}
+	if err := b.Repos.Orders.Correct(ctx, processed, corrected); err != nil {
+		t.Fatalf("Correct: %v", err)
+	}
+	if err := b.Repos.Orders.Correct(ctx, processed, corrected); !errors.Is(err, domain.ErrOrderChanged) {
+		t.Errorf("second Correct error = %v, want ErrOrderChanged", err)
+	}
+	pending := &domain.Order{Number: numbers[2], Status: domain.REGISTERED}
+	if err := b.Repos.Orders.Correct(ctx, pending, corrected); !errors.Is(err, domain.ErrOrderChanged) {
+		t.Errorf("Correct of a pending order error = %v, want ErrOrderChanged", err)
+	}
+	if accrued, err := b.Repos.Orders.Accrued(ctx, alice.ID); err != nil || accrued != 150 {
+		t.Errorf("Accrued = %d, %v; want 150", accrued, err)
+	}
+	if accrued, err := b.Repos.Orders.Accrued(ctx, bob.ID); err != nil || accrued != 0 {
+		t.Errorf("Accrued without processed orders = %d, %v; want 0", accrued, err)
+	}
+
+	for _, transfer := range []*domain.Transfer{
+		{SenderID: alice.ID, RecipientID: bob.ID, SenderEmail: alice.Email, RecipientEmail: bob.Email, Sum: 40},
+		{SenderID: bob.ID, RecipientID: alice.ID, SenderEmail: bob.Email, RecipientEmail: alice.Email, Sum: 15},
+	} {
+		if err := b.Repos.Transfers.Create(ctx, transfer); err != nil {
+			t.Fatalf("Create transfer: %v", err)
+		}
+	}
+	if net, err := b.Repos.Transfers.Net(ctx, alice.ID); err != nil || net != -25 {
+		t.Errorf("Net of the sender = %d, %v; want -25", net, err)
+	}
+	if net, err := b.Repos.Transfers.Net(ctx, bob.ID); err != nil || net != 25 {
+		t.Errorf("Net of the recipient = %d, %v; want 25", net, err)
+	}
+
+	lot := domain.NewPointLot(alice.ID, numbers[0], 30, time.Now().AddDate(0, -2, 0), 1)
+	if err := b.Repos.Lots.Add(ctx, lot); err != nil {
+		t.Fatalf("Add lot: %v", err)
+	}
+	expiry, err := lot.Expire(time.Now(), 20)
+	if err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if err := b.Repos.Lots.Expire(ctx, expiry, 30); err != nil {
+		t.Fatalf("Lots.Expire: %v", err)
+	}
+	if expired, err := b.Repos.Lots.Expired(ctx, alice.ID); err != nil || expired != 20 {
+		t.Errorf("Expired = %d, %v; want 20", expired, err)
+	}
+
+	if err := b.Repos.Users.AdjustBalance(ctx, alice.ID, domain.Balance{Current: 70, Held: 10, Withdrawn: 5}); err != nil {
+		t.Fatalf("AdjustBalance: %v", err)
+	}
+	err = b.UoW.Do(ctx, func(repos ports.Repositories) error {
+		balance, err := repos.Users.LockBalance(ctx, alice.ID)
+		if err != nil || balance != (domain.Balance{Current: 70, Held: 10, Withdrawn: 5}) {
+			t.Errorf("LockBalance = %+v, %v", balance, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if _, err := b.Repos.Users.LockBalance(ctx, 404); !errors.Is(err, domain.ErrUserNotExist) {
+		t.Errorf("LockBalance of an unknown user error = %v, want ErrUserNotExist", err)
+	}
+}
@@ -0,0 +1,70 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type TransferRepositoryImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewTransferRepository(db *gorm.DB, logger *zap.Logger) *TransferRepositoryImpl {
+	err := db.AutoMigrate(domain.Transfer{})
+	if err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
+	return &TransferRepositoryImpl{db: db, logger: logger}
+}
+
+func (r *TransferRepositoryImpl) Create(ctx context.Context, transfer *domain.Transfer) error {
+	if err := r.db.WithContext(ctx).Create(transfer).Error; err != nil {
+		r.logger.Error("failed to create transfer", zap.Uint("sender_id", transfer.SenderID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *TransferRepositoryImpl) SentSince(ctx context.Context, userID uint, since time.Time) (domain.TransferTotals, error) {
+	var totals domain.TransferTotals
+	err := r.db.WithContext(ctx).Model(&domain.Transfer{}).
+		Select("COALESCE(SUM(sum), 0) AS sum, COUNT(*) AS count").
+		Where("sender_id = ? AND created_at >= ?", userID, since.UTC()).
+		Scan(&totals).Error
+	if err != nil {
+		r.logger.Error("failed to sum transfers", zap.Uint("sender_id", userID), zap.Error(err))
+		return domain.TransferTotals{}, err
+	}
+	return totals, nil
+}
+
+func (r *TransferRepositoryImpl) List(ctx context.Context, userID uint, query domain.ListQuery) (*domain.Page[*domain.Transfer], error) {
+	var transfers []*domain.Transfer
+	stmt := r.db.WithContext(ctx).Model(&domain.Transfer{}).Where("(sender_id = ? OR recipient_id = ?)", userID, userID)
+	err := keysetPage(stmt, "transfers", query).Find(&transfers).Error
+	if err != nil {
+		r.logger.Error("failed to list transfers", zap.Uint("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	return newPage(transfers, query.Limit, func(t *domain.Transfer) domain.Cursor {
+		return domain.Cursor{CreatedAt: t.CreatedAt, ID: t.ID}
+	}), nil
+}
+
+func (r *TransferRepositoryImpl) Net(ctx context.Context, userID uint) (int, error) {
+	var net int
+	err := r.db.WithContext(ctx).Model(&domain.Transfer{}).
+		Select("COALESCE(SUM(CASE WHEN recipient_id = ? THEN sum ELSE -sum END), 0)", userID).
+		Where("sender_id = ? OR recipient_id = ?", userID, userID).
+		Scan(&net).Error
+	if err != nil {
+		r.logger.Error("failed to sum transfers", zap.Uint("user_id", userID), zap.Error(err))
+		return 0, err
+	}
+	return net, nil
+}
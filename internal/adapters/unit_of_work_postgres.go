@@ -0,0 +1,44 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type UnitOfWorkImpl struct {
+	db      *gorm.DB
+	timeout time.Duration
+	logger  *zap.Logger
+}
+
+// A transaction is rolled back once it has been open for timeout; zero
+// leaves it to the context of the caller.
+func NewUnitOfWork(db *gorm.DB, timeout time.Duration, logger *zap.Logger) *UnitOfWorkImpl {
+	return &UnitOfWorkImpl{db: db, timeout: timeout, logger: logger}
+}
+
+// Do marks the database failures worth retrying as transient, see
+// classifyDBError.
+func (u *UnitOfWorkImpl) Do(ctx context.Context, fn func(repos ports.Repositories) error) error {
+	if u.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.timeout)
+		defer cancel()
+	}
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(ports.Repositories{
+			Users:       &UserStorageImpl{db: tx, logger: u.logger},
+			Orders:      &OrderRepositoryImpl{db: tx, logger: u.logger},
+			Withdrawals: &WithdrawalRepositoryImpl{db: tx, logger: u.logger},
+			Outbox:      &OutboxImpl{db: tx, logger: u.logger},
+			History:     &OrderHistoryImpl{db: tx, logger: u.logger},
+			Lots:        &PointLotsImpl{db: tx, logger: u.logger},
+			Transfers:   &TransferRepositoryImpl{db: tx, logger: u.logger},
+		})
+	})
+	return classifyDBError(err)
+}
@@ -1,13 +1,21 @@
 package adapters
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/OrtemRepos/go_store/internal/domain"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrEmailCollision is returned by LowercaseEmails when accounts have emails
+// that differ only in case. They must be merged or renamed by hand first.
+var ErrEmailCollision = errors.New("accounts have emails that differ only in case, merge or rename them")
+
 type UserStorageImpl struct {
 	db     *gorm.DB
 	logger *zap.Logger
@@ -18,12 +26,51 @@ func NewUserStorage(db *gorm.DB, logger *zap.Logger) *UserStorageImpl {
 	if err != nil {
 		;logger.Fatal("migration error", zap.Error(err))
 	}
+	if err := LowercaseEmails(db); err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
 	return &UserStorageImpl{db: db, logger: logger}
 }
 
-func (s *UserStorageImpl) GetByID(id uint) (*domain.User, error) {
+// LowercaseEmails brings the emails stored before they were normalized to
+// lower case, so that GetByEmail can use the unique index. If emails would
+// collide nothing is changed and the error lists the IDs of the accounts.
+func LowercaseEmails(db *gorm.DB) error {
+	var twins []struct {
+		ID    uint
+		Email string
+	}
+	collisions := db.Model(&domain.User{}).
+		Select("lower(email)").
+		Group("lower(email)").
+		Having("count(*) > 1")
+	err := db.Model(&domain.User{}).
+		Select("id, lower(email) AS email").
+		Where("lower(email) IN (?)", collisions).
+		Order("lower(email), id").
+		Scan(&twins).Error
+	if err != nil {
+		return err
+	}
+	if len(twins) > 0 {
+		var groups []string
+		for i, twin := range twins {
+			if i == 0 || twins[i-1].Email != twin.Email {
+				groups = append(groups, fmt.Sprintf("ids %d", twin.ID))
+			} else {
+				groups[len(groups)-1] += fmt.Sprintf(", %d", twin.ID)
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrEmailCollision, strings.Join(groups, "; "))
+	}
+	return db.Model(&domain.User{}).
+		Where("email <> lower(email)").
+		Update("email", gorm.Expr("lower(email)")).Error
+}
+
+func (s *UserStorageImpl) GetByID(ctx context.Context, id uint) (*domain.User, error) {
 	var user domain.User
-	result := s.db.Model(&domain.User{}).
+	result := s.db.WithContext(ctx).Model(&domain.User{}).
 		Preload("Orders", func(db *gorm.DB) *gorm.DB { return db.Order("orders.created_at ASC") }).
 		Preload("Withdraws", func(db *gorm.DB) *gorm.DB { return db.Order("withdraws.created_at ASC")}).
 		Where("id = ?", id).
@@ -37,9 +84,9 @@ func (s *UserStorageImpl) GetByID(id uint) (*domain.User, error) {
 	return &user, nil
 }
 
-func (s *UserStorageImpl) GetByEmail(email string) (*domain.User, error) {
+func (s *UserStorageImpl) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var user domain.User
-	result := s.db.Model(&user).Where("email = ?", email).First(&user)
+	result := s.db.WithContext(ctx).Model(&user).Where("email = ?", strings.ToLower(email)).First(&user)
 	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 		return nil, errors.Join(domain.ErrUserNotExist, result.Error)
 	} else if result.Error != nil {
@@ -49,32 +96,109 @@ func (s *UserStorageImpl) GetByEmail(email string) (*domain.User, error) {
 	return &user, nil
 }
 
-func (s *UserStorageImpl) AddAccural(id uint, accural int) error {
-	var err error
-	user := domain.User{ID: id}
-	stmt := s.db.Model(&user).Update("current_balance", gorm.Expr("current_balance + ?", accural))
+// AddAccural adds accural to the current balance in one statement. A
+// negative accural is a withdrawal, so it is added to withdrawn as well.
+func (s *UserStorageImpl) AddAccural(ctx context.Context, id uint, accural int) error {
+	updates := map[string]interface{}{
+		"current_balance": gorm.Expr("current_balance + ?", accural),
+	}
 	if accural < 0 {
-		err = stmt.Update("withdrawn", gorm.Expr("withdrawn - ?", accural)).Error
+		updates["withdrawn"] = gorm.Expr("withdrawn - ?", accural)
 	}
-	if err != nil {
-		s.logger.Warn("error when update accural", zap.Error(err))
+	result := s.db.WithContext(ctx).Model(&domain.User{ID: id}).Updates(updates)
+	if result.Error != nil {
+		s.logger.Error("failed to add accural", zap.Uint("id", id), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrUserNotExist
 	}
 	return nil
 }
 
-func (s *UserStorageImpl) UserBalance(id uint) (int, int, error) {
+func (s *UserStorageImpl) UserBalance(ctx context.Context, id uint) (domain.Balance, error) {
 	user := domain.User{ID: id}
-	err := s.db.Model(&user).Select("current_balance", "withdrawn").First(&user).Error
-	if err != nil {
+	err := s.db.WithContext(ctx).Model(&user).Select("current_balance", "held", "withdrawn").First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.Balance{}, errors.Join(domain.ErrUserNotExist, err)
+	} else if err != nil {
 		s.logger.Warn("balance error", zap.Error(err))
-		return 0, 0, err
+		return domain.Balance{}, err
+	}
+	return user.Balance(), nil
+}
+
+func (s *UserStorageImpl) LockBalance(ctx context.Context, id uint) (domain.Balance, error) {
+	user := domain.User{ID: id}
+	err := s.db.WithContext(ctx).Model(&user).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("current_balance", "held", "withdrawn").
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.Balance{}, errors.Join(domain.ErrUserNotExist, err)
+	} else if err != nil {
+		s.logger.Warn("balance lock error", zap.Error(err))
+		return domain.Balance{}, err
 	}
-	return user.CurrentBalance, user.Withdrawn, nil
+	return user.Balance(), nil
 }
 
-func (s *UserStorageImpl) Save(user *domain.User) error {
-	result := s.db.Save(user)
+func (s *UserStorageImpl) AdjustBalance(ctx context.Context, id uint, delta domain.Balance) error {
+	result := s.db.WithContext(ctx).Model(&domain.User{ID: id}).
+		Where("current_balance + ? >= 0 AND held + ? >= 0", delta.Current, delta.Held).
+		Updates(map[string]interface{}{
+			"current_balance": gorm.Expr("current_balance + ?", delta.Current),
+			"held":            gorm.Expr("held + ?", delta.Held),
+			"withdrawn":       gorm.Expr("withdrawn + ?", delta.Withdrawn),
+		})
 	if result.Error != nil {
+		s.logger.Error("failed to adjust balance", zap.Uint("id", id), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return domain.ErrUserNotExist
+	}
+	return domain.ErrNotEnoughPoints
+}
+
+func (s *UserStorageImpl) SessionVersion(ctx context.Context, id uint) (int, error) {
+	user := domain.User{ID: id}
+	err := s.db.WithContext(ctx).Model(&user).Select("session_version").First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, errors.Join(domain.ErrUserNotExist, err)
+	} else if err != nil {
+		s.logger.Warn("session version error", zap.Error(err))
+		return 0, err
+	}
+	return user.SessionVersion, nil
+}
+
+// UpdatePassword writes only the password hash and the session version, so
+// it can't overwrite a balance changed concurrently.
+func (s *UserStorageImpl) UpdatePassword(ctx context.Context, user *domain.User) error {
+	err := s.db.WithContext(ctx).Model(&domain.User{ID: user.ID}).Updates(map[string]interface{}{
+		"password":        user.Password,
+		"session_version": user.SessionVersion,
+	}).Error
+	if err != nil {
+		s.logger.Error("failed to update password", zap.Uint("id", user.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *UserStorageImpl) Save(ctx context.Context, user *domain.User) error {
+	result := s.db.WithContext(ctx).Save(user)
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+		return errors.Join(domain.ErrDuplicateKey, result.Error)
+	} else if result.Error != nil {
 		s.logger.Error("failed to save user", zap.Error(result.Error))
 		return result.Error
 	}
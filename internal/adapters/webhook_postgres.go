@@ -0,0 +1,98 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type WebhookStorageImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewWebhookStorage(db *gorm.DB, logger *zap.Logger) *WebhookStorageImpl {
+	err := db.AutoMigrate(domain.Webhook{}, domain.WebhookDelivery{})
+	if err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
+	return &WebhookStorageImpl{db: db, logger: logger}
+}
+
+func (s *WebhookStorageImpl) Save(ctx context.Context, webhook *domain.Webhook) error {
+	if err := s.db.WithContext(ctx).Create(webhook).Error; err != nil {
+		s.logger.Error("failed to save webhook", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *WebhookStorageImpl) Get(ctx context.Context, userID, id uint) (*domain.Webhook, error) {
+	var webhook domain.Webhook
+	err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&webhook).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.Join(domain.ErrWebhookNotFound, err)
+	} else if err != nil {
+		s.logger.Error("failed to get webhook", zap.Uint("id", id), zap.Error(err))
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (s *WebhookStorageImpl) ListByUser(ctx context.Context, userID uint) ([]*domain.Webhook, error) {
+	var webhooks []*domain.Webhook
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id ASC").Find(&webhooks).Error
+	if err != nil {
+		s.logger.Error("failed to list webhooks", zap.Uint("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookStorageImpl) Delete(ctx context.Context, userID, id uint) error {
+	result := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&domain.Webhook{})
+	if result.Error != nil {
+		s.logger.Error("failed to delete webhook", zap.Uint("id", id), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (s *WebhookStorageImpl) SaveDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	if err := s.db.WithContext(ctx).Create(delivery).Error; err != nil {
+		s.logger.Error("failed to save webhook delivery", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *WebhookStorageImpl) GetDelivery(ctx context.Context, userID, id uint) (*domain.WebhookDelivery, error) {
+	var delivery domain.WebhookDelivery
+	err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&delivery).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.Join(domain.ErrWebhookDeliveryNotFound, err)
+	} else if err != nil {
+		s.logger.Error("failed to get webhook delivery", zap.Uint("id", id), zap.Error(err))
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (s *WebhookStorageImpl) ListDeliveries(ctx context.Context, userID, webhookID uint, limit int) ([]*domain.WebhookDelivery, error) {
+	var deliveries []*domain.WebhookDelivery
+	err := s.db.WithContext(ctx).Where("webhook_id = ? AND user_id = ?", webhookID, userID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+	if err != nil {
+		s.logger.Error("failed to list webhook deliveries", zap.Uint("webhook_id", webhookID), zap.Error(err))
+		return nil, err
+	}
+	return deliveries, nil
+}
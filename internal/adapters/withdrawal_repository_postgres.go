@@ -0,0 +1,95 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type WithdrawalRepositoryImpl struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewWithdrawalRepository(db *gorm.DB, logger *zap.Logger) *WithdrawalRepositoryImpl {
+	err := db.AutoMigrate(domain.Withdraw{})
+	if err != nil {
+		logger.Fatal("migration error", zap.Error(err))
+	}
+	return &WithdrawalRepositoryImpl{db: db, logger: logger}
+}
+
+func (r *WithdrawalRepositoryImpl) Create(ctx context.Context, withdraw *domain.Withdraw) error {
+	err := r.db.WithContext(ctx).Create(withdraw).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errors.Join(domain.ErrOrderConflict, domain.ErrDuplicateKey, err)
+	} else if err != nil {
+		r.logger.Error("failed to create withdrawal", zap.String("number", withdraw.Number), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *WithdrawalRepositoryImpl) GetByNumber(ctx context.Context, number string) (*domain.Withdraw, error) {
+	var withdraw domain.Withdraw
+	err := r.db.WithContext(ctx).Where("number = ?", number).First(&withdraw).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.Join(domain.ErrWithdrawalNotFound, err)
+	} else if err != nil {
+		r.logger.Error("failed to get withdrawal", zap.String("number", number), zap.Error(err))
+		return nil, err
+	}
+	return &withdraw, nil
+}
+
+func (r *WithdrawalRepositoryImpl) Resolve(ctx context.Context, withdraw *domain.Withdraw) error {
+	var resolvedAt *time.Time
+	if withdraw.ResolvedAt != nil {
+		at := withdraw.ResolvedAt.UTC()
+		resolvedAt = &at
+	}
+	result := r.db.WithContext(ctx).Model(&domain.Withdraw{}).
+		Where("id = ? AND status = ?", withdraw.ID, domain.HELD).
+		Updates(map[string]interface{}{"status": withdraw.Status, "resolved_at": resolvedAt})
+	if result.Error != nil {
+		r.logger.Error("failed to resolve withdrawal", zap.String("number", withdraw.Number), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrWithdrawalNotHeld
+	}
+	return nil
+}
+
+// ListExpiredHolds returns the oldest holds expired by now.
+func (r *WithdrawalRepositoryImpl) ListExpiredHolds(ctx context.Context, now time.Time, limit int) ([]*domain.Withdraw, error) {
+	var withdraws []*domain.Withdraw
+	err := r.db.WithContext(ctx).Where("status = ? AND expires_at <= ?", domain.HELD, now.UTC()).
+		Order("expires_at ASC, id ASC").
+		Limit(limit).
+		Find(&withdraws).Error
+	if err != nil {
+		r.logger.Error("failed to list expired holds", zap.Error(err))
+		return nil, err
+	}
+	return withdraws, nil
+}
+
+func (r *WithdrawalRepositoryImpl) List(ctx context.Context, userID uint, query domain.ListQuery) (*domain.Page[*domain.Withdraw], error) {
+	var withdraws []*domain.Withdraw
+	// withdraws.user_id is a text column.
+	stmt := r.db.WithContext(ctx).Model(&domain.Withdraw{}).Where("user_id = ?", strconv.FormatUint(uint64(userID), 10))
+	err := keysetPage(stmt, "withdraws", query).Find(&withdraws).Error
+	if err != nil {
+		r.logger.Error("failed to list withdrawals", zap.Uint("user_id", userID), zap.Error(err))
+		return nil, err
+	}
+	return newPage(withdraws, query.Limit, func(w *domain.Withdraw) domain.Cursor {
+		return domain.Cursor{CreatedAt: w.CreatedAt, ID: w.ID}
+	}), nil
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/OrtemRepos/go_store/configs"
+	"gopkg.in/yaml.v3"
+)
+
+// runConfig is the config command. "config print" prints the effective
+// configuration, the file with the environment and the flags applied, as
+// YAML with the secrets redacted:
+//
+//	store config print -c ./configs/config.yml
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintf(os.Stderr, "Usage of %s config print [config flags]\n", os.Args[0])
+		return fmt.Errorf("unknown config command")
+	}
+	cfg, err := configs.GetConfig(args[1:])
+	if err != nil {
+		return fmt.Errorf("can't read the config: %w", err)
+	}
+	out, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		return fmt.Errorf("can't encode the config: %w", err)
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/OrtemRepos/go_store/configs"
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/logging"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"github.com/OrtemRepos/go_store/internal/service/order-service"
+	"github.com/OrtemRepos/go_store/internal/tracing"
+	"github.com/OrtemRepos/go_store/internal/worker-pool"
+	"go.uber.org/zap"
+)
+
+// runReconcile is the reconcile command: it compares the orders created in
+// a date range with the accrual system once and prints the report as JSON.
+// The arguments after "--" are the usual configuration flags:
+//
+//	store reconcile -from 2024-05-01 -to 2024-06-01 -fix -- -c ./configs/config.yml
+func runReconcile(args []string) error {
+	f := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	from := f.String("from", "", "Start of the range, RFC 3339 or YYYY-MM-DD; the configured window before -to by default")
+	to := f.String("to", "", "End of the range, exclusive, RFC 3339 or YYYY-MM-DD; now by default")
+	fix := f.Bool("fix", false, "Credit the points users are found to be missing")
+	output := f.String("o", "", "File the report is written to, stdout if empty")
+	f.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s reconcile [flags] [-- config flags]:\n", os.Args[0])
+		f.PrintDefaults()
+	}
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := configs.GetConfig(f.Args())
+	if err != nil {
+		return fmt.Errorf("can't read the config: %w", err)
+	}
+	logger, err := logging.New(cfg)
+	if err != nil {
+		return fmt.Errorf("can't create the logger: %w", err)
+	}
+	defer func() { _ = logger.Sync() }()
+	end := time.Now()
+	if *to != "" {
+		if end, err = parseReconcileTime(*to); err != nil {
+			return err
+		}
+	}
+	start := end.Add(-time.Duration(cfg.Reconciliation.Window) * time.Second)
+	if *from != "" {
+		if start, err = parseReconcileTime(*from); err != nil {
+			return err
+		}
+	}
+	if end.Before(start) {
+		return fmt.Errorf("-to is before -from")
+	}
+
+	shutdownTracing, err := tracing.Setup(cfg.Tracing.Exporter, cfg.Tracing.Path, cfg.Tracing.ServiceName)
+	if err != nil {
+		return fmt.Errorf("can't set up tracing: %w", err)
+	}
+	defer func() { _ = shutdownTracing(context.Background()) }()
+
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("can't open the storage: %w", err)
+	}
+	// The pool is only needed to create the order service; the command
+	// reconciles in the foreground.
+	wp := worker.NewWorkerPool(
+		"ReconcileWP",
+		1, 1, cfg.Worker.ErrMaximumAmount,
+		worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		logger,
+	)
+	orderService, err := orderservice.NewOrderService(
+		logger, wp, store.orders, store.uow, nil,
+		cfg.Server.AccuralSystemAddress,
+		time.Duration(cfg.Timeouts.Accrual)*time.Second,
+		cfg.Accrual.MaxRetries, cfg.Accrual.RetryDelay, cfg.Points.ValidMonths,
+		nil, orderservice.RulesOff,
+	)
+	if err != nil {
+		return fmt.Errorf("can't create the order service: %w", err)
+	}
+	reconciler, err := newReconciler(cfg, logger, orderService, nil, *fix)
+	if err != nil {
+		return fmt.Errorf("can't create the reconciler: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, reconcileErr := reconciler.Reconcile(ctx, start, end)
+	if reconcileErr != nil {
+		logger.Error("reconciliation stopped early", zap.Error(reconcileErr))
+	}
+	if err := printReport(report, *output); err != nil {
+		return err
+	}
+	logger.Info("reconciliation finished",
+		zap.Int("orders", report.Orders),
+		zap.Int("users", report.Users),
+		zap.Int("discrepancies", len(report.Discrepancies)),
+		zap.Int("unresolved", report.Unresolved()),
+	)
+	return reconcileErr
+}
+
+func printReport(report *domain.ReconciliationReport, path string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		_, err = fmt.Fprintln(os.Stdout, string(data))
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func newReconciler(cfg *configs.Config, logger *zap.Logger, orderService *orderservice.OrderService, listeners []ports.BalanceListener, fix bool) (*orderservice.Reconciler, error) {
+	return orderservice.NewReconciler(
+		logger, orderService, listeners,
+		cfg.Reconciliation.BatchSize, fix, cfg.Reconciliation.ReportDir,
+		time.Duration(cfg.Reconciliation.Interval)*time.Second,
+		time.Duration(cfg.Reconciliation.Window)*time.Second,
+		time.Duration(cfg.Reconciliation.MinAge)*time.Second,
+	)
+}
+
+func parseReconcileTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339 or YYYY-MM-DD", s)
+	}
+	return t, nil
+}
@@ -1,85 +1,231 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/OrtemRepos/go_store/configs"
 	"github.com/OrtemRepos/go_store/internal/adapters"
+	"github.com/OrtemRepos/go_store/internal/auth"
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/logging"
+	"github.com/OrtemRepos/go_store/internal/ports"
 	"github.com/OrtemRepos/go_store/internal/service/order-service"
+	"github.com/OrtemRepos/go_store/internal/service/order-stream"
+	"github.com/OrtemRepos/go_store/internal/service/outbox-relay"
+	"github.com/OrtemRepos/go_store/internal/service/points-expiry"
+	"github.com/OrtemRepos/go_store/internal/service/transfer-service"
+	"github.com/OrtemRepos/go_store/internal/service/webhook-service"
+	"github.com/OrtemRepos/go_store/internal/service/withdrawal-service"
+	"github.com/OrtemRepos/go_store/internal/tracing"
 	"github.com/OrtemRepos/go_store/internal/worker-pool"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
-
-
 func Run() error {
-	logger, err := zap.NewDevelopment()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "reconcile":
+			return runReconcile(os.Args[2:])
+		case "config":
+			return runConfig(os.Args[2:])
+		}
+	}
+	cfg, err := configs.GetConfig(os.Args[1:])
 	if err != nil {
-		panic(fmt.Errorf("cant't create logger: %w", err))
+		return fmt.Errorf("can't read the config: %w", err)
+	}
+	logger, err := logging.New(cfg)
+	if err != nil {
+		return fmt.Errorf("can't create the logger: %w", err)
 	}
 	defer func() { _ = logger.Sync() }()
-	cfg, err := configs.GetConfig(os.Args[1:])
+	shutdownTracing, err := tracing.Setup(cfg.Tracing.Exporter, cfg.Tracing.Path, cfg.Tracing.ServiceName)
 	if err != nil {
-		logger.Fatal("can't read the config", zap.Error(err))
+		logger.Fatal("can't set up tracing", zap.Error(err))
 		return err
 	}
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		cfg.Database.Host, cfg.Database.User, cfg.Database.Password,
-		cfg.Database.Dbname, cfg.Database.Port,
-	)
-	db, err := gorm.Open(
-		postgres.Open(dsn),
-		&gorm.Config{
-			PrepareStmt: true,
-			TranslateError: true,
-		},
+	defer func() { _ = shutdownTracing(context.Background()) }()
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		logger.Fatal("can't open the storage", zap.Error(err))
+		return err
+	}
+	jwt := adapters.NewProviderJWT(cfg, logger)
+	loginLimiter, err := auth.NewLoginLimiter(
+		cfg.Auth.MaxLoginAttempts, cfg.Auth.MaxLoginAttemptsPerIP,
+		time.Duration(cfg.Auth.LockoutBase)*time.Second,
+		time.Duration(cfg.Auth.LockoutMax)*time.Second,
 	)
 	if err != nil {
-		logger.Error("error while opening the database", zap.Error(err))
+		logger.Fatal("can't create the login limiter", zap.Error(err))
+		return err
 	}
-	userStorage := adapters.NewUserStorage(db, logger)
+	pwdPolicy, err := auth.NewPasswordPolicy(
+		cfg.Auth.PasswordMinLength, cfg.Auth.PasswordMaxLength,
+		cfg.Auth.BreachedPasswordsPath,
+	)
 	if err != nil {
-		logger.Fatal("can't create userStorage", zap.String("dsn", dsn), zap.Error(err))
+		logger.Fatal("can't create the password policy", zap.Error(err))
 		return err
 	}
-	jwt := adapters.NewProviderJWT(cfg, logger)
 
-	router := gin.Default()
+	hasher, err := adapters.NewPasswordHasher(cfg)
+	if err != nil {
+		logger.Fatal("can't create the password hasher", zap.Error(err))
+		return err
+	}
+	var notifier ports.Notifier
+	switch cfg.Notifier.Type {
+	case "file":
+		notifier = adapters.NewFileNotifier(cfg.Notifier.Path)
+	default:
+		notifier = adapters.NewLogNotifier(logger)
+	}
 
-	const (
-		workerCount = 5
-		bufferSize = 100
-		errMaximumAmount = 100
-		maxRetries = 5
-		retryDelay = 1000
+	var publisher ports.EventPublisher
+	switch cfg.Outbox.Publisher {
+	case "webhook":
+		publisher, err = adapters.NewWebhookEventPublisher(
+			cfg.Outbox.WebhookURL, time.Duration(cfg.Outbox.WebhookTimeout)*time.Second,
+		)
+		if err != nil {
+			logger.Fatal("can't create the event publisher", zap.Error(err))
+			return err
+		}
+	default:
+		publisher = adapters.NewFileEventPublisher(cfg.Outbox.Path)
+	}
+	relay, err := outboxrelay.NewRelay(
+		logger, store.outbox, publisher,
+		time.Duration(cfg.Outbox.PollInterval)*time.Second, cfg.Outbox.BatchSize,
+		cfg.Outbox.MaxAttempts, time.Duration(cfg.Outbox.RetryDelay)*time.Second,
+		time.Duration(cfg.Outbox.GapTimeout)*time.Second,
 	)
+	if err != nil {
+		logger.Fatal("can't create the outbox relay", zap.Error(err))
+		return err
+	}
+	go relay.Run(context.Background())
+
+	if cfg.Log.Level != "debug" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	router := gin.New()
+	router.Use(gin.Recovery())
+
 	poolMetrics := worker.NewPoolMetrics()
 
 	wp := worker.NewWorkerPool(
 		"OrderWP",
-		workerCount, bufferSize, errMaximumAmount,
+		cfg.Worker.WorkersCount, cfg.Worker.BufferSize, cfg.Worker.ErrMaximumAmount,
 		poolMetrics, worker.NewWorkerMetrics,
 		logger,
 	)
 
+	webhookService, err := webhookservice.NewWebhookService(
+		logger, wp, store.webhooks,
+		time.Duration(cfg.Webhooks.Timeout)*time.Second,
+		cfg.Webhooks.MaxAttempts,
+		time.Duration(cfg.Webhooks.RetryDelay)*time.Second,
+	)
+	if err != nil {
+		logger.Fatal("can't create the webhook service", zap.Error(err))
+		return err
+	}
+
+	orderStream, err := orderstream.NewBroker(
+		logger, store.users, cfg.Stream.HistorySize,
+		time.Duration(cfg.Stream.Retention)*time.Second,
+	)
+	if err != nil {
+		logger.Fatal("can't create the order stream", zap.Error(err))
+		return err
+	}
+	go orderStream.Run(context.Background())
+
+	withdrawalService, err := withdrawalservice.NewWithdrawalService(
+		logger, wp, store.uow,
+		[]ports.BalanceListener{orderStream},
+		time.Duration(cfg.Withdrawals.HoldTTL)*time.Second,
+		time.Duration(cfg.Withdrawals.ExpiryInterval)*time.Second,
+		cfg.Withdrawals.ExpiryBatchSize,
+	)
+	if err != nil {
+		logger.Fatal("can't create the withdrawal service", zap.Error(err))
+		return err
+	}
+	go withdrawalService.Run(context.Background())
+
+	transferService, err := transferservice.NewTransferService(
+		logger, store.uow,
+		[]ports.BalanceListener{orderStream},
+		domain.TransferLimits{DailySum: cfg.Transfers.DailySum, DailyCount: cfg.Transfers.DailyCount},
+	)
+	if err != nil {
+		logger.Fatal("can't create the transfer service", zap.Error(err))
+		return err
+	}
+
+	pointsExpiry, err := pointsexpiry.NewExpiryService(
+		logger, wp, store.uow,
+		[]ports.BalanceListener{orderStream},
+		time.Duration(cfg.Points.ExpiryInterval)*time.Second,
+		cfg.Points.ExpiryBatchSize,
+	)
+	if err != nil {
+		logger.Fatal("can't create the points expiry service", zap.Error(err))
+		return err
+	}
+	go pointsExpiry.Run(context.Background())
+
+	var accrualRules ports.AccrualSystem
+	rulesMode := orderservice.RulesMode(cfg.AccrualRules.Mode)
+	if rulesMode != orderservice.RulesOff {
+		rules, err := adapters.NewAccrualRules(
+			cfg.AccrualRules.Path, time.Duration(cfg.AccrualRules.ReloadInterval)*time.Second, logger,
+		)
+		if err != nil {
+			logger.Fatal("can't load the accrual rules", zap.Error(err))
+			return err
+		}
+		go rules.Watch(context.Background())
+		accrualRules = rules
+	}
+
 	orderService, err := orderservice.NewOrderService(
-		db, logger, wp, userStorage, cfg.Server.AccuralSystemAddress,
-		maxRetries, retryDelay,
+		logger, wp, store.orders, store.uow,
+		[]ports.OrderStatusListener{webhookService, orderStream},
+		cfg.Server.AccuralSystemAddress,
+		time.Duration(cfg.Timeouts.Accrual)*time.Second,
+		cfg.Accrual.MaxRetries, cfg.Accrual.RetryDelay, cfg.Points.ValidMonths,
+		accrualRules, rulesMode,
 	)
 	if err != nil {
-		logger.Fatal("ошмбка при создании OrderService", zap.Error(err))
+		logger.Fatal("can't create the order service", zap.Error(err))
+		return err
+	}
+
+	if cfg.Reconciliation.Enabled {
+		reconciler, err := newReconciler(cfg, logger, orderService, []ports.BalanceListener{orderStream}, cfg.Reconciliation.Fix)
+		if err != nil {
+			logger.Fatal("can't create the reconciler", zap.Error(err))
+			return err
+		}
+		go reconciler.Run(context.Background())
 	}
 
 	restAPI := adapters.NewRestAPI(
-		cfg, logger, jwt, userStorage, router,
-		orderService,
+		cfg, logger, jwt, store.users, store.orders, store.withdrawals, store.uow, router,
+		orderService, loginLimiter, store.loginAudit, pwdPolicy,
+		store.resets, notifier, hasher, store.apiKeys, store.mfa,
+		store.webhooks, webhookService, orderStream, withdrawalService,
+		transferService,
 	)
 
 	restAPI.Serve()
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/OrtemRepos/go_store/configs"
+	"github.com/OrtemRepos/go_store/internal/adapters"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// storage holds the adapters of every storage port of the selected backend.
+type storage struct {
+	users       ports.UserStorage
+	orders      ports.OrderRepository
+	withdrawals ports.WithdrawalRepository
+	uow         ports.UnitOfWork
+	outbox      ports.Outbox
+	history     ports.OrderHistory
+	lots        ports.PointLots
+	transfers   ports.TransferRepository
+	loginAudit  ports.LoginAudit
+	resets      ports.PasswordResetStorage
+	apiKeys     ports.APIKeyStorage
+	mfa         ports.MFAStorage
+	webhooks    ports.WebhookStorage
+}
+
+func openStorage(cfg *configs.Config, logger *zap.Logger) (*storage, error) {
+	if cfg.Repository.InMemory {
+		return openMemoryStorage(cfg, logger)
+	}
+	switch cfg.Database.Driver {
+	case "postgres":
+		return openPostgresStorage(cfg, logger)
+	case "sqlite":
+		return openSQLiteStorage(cfg, logger)
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %q", cfg.Database.Driver)
+	}
+}
+
+func openMemoryStorage(cfg *configs.Config, logger *zap.Logger) (*storage, error) {
+	store, err := adapters.NewMemoryStore(cfg.Repository.SavePath, logger)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("using the in-memory storage", zap.String("savePath", cfg.Repository.SavePath))
+	return &storage{
+		users:       store.Users(),
+		orders:      store.Orders(),
+		withdrawals: store.Withdrawals(),
+		uow:         store.UnitOfWork(),
+		outbox:      store.Outbox(),
+		history:     store.History(),
+		lots:        store.Lots(),
+		transfers:   store.Transfers(),
+		loginAudit:  store.LoginAudit(),
+		resets:      store.PasswordResets(),
+		apiKeys:     store.APIKeys(),
+		mfa:         store.MFA(),
+		webhooks:    store.Webhooks(),
+	}, nil
+}
+
+func openPostgresStorage(cfg *configs.Config, logger *zap.Logger) (*storage, error) {
+	dsn := fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+		cfg.Database.Host, cfg.Database.User, cfg.Database.Password,
+		cfg.Database.Dbname, cfg.Database.Port,
+	)
+	db, err := gorm.Open(
+		postgres.Open(dsn),
+		&gorm.Config{
+			PrepareStmt:    true,
+			TranslateError: true,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening the database: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.Database.ConnMaxLifetime) * time.Second)
+	sqlDB.SetConnMaxIdleTime(time.Duration(cfg.Database.ConnMaxIdleTime) * time.Second)
+	return newGormStorage(cfg, db, logger)
+}
+
+func openSQLiteStorage(cfg *configs.Config, logger *zap.Logger) (*storage, error) {
+	if dir := filepath.Dir(cfg.Database.Path); cfg.Database.Path != ":memory:" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("can't create the database directory: %w", err)
+		}
+	}
+	db, err := adapters.OpenSQLite(cfg.Database.Path)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("using the sqlite storage", zap.String("path", cfg.Database.Path))
+	return newGormStorage(cfg, db, logger)
+}
+
+func newGormStorage(cfg *configs.Config, db *gorm.DB, logger *zap.Logger) (*storage, error) {
+	if err := adapters.TraceGorm(db); err != nil {
+		return nil, fmt.Errorf("can't trace the database calls: %w", err)
+	}
+	return &storage{
+		users:       adapters.NewUserStorage(db, logger),
+		orders:      adapters.NewOrderRepository(db, logger),
+		withdrawals: adapters.NewWithdrawalRepository(db, logger),
+		uow:         adapters.NewUnitOfWork(db, time.Duration(cfg.Timeouts.Transaction)*time.Second, logger),
+		outbox:      adapters.NewOutbox(db, logger),
+		history:     adapters.NewOrderHistory(db, logger),
+		lots:        adapters.NewPointLots(db, logger),
+		transfers:   adapters.NewTransferRepository(db, logger),
+		loginAudit:  adapters.NewLoginAudit(db, logger),
+		resets:      adapters.NewPasswordResetStorage(db, logger),
+		apiKeys:     adapters.NewAPIKeyStorage(db, logger),
+		mfa:         adapters.NewMFAStorage(db, logger),
+		webhooks:    adapters.NewWebhookStorage(db, logger),
+	}, nil
+}
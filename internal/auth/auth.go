@@ -9,7 +9,7 @@ import (
 func CheckToken(tokenString string, providerJWT ports.JWT, logger *zap.Logger) (*ports.Claims, error) {
 	claims, err := providerJWT.GetClaims(tokenString)
 	if err != nil {
-		logger.Error("failed to validate token", zap.Error(err), zap.String("token", tokenString))
+		logger.Error("failed to validate token", zap.Error(err))
 		return nil, err
 	}
 	logger.Info("user authorized successfully", zap.Any("claims", claims))
@@ -1,19 +1,41 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/OrtemRepos/go_store/internal/domain"
 	"github.com/OrtemRepos/go_store/internal/ports"
+	"github.com/OrtemRepos/go_store/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-func AuthMiddleware(providerJWT ports.JWT, logger *zap.Logger) gin.HandlerFunc {
+func AuthMiddleware(
+	providerJWT ports.JWT,
+	userStorage ports.UserStorage,
+	apiKeys ports.APIKeyStorage,
+	logger *zap.Logger,
+) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		logger := tracing.Logger(c.Request.Context(), logger)
 		result := c.GetStringMap("result")
 		if result == nil {
 			result = make(map[string]interface{})
 		}
+		if plainKey := c.GetHeader("X-API-Key"); plainKey != "" {
+			key, ok := checkAPIKey(c, plainKey, apiKeys, logger)
+			if !ok {
+				return
+			}
+			c.Set("apiKey", key)
+			c.Set("UserID", key.UserID)
+			result["UserID"] = key.UserID
+			c.Set("result", result)
+			c.Next()
+			return
+		}
 		tokenString, err := c.Cookie("authGoOrder")
 		if err != nil || tokenString == "" {
 			logger.Error("authorization failed: no auth cookie", zap.Error(err))
@@ -26,12 +48,27 @@ func AuthMiddleware(providerJWT ports.JWT, logger *zap.Logger) gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "BAD CREND"})
 			return
 		}
+		if claims.Purpose != "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "BAD CREND"})
+			return
+		}
 		if claims.UserID == 0 {
 			c.AbortWithStatusJSON(http.StatusInternalServerError,
 				gin.H{"error": "Empty UserID"},
 			)
 			return
 		}
+		sessionVersion, err := userStorage.SessionVersion(c.Request.Context(), claims.UserID)
+		if err != nil && !errors.Is(err, domain.ErrUserNotExist) {
+			logger.Error("can't get the session version", zap.Uint("UserID", claims.UserID), zap.Error(err))
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if err != nil || sessionVersion != claims.SessionVersion {
+			logger.Info("authorization failed: session revoked", zap.Uint("UserID", claims.UserID))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+			return
+		}
 		c.Set("claims", claims)
 		c.Set("UserID", claims.UserID)
 		result["UserID"] = claims.UserID
@@ -39,3 +76,46 @@ func AuthMiddleware(providerJWT ports.JWT, logger *zap.Logger) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func checkAPIKey(c *gin.Context, plainKey string, apiKeys ports.APIKeyStorage, logger *zap.Logger) (*domain.APIKey, bool) {
+	key, err := apiKeys.GetByHash(c.Request.Context(), domain.HashAPIKey(plainKey))
+	if errors.Is(err, domain.ErrAPIKeyNotFound) {
+		logger.Info("authorization failed: unknown API key")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+		return nil, false
+	} else if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	if key.Revoked() {
+		logger.Info("authorization failed: revoked API key", zap.Uint("key_id", key.ID))
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+		return nil, false
+	}
+	_ = apiKeys.TouchLastUsed(c.Request.Context(), key.ID, time.Now())
+	return key, true
+}
+
+// RequireScope rejects requests authenticated with an API key that lacks
+// the scope. Cookie sessions act with the full rights of the user.
+func RequireScope(scope domain.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := c.Get("apiKey"); ok && !key.(*domain.APIKey).HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key lacks scope " + string(scope)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession rejects requests authenticated with an API key, for
+// account management that only the user may perform.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("apiKey"); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed with an API key"})
+			return
+		}
+		c.Next()
+	}
+}
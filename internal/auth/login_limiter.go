@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LoginLimiter tracks failed login attempts per account and per client IP
+// and locks a key out for an exponentially growing period once it exceeds
+// its attempt budget.
+type LoginLimiter struct {
+	mu            sync.Mutex
+	accounts      map[string]*loginAttempts
+	ips           map[string]*loginAttempts
+	maxPerAccount int
+	maxPerIP      int
+	lockoutBase   time.Duration
+	lockoutMax    time.Duration
+	lastPrune     time.Time
+	now           func() time.Time
+}
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func NewLoginLimiter(maxPerAccount, maxPerIP int, lockoutBase, lockoutMax time.Duration) (*LoginLimiter, error) {
+	if maxPerAccount <= 0 {
+		return nil, fmt.Errorf("maxPerAccount[int] must be greater than zero")
+	}
+	if maxPerIP <= 0 {
+		return nil, fmt.Errorf("maxPerIP[int] must be greater than zero")
+	}
+	if lockoutBase <= 0 || lockoutMax < lockoutBase {
+		return nil, fmt.Errorf("lockoutBase[time.Duration] must be greater than zero and not greater than lockoutMax")
+	}
+	return &LoginLimiter{
+		accounts:      make(map[string]*loginAttempts),
+		ips:           make(map[string]*loginAttempts),
+		maxPerAccount: maxPerAccount,
+		maxPerIP:      maxPerIP,
+		lockoutBase:   lockoutBase,
+		lockoutMax:    lockoutMax,
+		now:           time.Now,
+	}, nil
+}
+
+// Locked returns how long the caller has to wait before the next attempt
+// for the account or the IP is accepted. Zero means the attempt is allowed.
+func (l *LoginLimiter) Locked(account, ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	wait := remaining(l.accounts[account], now)
+	if ipWait := remaining(l.ips[ip], now); ipWait > wait {
+		wait = ipWait
+	}
+	return wait
+}
+
+// Fail records a failed attempt for the account and the IP.
+func (l *LoginLimiter) Fail(account, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.prune(now)
+	l.fail(l.accounts, account, l.maxPerAccount, now)
+	l.fail(l.ips, ip, l.maxPerIP, now)
+}
+
+// Reset forgets the failures of the account after a successful login.
+// The IP counter is kept so that a valid account can't be used to reset
+// the budget of an address guessing other accounts.
+func (l *LoginLimiter) Reset(account string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.accounts, account)
+}
+
+func (l *LoginLimiter) fail(attempts map[string]*loginAttempts, key string, limit int, now time.Time) {
+	a, ok := attempts[key]
+	if !ok {
+		a = &loginAttempts{}
+		attempts[key] = a
+	}
+	a.failures++
+	a.lastFailure = now
+	if a.failures < limit {
+		return
+	}
+	lockout := l.lockoutBase
+	for i := limit; i < a.failures && lockout < l.lockoutMax; i++ {
+		lockout *= 2
+	}
+	if lockout > l.lockoutMax {
+		lockout = l.lockoutMax
+	}
+	a.lockedUntil = now.Add(lockout)
+}
+
+// prune drops counters that have been quiet for longer than the maximum
+// lockout, so the maps don't grow with every address that ever failed.
+func (l *LoginLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.lockoutMax {
+		return
+	}
+	l.lastPrune = now
+	for _, attempts := range []map[string]*loginAttempts{l.accounts, l.ips} {
+		for key, a := range attempts {
+			if now.Sub(a.lastFailure) > l.lockoutMax && !now.Before(a.lockedUntil) {
+				delete(attempts, key)
+			}
+		}
+	}
+}
+
+func remaining(a *loginAttempts, now time.Time) time.Duration {
+	if a == nil || !now.Before(a.lockedUntil) {
+		return 0
+	}
+	return a.lockedUntil.Sub(now)
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // used only to match entries of breached password lists
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+// PasswordPolicy checks new passwords against length limits and an
+// optional local list of breached passwords.
+type PasswordPolicy struct {
+	minLength int
+	maxLength int
+	breached  map[string]struct{}
+}
+
+// NewPasswordPolicy loads the breached password list from breachedListPath
+// if it is not empty. Every line of the file is either a plain password or
+// a SHA-1 hex digest, optionally followed by ":count" as in the HIBP dumps.
+func NewPasswordPolicy(minLength, maxLength int, breachedListPath string) (*PasswordPolicy, error) {
+	if minLength <= 0 {
+		return nil, fmt.Errorf("minLength[int] must be greater than zero")
+	}
+	if maxLength < minLength {
+		return nil, fmt.Errorf("maxLength[int] must not be less than minLength")
+	}
+	p := &PasswordPolicy{
+		minLength: minLength,
+		maxLength: maxLength,
+		breached:  make(map[string]struct{}),
+	}
+	if breachedListPath == "" {
+		return p, nil
+	}
+	file, err := os.Open(breachedListPath)
+	if err != nil {
+		return nil, fmt.Errorf("can't open breached password list: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if digest, _, _ := strings.Cut(line, ":"); isSHA1Hex(digest) {
+			p.breached[strings.ToLower(digest)] = struct{}{}
+			continue
+		}
+		p.breached[sha1Hex(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read breached password list: %w", err)
+	}
+	return p, nil
+}
+
+func (p *PasswordPolicy) Validate(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		return fmt.Errorf("%w: at least %d characters required", domain.ErrPasswordTooShort, p.minLength)
+	}
+	// bcrypt ignores everything after 72 bytes, so the limit is in bytes.
+	if len(password) > p.maxLength {
+		return fmt.Errorf("%w: at most %d bytes allowed", domain.ErrPasswordTooLong, p.maxLength)
+	}
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		return domain.ErrPasswordBreached
+	}
+	return nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s)) //nolint:gosec // see import comment
+	return hex.EncodeToString(sum[:])
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != hex.EncodedLen(sha1.Size) {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// AccrualRule grants points to orders whose number starts with Prefix and
+// that were uploaded within [From, To). The accrual is Fixed points plus
+// Percent of the order amount, capped at Max if it is set. Percent only
+// applies to orders uploaded with an amount.
+type AccrualRule struct {
+	Name    string     `yaml:"name"`
+	Prefix  string     `yaml:"prefix"`
+	Percent float64    `yaml:"percent"`
+	Fixed   int        `yaml:"fixed"`
+	Max     int        `yaml:"max"`
+	From    *time.Time `yaml:"from"`
+	To      *time.Time `yaml:"to"`
+}
+
+// AccrualRules are checked in order; the first matching rule is applied.
+type AccrualRules []AccrualRule
+
+func (r AccrualRule) Validate() error {
+	switch {
+	case r.Name == "":
+		return fmt.Errorf("%w: a rule has no name", ErrInvalidAccrualRule)
+	case strings.Trim(r.Prefix, "0123456789") != "":
+		return fmt.Errorf("%w: prefix of %q must be digits", ErrInvalidAccrualRule, r.Name)
+	case r.Percent < 0 || r.Percent > 100:
+		return fmt.Errorf("%w: percent of %q must be between 0 and 100", ErrInvalidAccrualRule, r.Name)
+	case r.Fixed < 0 || r.Max < 0:
+		return fmt.Errorf("%w: fixed and max of %q must not be negative", ErrInvalidAccrualRule, r.Name)
+	case r.From != nil && r.To != nil && !r.From.Before(*r.To):
+		return fmt.Errorf("%w: from of %q must be before to", ErrInvalidAccrualRule, r.Name)
+	}
+	return nil
+}
+
+func (rs AccrualRules) Validate() error {
+	for _, rule := range rs {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match returns the first rule that applies to the order.
+func (rs AccrualRules) Match(order *Order) (*AccrualRule, bool) {
+	for i := range rs {
+		if rs[i].applies(order) {
+			return &rs[i], true
+		}
+	}
+	return nil, false
+}
+
+func (r AccrualRule) applies(order *Order) bool {
+	if !strings.HasPrefix(order.Number, r.Prefix) {
+		return false
+	}
+	if r.From != nil && order.CreatedAt.Before(*r.From) {
+		return false
+	}
+	return r.To == nil || order.CreatedAt.Before(*r.To)
+}
+
+// Accrual returns the points the rule grants to the order.
+func (r AccrualRule) Accrual(order *Order) int {
+	points := r.Fixed
+	if order.Amount != nil {
+		points += int(math.Floor(float64(*order.Amount) * r.Percent / 100))
+	}
+	if r.Max > 0 && points > r.Max {
+		points = r.Max
+	}
+	return points
+}
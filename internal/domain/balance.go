@@ -0,0 +1,15 @@
+package domain
+
+// Balance splits the points of a user: Current can be spent, Held is
+// reserved by withdrawals waiting for confirmation and Withdrawn is spent.
+// It is also used as a change of a balance, then the fields are deltas.
+type Balance struct {
+	Current   int `json:"current"`
+	Held      int `json:"held"`
+	Withdrawn int `json:"withdrawn"`
+}
+
+// Total counts the points of the user, spent or not.
+func (b Balance) Total() int {
+	return b.Current + b.Held + b.Withdrawn
+}
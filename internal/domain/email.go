@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// NormalizeEmail validates the address and returns its canonical form,
+// so that Foo@x.com and foo@x.com refer to the same account.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return "", ErrInvalidEmail
+	}
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 || !strings.Contains(email[at+1:], ".") {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(email), nil
+}
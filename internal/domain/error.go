@@ -12,4 +12,74 @@ var ErrOrderAlreadyExistsForUser = errors.New("user has already added this order
 
 var ErrOrderConflict = errors.New("the order number has already been uploaded by another user")
 
-var ErrNotEnoughPoints = errors.New("the user does not have enough points to be charged")
\ No newline at end of file
+var ErrNotEnoughPoints = errors.New("the user does not have enough points to be charged")
+
+var ErrInvalidEmail = errors.New("email address is invalid")
+
+var ErrUserAlreadyExists = errors.New("user with this email already exists")
+
+var ErrPasswordTooShort = errors.New("password is too short")
+
+var ErrPasswordTooLong = errors.New("password is too long")
+
+var ErrPasswordBreached = errors.New("password has appeared in a data breach")
+
+var ErrWrongPassword = errors.New("wrong password")
+
+var ErrResetTokenInvalid = errors.New("password reset token is invalid or expired")
+
+var ErrUnknownScope = errors.New("unknown API key scope")
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+var ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+var ErrMFANotEnrolled = errors.New("two-factor authentication is not enrolled")
+
+var ErrInvalidMFACode = errors.New("invalid two-factor authentication code")
+
+var ErrInvalidCursor = errors.New("cursor is invalid")
+
+var ErrInvalidListQuery = errors.New("list query is invalid")
+
+var ErrOrderNotFound = errors.New("order not found")
+
+var ErrOrderAlreadyCompleted = errors.New("order has already been completed")
+
+var ErrDuplicateKey = errors.New("unique constraint violated")
+
+var ErrInvalidWebhookURL = errors.New("webhook URL must be an absolute http or https URL")
+
+var ErrWebhookAddressNotAllowed = errors.New("webhook URL must not point to a loopback, link-local or private address")
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+var ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+
+var ErrWithdrawalNotFound = errors.New("withdrawal not found")
+
+var ErrWithdrawalNotHeld = errors.New("withdrawal is not on hold")
+
+var ErrWithdrawalHoldExpired = errors.New("withdrawal hold has expired")
+
+var ErrWithdrawalHoldActive = errors.New("withdrawal hold has not expired yet")
+
+var ErrPointLotNotExpired = errors.New("point lot has not expired yet")
+
+var ErrPointLotChanged = errors.New("point lot was changed concurrently")
+
+var ErrInvalidTransferSum = errors.New("transfer sum must be greater than zero")
+
+var ErrTransferToSelf = errors.New("can't transfer points to yourself")
+
+var ErrTransferLimitExceeded = errors.New("daily transfer limit exceeded")
+
+var ErrTransferRecipientRejected = errors.New("the recipient can't receive this transfer")
+
+var ErrInvalidAccrualRule = errors.New("invalid accrual rule")
+
+var ErrInvalidOrderAmount = errors.New("order amount must not be negative")
+
+var ErrOrderChanged = errors.New("order has changed since it was read")
+
+var ErrOrderNeedsAttention = errors.New("order needs attention")
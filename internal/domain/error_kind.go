@@ -0,0 +1,55 @@
+package domain
+
+import "errors"
+
+// TransientError is a failure that may not happen again, e.g. a timeout,
+// a lost connection or a busy dependency, so the operation is worth
+// retrying.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// PermanentError is a failure that retrying won't fix, e.g. an unknown
+// user or an answer that can't be understood.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Transient marks err as transient. It returns nil for nil and err itself
+// if it is already classified.
+func Transient(err error) error {
+	if err == nil || classified(err) {
+		return err
+	}
+	return &TransientError{Err: err}
+}
+
+// Permanent marks err as permanent. It returns nil for nil and err itself
+// if it is already classified.
+func Permanent(err error) error {
+	if err == nil || classified(err) {
+		return err
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsTransient reports whether err is marked as transient. Errors that are
+// not classified are permanent: only failures known to go away are retried.
+func IsTransient(err error) bool {
+	var transient *TransientError
+	return errors.As(err, &transient)
+}
+
+func classified(err error) bool {
+	var transient *TransientError
+	var permanent *PermanentError
+	return errors.As(err, &transient) || errors.As(err, &permanent)
+}
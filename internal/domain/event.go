@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventUserRegistered      EventType = "UserRegistered"
+	EventOrderRegistered     EventType = "OrderRegistered"
+	EventOrderProcessed      EventType = "OrderProcessed"
+	EventOrderInvalid        EventType = "OrderInvalid"
+	EventOrderNeedsAttention EventType = "OrderNeedsAttention"
+	EventPointsWithdrawn     EventType = "PointsWithdrawn"
+	EventPointsHeld          EventType = "PointsHeld"
+	EventPointsReleased      EventType = "PointsReleased"
+	EventPointsExpired       EventType = "PointsExpired"
+	EventPointsSent          EventType = "PointsSent"
+	EventPointsReceived      EventType = "PointsReceived"
+	EventBalanceCorrected    EventType = "BalanceCorrected"
+)
+
+// Event is a domain event. It is written to the outbox in the same
+// transaction as the change it describes and published later, so an event
+// is never lost nor published for a change that was rolled back. A failed
+// event is retried no earlier than RetryAt; once it has failed too often it
+// is dead and left to the operators.
+type Event struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	UserID      uint            `gorm:"not null;index" json:"user_id"`
+	Type        EventType       `gorm:"not null" json:"type"`
+	Payload     json.RawMessage `gorm:"not null" json:"payload"`
+	CreatedAt   time.Time       `json:"created_at"`
+	PublishedAt *time.Time      `gorm:"index" json:"-"`
+	Attempts    int             `gorm:"not null;default:0" json:"-"`
+	LastError   string          `json:"-"`
+	RetryAt     *time.Time      `json:"-"`
+	DeadAt      *time.Time      `gorm:"index" json:"-"`
+}
+
+func (Event) TableName() string {
+	return "outbox_events"
+}
+
+type userEvent struct {
+	Email string `json:"email"`
+}
+
+type orderEvent struct {
+	Number  string      `json:"number"`
+	Status  orderStatus `json:"status"`
+	Accural *int        `json:"accural,omitempty"`
+}
+
+type withdrawalEvent struct {
+	Order  string         `json:"order"`
+	Sum    int            `json:"sum"`
+	Status withdrawStatus `json:"status"`
+}
+
+func NewUserRegisteredEvent(user *User) *Event {
+	return newEvent(user.ID, EventUserRegistered, userEvent{Email: user.Email})
+}
+
+// NewOrderEvent returns OrderRegistered, OrderProcessed, OrderInvalid or
+// OrderNeedsAttention depending on the status of the order.
+func NewOrderEvent(order *Order) *Event {
+	eventType := EventOrderRegistered
+	switch order.Status {
+	case PROCESSED:
+		eventType = EventOrderProcessed
+	case INVALID:
+		eventType = EventOrderInvalid
+	case NEEDS_ATTENTION:
+		eventType = EventOrderNeedsAttention
+	}
+	return newEvent(order.UserID, eventType, orderEvent{
+		Number:  order.Number,
+		Status:  order.Status,
+		Accural: order.Accural,
+	})
+}
+
+// NewWithdrawalEvent returns PointsHeld, PointsWithdrawn or PointsReleased
+// depending on the status of the withdrawal.
+func NewWithdrawalEvent(userID uint, withdraw *Withdraw) *Event {
+	eventType := EventPointsWithdrawn
+	switch withdraw.Status {
+	case HELD:
+		eventType = EventPointsHeld
+	case CANCELLED, EXPIRED:
+		eventType = EventPointsReleased
+	}
+	return newEvent(userID, eventType, withdrawalEvent{
+		Order:  withdraw.Number,
+		Sum:    withdraw.Sum,
+		Status: withdraw.Status,
+	})
+}
+
+func NewPointsExpiredEvent(expiry *PointExpiry) *Event {
+	return newEvent(expiry.UserID, EventPointsExpired, expiry)
+}
+
+// NewTransferEvents returns PointsSent for the sender and PointsReceived
+// for the recipient, so each user sees the transfer in order with the rest
+// of their events.
+func NewTransferEvents(transfer *Transfer) []*Event {
+	return []*Event{
+		newEvent(transfer.SenderID, EventPointsSent, transfer),
+		newEvent(transfer.RecipientID, EventPointsReceived, transfer),
+	}
+}
+
+// NewBalanceCorrectedEvent records the points credited to fix a balance
+// that didn't add up to the ledger of the user.
+func NewBalanceCorrectedEvent(d *Discrepancy) *Event {
+	return newEvent(d.UserID, EventBalanceCorrected, d)
+}
+
+func newEvent(userID uint, eventType EventType, payload any) *Event {
+	// The payloads are plain structs, so marshalling can't fail.
+	data, _ := json.Marshal(payload)
+	return &Event{UserID: userID, Type: eventType, Payload: data}
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// FailedLogin is an audit record of an unsuccessful authentication attempt.
+type FailedLogin struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	Email     string    `gorm:"index;not null" json:"email"`
+	IP        string    `gorm:"index" json:"ip"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at" time_format:"rfc3339"`
+}
+
+func NewFailedLogin(email, ip, reason string) *FailedLogin {
+	return &FailedLogin{
+		Email:  email,
+		IP:     ip,
+		Reason: reason,
+	}
+}
@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/common/totp"
+)
+
+const recoveryCodesCount = 10
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the
+// authenticator is lost. Only the hash is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null;index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func NewRecoveryCodes(userID uint) ([]*RecoveryCode, []string, error) {
+	codes := make([]*RecoveryCode, 0, recoveryCodesCount)
+	plain := make([]string, 0, recoveryCodesCount)
+	raw := make([]byte, 7)
+	for i := 0; i < recoveryCodesCount; i++ {
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(raw))[:10]
+		code = code[:5] + "-" + code[5:]
+		plain = append(plain, code)
+		codes = append(codes, &RecoveryCode{UserID: userID, CodeHash: HashRecoveryCode(code)})
+	}
+	return codes, plain, nil
+}
+
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// EnrollTOTP stores a new secret that becomes active only after
+// EnableTOTP confirms that the user's authenticator produces valid codes.
+func (u *User) EnrollTOTP(secret string) error {
+	if u.TOTPEnabled {
+		return ErrMFAAlreadyEnabled
+	}
+	u.TOTPSecret = secret
+	u.TOTPLastStep = 0
+	return nil
+}
+
+func (u *User) EnableTOTP(code string, now time.Time) error {
+	if u.TOTPEnabled {
+		return ErrMFAAlreadyEnabled
+	}
+	if u.TOTPSecret == "" {
+		return ErrMFANotEnrolled
+	}
+	if !u.VerifyTOTP(code, now) {
+		return ErrInvalidMFACode
+	}
+	u.TOTPEnabled = true
+	return nil
+}
+
+func (u *User) DisableTOTP() {
+	u.TOTPEnabled = false
+	u.TOTPSecret = ""
+	u.TOTPLastStep = 0
+}
+
+// VerifyTOTP accepts each code only once, a code seen in a previous
+// verification is rejected even if it is still inside its time window.
+func (u *User) VerifyTOTP(code string, now time.Time) bool {
+	if u.TOTPSecret == "" {
+		return false
+	}
+	step, ok := totp.Validate(u.TOTPSecret, code, now, 1)
+	if !ok || step <= u.TOTPLastStep {
+		return false
+	}
+	u.TOTPLastStep = step
+	return true
+}
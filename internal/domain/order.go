@@ -1,7 +1,10 @@
 package domain
 
 import (
+	"fmt"
+	"strings"
 	"time"
+
 	"github.com/OrtemRepos/go_store/internal/common/luhn"
 )
 
@@ -12,16 +15,35 @@ const (
 	PROCESSING orderStatus = "PROCESSING"
 	INVALID    orderStatus = "INVALID"
 	PROCESSED  orderStatus = "PROCESSED"
+	// NEEDS_ATTENTION orders failed to be processed and wait for an
+	// operator or the reconciliation; they are not completed.
+	NEEDS_ATTENTION orderStatus = "NEEDS_ATTENTION"
 )
 
+// Final statuses are not changed by the accrual system anymore.
+func (s orderStatus) Final() bool {
+	return s == INVALID || s == PROCESSED
+}
+
+func ParseOrderStatus(s string) (orderStatus, error) {
+	switch status := orderStatus(strings.ToUpper(s)); status {
+	case REGISTERED, PROCESSING, INVALID, PROCESSED, NEEDS_ATTENTION:
+		return status, nil
+	default:
+		return "", fmt.Errorf("%w: unknown status %q", ErrInvalidListQuery, s)
+	}
+}
+
 type Order struct {
-	ID        uint         `gorm:"primaryKey;autoIncrement" json:"-"`
-	UserID    uint         `gorm:"not null;index" json:"-"`
-	Number    string       `gorm:"uniqueIndex;not null" json:"number"`
-	Accural   *int         `json:"accural,omitempty"`
-	Completed bool         `gorm:"default:FALSE" json:"-"`
-	Status    orderStatus  `json:"status"`
-	CreatedAt time.Time    `gorm:"autoCreateTime" json:"created_at" time_format:"rfc3339"`
+	ID        uint        `gorm:"primaryKey;autoIncrement" json:"-"`
+	UserID    uint        `gorm:"not null;index;index:idx_orders_user_created,priority:1" json:"-"`
+	Number    string      `gorm:"uniqueIndex;not null" json:"number"`
+	Accural   *int        `json:"accural,omitempty"`
+	Amount    *int        `json:"amount,omitempty"`
+	Completed bool        `gorm:"default:FALSE" json:"-"`
+	Failure   string      `json:"-"`
+	Status    orderStatus `json:"status"`
+	CreatedAt time.Time   `gorm:"autoCreateTime;index:idx_orders_user_created,priority:2" json:"created_at" time_format:"rfc3339"`
 }
 
 func NewOrder(number string, userID uint) (*Order, error) {
@@ -30,4 +52,14 @@ func NewOrder(number string, userID uint) (*Order, error) {
 		return nil, ErrInvalidOrderNubmer
 	}
 	return &order, nil
-}
\ No newline at end of file
+}
+
+// SetAmount records the purchase amount of the order, which percentage
+// accrual rules are applied to.
+func (o *Order) SetAmount(amount int) error {
+	if amount < 0 {
+		return ErrInvalidOrderAmount
+	}
+	o.Amount = &amount
+	return nil
+}
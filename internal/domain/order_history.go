@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// OrderStatusChange is one entry of the processing history of an order.
+// Response holds the body the accrual system answered with, if the change
+// came from it.
+type OrderStatusChange struct {
+	ID        uint        `gorm:"primaryKey" json:"-"`
+	Number    string      `gorm:"not null;index" json:"-"`
+	Status    orderStatus `gorm:"not null" json:"status"`
+	Accural   *int        `json:"accural,omitempty"`
+	Response  string      `json:"response,omitempty"`
+	CreatedAt time.Time   `json:"created_at" time_format:"rfc3339"`
+}
+
+func (OrderStatusChange) TableName() string {
+	return "order_status_history"
+}
+
+func NewOrderStatusChange(order *Order, response []byte) *OrderStatusChange {
+	return &OrderStatusChange{
+		Number:   order.Number,
+		Status:   order.Status,
+		Accural:  order.Accural,
+		Response: string(response),
+	}
+}
@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+type SortOrder string
+
+const (
+	SortAsc  SortOrder = "asc"
+	SortDesc SortOrder = "desc"
+)
+
+func ParseSortOrder(s string) (SortOrder, error) {
+	switch SortOrder(strings.ToLower(s)) {
+	case "", SortAsc:
+		return SortAsc, nil
+	case SortDesc:
+		return SortDesc, nil
+	default:
+		return "", fmt.Errorf("%w: sort must be asc or desc", ErrInvalidListQuery)
+	}
+}
+
+// Cursor points at the last row of a page. Rows are ordered by
+// (created_at, id), so the cursor stays valid while new rows are inserted.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + strconv.FormatUint(uint64(c.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	i, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: time.Unix(0, n).UTC(), ID: uint(i)}, nil
+}
+
+// ListQuery selects a page of a user's orders or withdrawals.
+type ListQuery struct {
+	Limit    int
+	Cursor   *Cursor
+	Sort     SortOrder
+	From     *time.Time
+	To       *time.Time
+	Statuses []orderStatus
+}
+
+func (q *ListQuery) Normalize() error {
+	if q.Limit == 0 {
+		q.Limit = DefaultPageLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxPageLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidListQuery, MaxPageLimit)
+	}
+	if q.Sort == "" {
+		q.Sort = SortAsc
+	}
+	if q.From != nil && q.To != nil && q.To.Before(*q.From) {
+		return fmt.Errorf("%w: to is before from", ErrInvalidListQuery)
+	}
+	return nil
+}
+
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// PasswordResetToken is a single-use, time-limited token. Only the hash of
+// the token is stored, the plain value is sent to the user.
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func NewPasswordResetToken(userID uint, ttl time.Duration) (*PasswordResetToken, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	plain := base64.RawURLEncoding.EncodeToString(raw)
+	return &PasswordResetToken{
+		UserID:    userID,
+		TokenHash: HashResetToken(plain),
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	}, plain, nil
+}
+
+func HashResetToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,86 @@
+package domain
+
+import "time"
+
+// PointLot is the points of one accrual. They expire together, and
+// withdrawals take points from the lots that expire first.
+type PointLot struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uint      `gorm:"not null;index:idx_point_lots_user_expires,priority:1" json:"-"`
+	Source    string    `gorm:"not null" json:"source"`
+	Amount    int       `gorm:"not null" json:"amount"`
+	Remaining int       `gorm:"not null;index" json:"remaining"`
+	ExpiresAt time.Time `gorm:"not null;index;index:idx_point_lots_user_expires,priority:2" json:"expires_at" time_format:"rfc3339"`
+	CreatedAt time.Time `json:"created_at" time_format:"rfc3339"`
+}
+
+// PointLotUsage is the points a withdrawal took from a lot. They are put
+// back into the lot if the withdrawal was a hold that got released.
+type PointLotUsage struct {
+	ID        uint   `gorm:"primaryKey"`
+	LotID     uint   `gorm:"not null;index"`
+	Number    string `gorm:"not null;index"`
+	Amount    int    `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// PointExpiry records the points of a lot that expired. A lot may expire
+// more than once: points a released hold puts back into an expired lot
+// expire on the next run.
+type PointExpiry struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	LotID     uint      `gorm:"not null;index:idx_point_expiries_lot" json:"-"`
+	Source    string    `gorm:"not null" json:"source"`
+	Amount    int       `gorm:"not null" json:"amount"`
+	ExpiredAt time.Time `gorm:"not null" json:"expired_at" time_format:"rfc3339"`
+}
+
+// NewPointLot returns the lot of an accrual made at now that is valid for
+// validMonths.
+func NewPointLot(userID uint, source string, amount int, now time.Time, validMonths int) *PointLot {
+	return &PointLot{
+		UserID:    userID,
+		Source:    source,
+		Amount:    amount,
+		Remaining: amount,
+		ExpiresAt: now.UTC().AddDate(0, validMonths, 0),
+	}
+}
+
+// TakeFromLots takes sum points for the withdrawal number from lots, in the
+// given order, and returns what was taken from each lot. Points the lots
+// don't cover were accrued before lots were tracked; they never expire.
+func TakeFromLots(lots []*PointLot, number string, sum int) []*PointLotUsage {
+	var usages []*PointLotUsage
+	for _, lot := range lots {
+		if sum == 0 {
+			break
+		}
+		amount := min(lot.Remaining, sum)
+		if amount <= 0 {
+			continue
+		}
+		lot.Remaining -= amount
+		sum -= amount
+		usages = append(usages, &PointLotUsage{LotID: lot.ID, Number: number, Amount: amount})
+	}
+	return usages
+}
+
+// Expire empties the lot. The points expired from the balance are capped by
+// current, the points of the user that are neither held nor withdrawn.
+func (l *PointLot) Expire(now time.Time, current int) (*PointExpiry, error) {
+	if now.Before(l.ExpiresAt) {
+		return nil, ErrPointLotNotExpired
+	}
+	amount := max(min(l.Remaining, current), 0)
+	l.Remaining = 0
+	return &PointExpiry{
+		UserID:    l.UserID,
+		LotID:     l.ID,
+		Source:    l.Source,
+		Amount:    amount,
+		ExpiredAt: now.UTC(),
+	}, nil
+}
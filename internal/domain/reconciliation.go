@@ -0,0 +1,139 @@
+package domain
+
+import "time"
+
+type discrepancyKind string
+
+const (
+	// UNKNOWN_ORDER orders are not known to the accrual system.
+	UNKNOWN_ORDER discrepancyKind = "UNKNOWN_ORDER"
+	// STATUS_MISMATCH orders are final on one side only or have
+	// different final statuses.
+	STATUS_MISMATCH discrepancyKind = "STATUS_MISMATCH"
+	// ACCRUAL_MISMATCH orders are processed on both sides with different
+	// accruals.
+	ACCRUAL_MISMATCH discrepancyKind = "ACCRUAL_MISMATCH"
+	// BALANCE_MISMATCH balances don't add up to the ledger of the user.
+	BALANCE_MISMATCH discrepancyKind = "BALANCE_MISMATCH"
+	// CHECK_FAILED orders or balances could not be compared.
+	CHECK_FAILED discrepancyKind = "CHECK_FAILED"
+)
+
+// Discrepancy is a difference between the local data and the accrual
+// system, or between a balance and the ledger of its user.
+type Discrepancy struct {
+	Kind          discrepancyKind `json:"kind"`
+	UserID        uint            `json:"user_id"`
+	Number        string          `json:"number,omitempty"`
+	LocalStatus   orderStatus     `json:"local_status,omitempty"`
+	RemoteStatus  orderStatus     `json:"remote_status,omitempty"`
+	LocalAccrual  *int            `json:"local_accrual,omitempty"`
+	RemoteAccrual *int            `json:"remote_accrual,omitempty"`
+	Expected      *int            `json:"expected,omitempty"`
+	Actual        *int            `json:"actual,omitempty"`
+	Fixed         bool            `json:"fixed"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// Missing is the number of points the user lacks because of the
+// discrepancy. Only these are credited by a fix: points credited too
+// generously are never taken back automatically.
+func (d *Discrepancy) Missing() int {
+	switch d.Kind {
+	case STATUS_MISMATCH, ACCRUAL_MISMATCH:
+		if d.RemoteStatus == PROCESSED && d.RemoteAccrual != nil {
+			missing := *d.RemoteAccrual
+			if d.LocalStatus == PROCESSED && d.LocalAccrual != nil {
+				missing -= *d.LocalAccrual
+			}
+			return missing
+		}
+	case BALANCE_MISMATCH:
+		return *d.Expected - *d.Actual
+	}
+	return 0
+}
+
+// CompareOrder returns the discrepancy between the local order and the
+// order of the accrual system, nil if they agree. An order that is not
+// final on either side is still being processed and agrees.
+func CompareOrder(local, remote *Order) *Discrepancy {
+	d := &Discrepancy{
+		Kind:          STATUS_MISMATCH,
+		UserID:        local.UserID,
+		Number:        local.Number,
+		LocalStatus:   local.Status,
+		RemoteStatus:  remote.Status,
+		LocalAccrual:  local.Accural,
+		RemoteAccrual: remote.Accural,
+	}
+	switch {
+	case !local.Completed && !remote.Status.Final():
+		return nil
+	case local.Completed != remote.Status.Final(), local.Status != remote.Status:
+		return d
+	case local.Status == PROCESSED && accrued(local) != accrued(remote):
+		d.Kind = ACCRUAL_MISMATCH
+		return d
+	}
+	return nil
+}
+
+// Ledger is what the balance of a user adds up to: the points accrued for
+// orders, transferred from others, net of the ones sent, less the ones
+// that expired. Withdrawals move points within the balance only.
+type Ledger struct {
+	Accrued     int `json:"accrued"`
+	Transferred int `json:"transferred"`
+	Expired     int `json:"expired"`
+}
+
+func (l Ledger) Total() int {
+	return l.Accrued + l.Transferred - l.Expired
+}
+
+// CompareBalance returns the discrepancy between the balance and the
+// ledger of the user, nil if they agree.
+func CompareBalance(userID uint, balance Balance, ledger Ledger) *Discrepancy {
+	expected, actual := ledger.Total(), balance.Total()
+	if expected == actual {
+		return nil
+	}
+	return &Discrepancy{
+		Kind:     BALANCE_MISMATCH,
+		UserID:   userID,
+		Expected: &expected,
+		Actual:   &actual,
+	}
+}
+
+// ReconciliationReport lists the discrepancies found in the orders
+// created between From and To and in the balances of their users.
+type ReconciliationReport struct {
+	From          time.Time      `json:"from" time_format:"rfc3339"`
+	To            time.Time      `json:"to" time_format:"rfc3339"`
+	Fix           bool           `json:"fix"`
+	StartedAt     time.Time      `json:"started_at" time_format:"rfc3339"`
+	FinishedAt    time.Time      `json:"finished_at" time_format:"rfc3339"`
+	Orders        int            `json:"orders"`
+	Users         int            `json:"users"`
+	Discrepancies []*Discrepancy `json:"discrepancies"`
+}
+
+// Unresolved counts the discrepancies that were not fixed.
+func (r *ReconciliationReport) Unresolved() int {
+	unresolved := 0
+	for _, d := range r.Discrepancies {
+		if !d.Fixed {
+			unresolved++
+		}
+	}
+	return unresolved
+}
+
+func accrued(order *Order) int {
+	if order.Status != PROCESSED || order.Accural == nil {
+		return 0
+	}
+	return *order.Accural
+}
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"strconv"
+	"time"
+)
+
+// Transfer moves points from one user to another. It shows in the history
+// of both.
+type Transfer struct {
+	ID             uint      `gorm:"primaryKey" json:"-"`
+	SenderID       uint      `gorm:"not null;index:idx_transfers_sender_created,priority:1" json:"-"`
+	RecipientID    uint      `gorm:"not null;index:idx_transfers_recipient_created,priority:1" json:"-"`
+	SenderEmail    string    `gorm:"not null" json:"from"`
+	RecipientEmail string    `gorm:"not null" json:"to"`
+	Sum            int       `gorm:"not null" json:"sum"`
+	CreatedAt      time.Time `gorm:"autoCreateTime;index:idx_transfers_sender_created,priority:2;index:idx_transfers_recipient_created,priority:2" json:"created_at" time_format:"rfc3339"`
+}
+
+// TransferLimits caps what a user may send per day. Zero means no limit.
+type TransferLimits struct {
+	DailySum   int
+	DailyCount int
+}
+
+// TransferTotals is what a user has sent since the start of the day.
+type TransferTotals struct {
+	Sum   int
+	Count int
+}
+
+// Allow checks that a transfer of sum fits the limits after sent.
+func (l TransferLimits) Allow(sent TransferTotals, sum int) error {
+	if l.DailySum > 0 && sent.Sum+sum > l.DailySum {
+		return ErrTransferLimitExceeded
+	}
+	if l.DailyCount > 0 && sent.Count+1 > l.DailyCount {
+		return ErrTransferLimitExceeded
+	}
+	return nil
+}
+
+// CanTransfer checks the rules of a transfer of sum points that don't
+// depend on the recipient. sent is what the user has already sent today.
+func (u *User) CanTransfer(sum int, sent TransferTotals, limits TransferLimits) error {
+	if sum <= 0 {
+		return ErrInvalidTransferSum
+	}
+	if u.CurrentBalance < sum {
+		return ErrNotEnoughPoints
+	}
+	return limits.Allow(sent, sum)
+}
+
+// TransferTo moves sum points of the current balance to recipient. sent is
+// what the user has already sent today.
+func (u *User) TransferTo(recipient *User, sum int, sent TransferTotals, limits TransferLimits) (*Transfer, error) {
+	if err := u.CanTransfer(sum, sent, limits); err != nil {
+		return nil, err
+	}
+	if recipient.ID == u.ID {
+		return nil, ErrTransferToSelf
+	}
+	u.CurrentBalance -= sum
+	recipient.CurrentBalance += sum
+	return &Transfer{
+		SenderID:       u.ID,
+		RecipientID:    recipient.ID,
+		SenderEmail:    u.Email,
+		RecipientEmail: recipient.Email,
+		Sum:            sum,
+	}, nil
+}
+
+// Reference identifies the transfer where a withdrawal number is expected,
+// e.g. in the usages of point lots.
+func (t *Transfer) Reference() string {
+	return "transfer-" + strconv.FormatUint(uint64(t.ID), 10)
+}
+
+// MovedLots returns the lots of the recipient for the points taken from the
+// lots of the sender, so transferred points keep their expiry date.
+func (t *Transfer) MovedLots(lots []*PointLot, usages []*PointLotUsage) []*PointLot {
+	expiresAt := make(map[uint]time.Time, len(lots))
+	for _, lot := range lots {
+		expiresAt[lot.ID] = lot.ExpiresAt
+	}
+	moved := make([]*PointLot, 0, len(usages))
+	for _, usage := range usages {
+		moved = append(moved, &PointLot{
+			UserID:    t.RecipientID,
+			Source:    t.Reference(),
+			Amount:    usage.Amount,
+			Remaining: usage.Amount,
+			ExpiresAt: expiresAt[usage.LotID],
+		})
+	}
+	return moved
+}
@@ -1,38 +1,49 @@
 package domain
 
 import (
+	"strconv"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
 	ID             uint        `gorm:"primaryKey" json:"id"`
 	Email          string      `gorm:"index;unique" json:"email"`
-	Password       string      `json:"password"`
+	Password       string      `json:"-"`
 	CurrentBalance int         `json:"current"`
+	Held           int         `gorm:"not null;default:0" json:"held"`
 	Withdrawn      int         `json:"withdrawn"`
 	Orders         []*Order    `gorm:"foreignKey:UserID" json:"orders"`
 	Withdraws      []*Withdraw `gorm:"foreignKey:UserID" json:"withdraws"`
 	IsComplete     bool        `gorm:"column:completed;default:FALSE"`
+	SessionVersion int         `gorm:"not null;default:0" json:"-"`
+	TOTPSecret     string      `gorm:"column:totp_secret" json:"-"`
+	TOTPEnabled    bool        `gorm:"column:totp_enabled;default:FALSE" json:"mfa_enabled"`
+	TOTPLastStep   int64       `gorm:"column:totp_last_step;default:0" json:"-"`
 	CreatedAt      time.Time   `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt      time.Time   `gorm:"autoUpdateTime" json:"updated_at,omitempty"`
 }
 
-func NewUser(email, passwordPlain string) (*User, error) {
-	password, err := bcrypt.GenerateFromPassword([]byte(passwordPlain), bcrypt.DefaultCost)
+func NewUser(email, passwordHash string) (*User, error) {
+	email, err := NormalizeEmail(email)
 	if err != nil {
 		return nil, err
 	}
-	return &User{
-		Email:    email,
-		Password: string(password),
-	}, nil
+	user := &User{Email: email}
+	user.SetPassword(passwordHash)
+	return user, nil
+}
+
+// SetPassword replaces the password hash and invalidates every session
+// issued before the change.
+func (u *User) SetPassword(passwordHash string) {
+	u.Password = passwordHash
+	u.SessionVersion++
 }
 
-func (u *User) ValidatePassword(passwordPlain string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(passwordPlain))
-	return err == nil
+// RehashPassword replaces the hash of the same password, e.g. after the
+// hashing parameters changed. Sessions stay valid.
+func (u *User) RehashPassword(passwordHash string) {
+	u.Password = passwordHash
 }
 
 func (u *User) AddOrder(numberOrder string) (*Order, error) {
@@ -50,6 +61,32 @@ func (u *User) AddOrder(numberOrder string) (*Order, error) {
 }
 
 func (u *User) AddWithdrawn(numberOrder string, sum int) (*Withdraw, error) {
+	withdraw, err := u.newWithdraw(numberOrder, sum)
+	if err != nil {
+		return withdraw, err
+	}
+	u.applyWithdraw(withdraw)
+	return withdraw, nil
+}
+
+// HoldWithdrawn reserves sum points for a withdrawal that has to be
+// confirmed or cancelled before expiresAt.
+func (u *User) HoldWithdrawn(numberOrder string, sum int, expiresAt time.Time) (*Withdraw, error) {
+	withdraw, err := u.newWithdraw(numberOrder, sum)
+	if err != nil {
+		return withdraw, err
+	}
+	withdraw.Status = HELD
+	withdraw.ExpiresAt = &expiresAt
+	u.applyWithdraw(withdraw)
+	return withdraw, nil
+}
+
+func (u *User) Balance() Balance {
+	return Balance{Current: u.CurrentBalance, Held: u.Held, Withdrawn: u.Withdrawn}
+}
+
+func (u *User) newWithdraw(numberOrder string, sum int) (*Withdraw, error) {
 	for _, order := range u.Withdraws {
 		if order.Number == numberOrder {
 			return order, ErrOrderAlreadyExistsForUser
@@ -58,14 +95,18 @@ func (u *User) AddWithdrawn(numberOrder string, sum int) (*Withdraw, error) {
 	if u.CurrentBalance == 0 || u.CurrentBalance < sum {
 		return nil, ErrNotEnoughPoints
 	}
-
-	
 	withdraw, err := NewWithdraw(numberOrder, sum)
 	if err != nil {
 		return nil, err
 	}
-	u.Withdraws = append(u.Withdraws, withdraw)
-	u.CurrentBalance -= sum
-	u.Withdrawn += sum
+	withdraw.UserID = strconv.FormatUint(uint64(u.ID), 10)
 	return withdraw, nil
-}
\ No newline at end of file
+}
+
+func (u *User) applyWithdraw(withdraw *Withdraw) {
+	delta := withdraw.Delta()
+	u.Withdraws = append(u.Withdraws, withdraw)
+	u.CurrentBalance += delta.Current
+	u.Held += delta.Held
+	u.Withdrawn += delta.Withdrawn
+}
@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Webhook is an endpoint of a user or partner that is notified when one of
+// the user's orders becomes PROCESSED or INVALID. Payloads are signed with
+// the secret, which is shown once on creation.
+type Webhook struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	URL       string    `gorm:"not null" json:"url"`
+	Secret    string    `gorm:"not null" json:"-"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at" time_format:"rfc3339"`
+}
+
+func NewWebhook(userID uint, rawURL string) (*Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+	// A host name is checked when it is resolved, on every delivery.
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !PublicAddress(addr) {
+		return nil, ErrWebhookAddressNotAllowed
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &Webhook{
+		UserID: userID,
+		URL:    u.String(),
+		Secret: "whsec_" + hex.EncodeToString(secret),
+	}, nil
+}
+
+// PublicAddress reports whether webhooks may be delivered to addr. The
+// loopback, link-local (cloud metadata services among them), private,
+// shared, unspecified and multicast addresses all belong to the host or
+// its network rather than to the partner.
+func PublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>". The timestamp
+// is part of the signature so that a captured request can't be replayed
+// later with a new one.
+func (w *Webhook) Sign(timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookPayload is the body posted to webhooks. The ID stays the same
+// across retries and replays, so receivers can drop duplicates.
+type WebhookPayload struct {
+	ID        string    `json:"id"`
+	Type      EventType `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Order     *Order    `json:"order"`
+}
+
+func NewOrderWebhookPayload(order *Order) (json.RawMessage, string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	event := NewOrderEvent(order)
+	payload := WebhookPayload{
+		ID:        hex.EncodeToString(raw),
+		Type:      event.Type,
+		CreatedAt: time.Now().UTC(),
+		Order:     order,
+	}
+	body, err := json.Marshal(payload)
+	return body, payload.ID, err
+}
+
+// WebhookDelivery is the log entry of one delivery attempt.
+type WebhookDelivery struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	WebhookID  uint            `gorm:"not null;index" json:"webhook_id"`
+	UserID     uint            `gorm:"not null;index" json:"-"`
+	EventID    string          `gorm:"not null;index" json:"event_id"`
+	Payload    json.RawMessage `gorm:"not null" json:"-"`
+	Attempt    int             `json:"attempt"`
+	StatusCode int             `json:"status_code,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Success    bool            `json:"success"`
+	DurationMs int64           `json:"duration_ms"`
+	CreatedAt  time.Time       `gorm:"autoCreateTime" json:"created_at" time_format:"rfc3339"`
+}
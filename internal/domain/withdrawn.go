@@ -6,12 +6,26 @@ import (
 	"github.com/OrtemRepos/go_store/internal/common/luhn"
 )
 
+type withdrawStatus string
+
+const (
+	// HELD points are reserved for the withdrawal until it is confirmed,
+	// cancelled or the hold expires.
+	HELD      withdrawStatus = "HELD"
+	CONFIRMED withdrawStatus = "CONFIRMED"
+	CANCELLED withdrawStatus = "CANCELLED"
+	EXPIRED   withdrawStatus = "EXPIRED"
+)
+
 type Withdraw struct {
-	ID        uint      `gorm:"primaryKey" json:"-"`
-	Number    string    `gorm:"uniqueIndex;not null" json:"number"`
-	UserID    string    `gorm:"not null;index" json:"-"`
-	Sum       int       `json:"sum"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at" time_format:"rfc3339"`
+	ID         uint           `gorm:"primaryKey" json:"-"`
+	Number     string         `gorm:"uniqueIndex;not null" json:"number"`
+	UserID     string         `gorm:"not null;index;index:idx_withdraws_user_created,priority:1" json:"-"`
+	Sum        int            `json:"sum"`
+	Status     withdrawStatus `gorm:"not null;default:CONFIRMED;index:idx_withdraws_status_expires,priority:1" json:"status"`
+	ExpiresAt  *time.Time     `gorm:"index:idx_withdraws_status_expires,priority:2" json:"expires_at,omitempty" time_format:"rfc3339"`
+	ResolvedAt *time.Time     `json:"resolved_at,omitempty" time_format:"rfc3339"`
+	CreatedAt  time.Time      `gorm:"autoCreateTime;index:idx_withdraws_user_created,priority:2" json:"created_at" time_format:"rfc3339"`
 }
 
 func NewWithdraw(number string, sum int) (*Withdraw, error) {
@@ -20,6 +34,56 @@ func NewWithdraw(number string, sum int) (*Withdraw, error) {
 	}
 	return &Withdraw{
 		Number: number,
-		Sum: sum,
+		Sum:    sum,
+		Status: CONFIRMED,
 	}, nil
-}
\ No newline at end of file
+}
+
+// Delta is the change of the owner's balance caused by creating the
+// withdrawal.
+func (w *Withdraw) Delta() Balance {
+	if w.Status == HELD {
+		return Balance{Current: -w.Sum, Held: w.Sum}
+	}
+	return Balance{Current: -w.Sum, Withdrawn: w.Sum}
+}
+
+// Confirm turns the held points into withdrawn ones. A hold can't be
+// confirmed after it expired, even if it has not been released yet.
+func (w *Withdraw) Confirm(now time.Time) (Balance, error) {
+	if w.Status != HELD {
+		return Balance{}, ErrWithdrawalNotHeld
+	}
+	if w.ExpiresAt != nil && !now.Before(*w.ExpiresAt) {
+		return Balance{}, ErrWithdrawalHoldExpired
+	}
+	w.resolve(CONFIRMED, now)
+	return Balance{Held: -w.Sum, Withdrawn: w.Sum}, nil
+}
+
+// Cancel returns the held points to the current balance.
+func (w *Withdraw) Cancel(now time.Time) (Balance, error) {
+	if w.Status != HELD {
+		return Balance{}, ErrWithdrawalNotHeld
+	}
+	w.resolve(CANCELLED, now)
+	return Balance{Current: w.Sum, Held: -w.Sum}, nil
+}
+
+// Expire releases the points of a hold that was neither confirmed nor
+// cancelled in time.
+func (w *Withdraw) Expire(now time.Time) (Balance, error) {
+	if w.Status != HELD {
+		return Balance{}, ErrWithdrawalNotHeld
+	}
+	if w.ExpiresAt == nil || now.Before(*w.ExpiresAt) {
+		return Balance{}, ErrWithdrawalHoldActive
+	}
+	w.resolve(EXPIRED, now)
+	return Balance{Current: w.Sum, Held: -w.Sum}, nil
+}
+
+func (w *Withdraw) resolve(status withdrawStatus, now time.Time) {
+	w.Status = status
+	w.ResolvedAt = &now
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// AccessLog logs every request once it is served, with the request ID of
+// the tracing middleware, which must run first. Server errors are logged
+// as errors and client errors as warnings. The query string is left out,
+// it may carry tokens.
+func AccessLog(logger *zap.Logger) gin.HandlerFunc {
+	// The caller and the stack trace would always point here.
+	logger = logger.WithOptions(zap.WithCaller(false), zap.AddStacktrace(zapcore.PanicLevel))
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.String("route", c.FullPath()),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int("bytes", max(c.Writer.Size(), 0)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+		}
+		if errs := c.Errors.ByType(gin.ErrorTypePrivate); len(errs) > 0 {
+			fields = append(fields, zap.String("errors", errs.String()))
+		}
+		log := tracing.Logger(c.Request.Context(), logger)
+		switch {
+		case status >= http.StatusInternalServerError:
+			log.Error("request", fields...)
+		case status >= http.StatusBadRequest:
+			log.Warn("request", fields...)
+		default:
+			log.Info("request", fields...)
+		}
+	}
+}
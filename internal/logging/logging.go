@@ -0,0 +1,64 @@
+// Package logging builds the application logger from the configuration and
+// logs the HTTP requests. Every logger it builds redacts secrets from the
+// messages and fields it writes.
+package logging
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/OrtemRepos/go_store/configs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// New returns the logger of the log section of cfg: the lines of the
+// configured level and above, as JSON or console text, written to stderr
+// or to a file rotated by size. Sampling, when enabled, keeps a burst of
+// the same line from flooding the output.
+func New(cfg *configs.Config) (*zap.Logger, error) {
+	level, err := zapcore.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level: %w", err)
+	}
+
+	var encoder zapcore.Encoder
+	switch cfg.Log.Format {
+	case "json":
+		encoder = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	case "console":
+		encCfg := zap.NewDevelopmentEncoderConfig()
+		encCfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		if cfg.Log.File != "" {
+			encCfg.EncodeLevel = zapcore.CapitalLevelEncoder
+		}
+		encoder = zapcore.NewConsoleEncoder(encCfg)
+	default:
+		return nil, fmt.Errorf("unsupported log format: %q", cfg.Log.Format)
+	}
+
+	output := zapcore.Lock(os.Stderr)
+	if cfg.Log.File != "" {
+		output = zapcore.AddSync(&lumberjack.Logger{
+			Filename:   cfg.Log.File,
+			MaxSize:    cfg.Log.MaxSize,
+			MaxBackups: cfg.Log.MaxBackups,
+			MaxAge:     cfg.Log.MaxAge,
+			Compress:   cfg.Log.Compress,
+		})
+	}
+
+	core := redact(zapcore.NewCore(encoder, output, level))
+	if cfg.Log.SamplingInitial > 0 {
+		core = zapcore.NewSamplerWithOptions(
+			core, time.Second, cfg.Log.SamplingInitial, cfg.Log.SamplingThereafter,
+		)
+	}
+	opts := []zap.Option{zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)}
+	if level == zapcore.DebugLevel {
+		opts = append(opts, zap.Development())
+	}
+	return zap.New(core, opts...), nil
+}
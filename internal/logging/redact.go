@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeys are the parts of field names whose values are never logged.
+var secretKeys = []string{
+	"password", "passwd", "secret", "token", "dsn",
+	"authorization", "cookie", "apikey", "api_key",
+}
+
+// secretValues find secrets inside text: key=value pairs of connection
+// strings, passwords in URLs and JWTs.
+var secretValues = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?i)\b(password|passwd|pwd|secret|token)=("[^"]*"|'[^']*'|[^\s&;]+)`), "${1}=" + redacted},
+	{regexp.MustCompile(`(\b[a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]+):[^@\s]+@`), "${1}:" + redacted + "@"},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), redacted},
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactString(s string) string {
+	for _, v := range secretValues {
+		s = v.re.ReplaceAllString(s, v.repl)
+	}
+	return s
+}
+
+// redactCore removes secrets from the message and the fields of every
+// entry before the wrapped core encodes it.
+type redactCore struct {
+	zapcore.Core
+}
+
+func redact(core zapcore.Core) zapcore.Core {
+	return redactCore{core}
+}
+
+func (c redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactCore{c.Core.With(redactFields(fields))}
+}
+
+func (c redactCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = redactString(entry.Message)
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		out[i] = redactField(f)
+	}
+	return out
+}
+
+func redactField(f zapcore.Field) zapcore.Field {
+	if f.Type == zapcore.NamespaceType || f.Type == zapcore.SkipType {
+		return f
+	}
+	if isSecretKey(f.Key) {
+		return zap.String(f.Key, redacted)
+	}
+	switch f.Type {
+	case zapcore.StringType:
+		if s := redactString(f.String); s != f.String {
+			return zap.String(f.Key, s)
+		}
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok && err != nil {
+			msg := err.Error()
+			if s := redactString(msg); s != msg {
+				return zap.String(f.Key, s)
+			}
+		}
+	case zapcore.StringerType:
+		if s, ok := stringOf(f.Interface); ok {
+			return zap.String(f.Key, redactString(s))
+		}
+	case zapcore.ReflectType:
+		return redactReflect(f)
+	}
+	return f
+}
+
+// stringOf calls String and, like the encoder, gives up instead of
+// panicking if String does, e.g. on a nil receiver.
+func stringOf(v interface{}) (s string, ok bool) {
+	stringer, ok := v.(fmt.Stringer)
+	if !ok {
+		return "", false
+	}
+	defer func() {
+		if recover() != nil {
+			s, ok = "", false
+		}
+	}()
+	return stringer.String(), true
+}
+
+// redactReflect redacts a value logged with zap.Any by way of its JSON
+// form, the one the encoder would write anyway.
+func redactReflect(f zapcore.Field) zapcore.Field {
+	data, err := json.Marshal(f.Interface)
+	if err != nil {
+		return f
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return f
+	}
+	return zap.Any(f.Key, redactValue(v))
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if isSecretKey(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	case string:
+		return redactString(v)
+	}
+	return v
+}
@@ -0,0 +1,13 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+// AccrualSystem tells the status and accrual of an order. The raw response
+// is returned as well, it is kept in the order status history.
+type AccrualSystem interface {
+	OrderInfo(ctx context.Context, order domain.Order) (*domain.Order, []byte, error)
+}
@@ -0,0 +1,16 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type APIKeyStorage interface {
+	Save(ctx context.Context, key *domain.APIKey) error
+	GetByHash(ctx context.Context, keyHash string) (*domain.APIKey, error)
+	ListByUser(ctx context.Context, userID uint) ([]*domain.APIKey, error)
+	Revoke(ctx context.Context, userID, id uint) error
+	TouchLastUsed(ctx context.Context, id uint, at time.Time) error
+}
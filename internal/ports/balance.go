@@ -0,0 +1,8 @@
+package ports
+
+import "context"
+
+// BalanceListener is told that the balance of a user has changed.
+type BalanceListener interface {
+	BalanceChanged(ctx context.Context, userID uint)
+}
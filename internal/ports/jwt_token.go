@@ -1,14 +1,27 @@
 package ports
 
 import (
+	"time"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// PurposeMFAPending marks a token issued after a correct password for a
+// user with two-factor authentication. It only grants access to the
+// second login step.
+const PurposeMFAPending = "mfa_pending"
+
 type JWT interface {
-	BuildJWTString(id uint) (string, error)
+	// BuildJWTString issues an access token. mfaAt is the time of the last
+	// second factor verification, zero if there was none.
+	BuildJWTString(id uint, sessionVersion int, mfaAt time.Time) (string, error)
+	BuildMFAPendingString(id uint, sessionVersion int) (string, error)
 	GetClaims(tokenString string) (*Claims, error)
 }
 type Claims struct {
 	jwt.RegisteredClaims
-	UserID uint
+	UserID         uint
+	SessionVersion int
+	Purpose        string `json:",omitempty"`
+	MFAAt          int64  `json:",omitempty"`
 }
@@ -0,0 +1,11 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type LoginAudit interface {
+	RecordFailedLogin(ctx context.Context, attempt *domain.FailedLogin) error
+}
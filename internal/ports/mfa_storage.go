@@ -0,0 +1,16 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type MFAStorage interface {
+	// UpdateTOTP writes only the TOTP columns of the user.
+	UpdateTOTP(ctx context.Context, user *domain.User) error
+	ReplaceRecoveryCodes(ctx context.Context, userID uint, codes []*domain.RecoveryCode) error
+	// UseRecoveryCode marks the code as used. It returns
+	// domain.ErrInvalidMFACode if the code is unknown or already used.
+	UseRecoveryCode(ctx context.Context, userID uint, codeHash string) error
+}
@@ -0,0 +1,11 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type Notifier interface {
+	Notify(ctx context.Context, notification domain.Notification) error
+}
@@ -0,0 +1,13 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type OrderHistory interface {
+	Add(ctx context.Context, change *domain.OrderStatusChange) error
+	// List returns the changes of an order, oldest first.
+	List(ctx context.Context, number string) ([]*domain.OrderStatusChange, error)
+}
@@ -0,0 +1,30 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type OrderRepository interface {
+	// Create returns domain.ErrOrderConflict if the number is already taken.
+	Create(ctx context.Context, order *domain.Order) error
+	GetByNumber(ctx context.Context, number string) (*domain.Order, error)
+	List(ctx context.Context, userID uint, query domain.ListQuery) (*domain.Page[*domain.Order], error)
+	// Complete stores the final status and accrual of a not yet completed
+	// order. It returns domain.ErrOrderAlreadyCompleted if the order has
+	// already been completed, so the accrual is never credited twice.
+	Complete(ctx context.Context, order *domain.Order) error
+	// MarkNeedsAttention stores the NEEDS_ATTENTION status and the failure
+	// of a not yet completed order. It returns
+	// domain.ErrOrderAlreadyCompleted if the order has been completed.
+	MarkNeedsAttention(ctx context.Context, order *domain.Order) error
+	// Correct replaces the status and accrual of a completed order. It
+	// fails with domain.ErrOrderChanged if they are no longer the ones of
+	// previous, so a correction is never applied twice.
+	Correct(ctx context.Context, previous, order *domain.Order) error
+	// ListAll returns a page of the orders of every user.
+	ListAll(ctx context.Context, query domain.ListQuery) (*domain.Page[*domain.Order], error)
+	// Accrued sums the accruals of the processed orders of the user.
+	Accrued(ctx context.Context, userID uint) (int, error)
+}
@@ -0,0 +1,33 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type Outbox interface {
+	Add(ctx context.Context, events ...*domain.Event) error
+	// Pending returns up to limit unpublished events with an ID greater
+	// than afterID in the order they were added. Dead events are left out.
+	Pending(ctx context.Context, afterID uint, limit int) ([]*domain.Event, error)
+	// Committed returns up to limit events with an ID greater than afterID,
+	// published, dead or not, in the order they were added. Only their ID
+	// and CreatedAt are loaded.
+	Committed(ctx context.Context, afterID uint, limit int) ([]*domain.Event, error)
+	MarkPublished(ctx context.Context, id uint, at time.Time) error
+	// MarkFailed records a failed attempt; the event stays pending and is
+	// published again no earlier than retryAt.
+	MarkFailed(ctx context.Context, id uint, reason string, retryAt time.Time) error
+	// MarkDead records the last failed attempt; the event is no longer
+	// pending.
+	MarkDead(ctx context.Context, id uint, reason string, at time.Time) error
+}
+
+// EventPublisher delivers events outside go_store. Delivery is at least
+// once: an event may be published again if marking it as published fails,
+// so consumers should deduplicate by the event ID.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *domain.Event) error
+}
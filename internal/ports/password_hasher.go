@@ -0,0 +1,11 @@
+package ports
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify accepts hashes produced by any supported algorithm,
+	// not only the configured one.
+	Verify(hash, password string) (bool, error)
+	// NeedsRehash reports whether the hash was produced with another
+	// algorithm, outdated parameters or without the current pepper.
+	NeedsRehash(hash string) bool
+}
@@ -0,0 +1,15 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type PasswordResetStorage interface {
+	Save(ctx context.Context, token *domain.PasswordResetToken) error
+	// Consume marks the token as used and returns it. It returns
+	// domain.ErrResetTokenInvalid if the token is unknown, used or expired.
+	Consume(ctx context.Context, tokenHash string) (*domain.PasswordResetToken, error)
+	DeleteForUser(ctx context.Context, userID uint) error
+}
@@ -0,0 +1,32 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type PointLots interface {
+	Add(ctx context.Context, lot *domain.PointLot) error
+	// Available returns the lots of the user with points left, the ones
+	// that expire first first.
+	Available(ctx context.Context, userID uint) ([]*domain.PointLot, error)
+	// Take stores the usages and takes their points from the lots.
+	Take(ctx context.Context, usages []*domain.PointLotUsage) error
+	// Release puts the points taken for the withdrawal back into the lots.
+	Release(ctx context.Context, number string) error
+	// ListExpired returns up to limit lots with points left that expired by
+	// now, the ones that expired first first, starting after the lot after
+	// or from the first one if it is nil.
+	ListExpired(ctx context.Context, now time.Time, after *domain.PointLot, limit int) ([]*domain.PointLot, error)
+	// Expire stores the expiry and empties its lot. It fails with
+	// domain.ErrPointLotChanged if the lot no longer has remaining points
+	// left, e.g. because a withdrawal took some meanwhile.
+	Expire(ctx context.Context, expiry *domain.PointExpiry, remaining int) error
+	// Upcoming returns the lots of the user with points left that expire
+	// before until.
+	Upcoming(ctx context.Context, userID uint, until time.Time) ([]*domain.PointLot, error)
+	// Expired sums the points of the user that have expired.
+	Expired(ctx context.Context, userID uint) (int, error)
+}
@@ -0,0 +1,18 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type TransferRepository interface {
+	Create(ctx context.Context, transfer *domain.Transfer) error
+	// SentSince sums the transfers the user has sent since the given time.
+	SentSince(ctx context.Context, userID uint, since time.Time) (domain.TransferTotals, error)
+	// List returns the transfers the user has sent or received.
+	List(ctx context.Context, userID uint, query domain.ListQuery) (*domain.Page[*domain.Transfer], error)
+	// Net sums the points the user has received less the ones sent.
+	Net(ctx context.Context, userID uint) (int, error)
+}
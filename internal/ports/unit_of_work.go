@@ -0,0 +1,21 @@
+package ports
+
+import "context"
+
+// Repositories are bound to one transaction of a UnitOfWork.
+type Repositories struct {
+	Users       UserStorage
+	Orders      OrderRepository
+	Withdrawals WithdrawalRepository
+	Outbox      Outbox
+	History     OrderHistory
+	Lots        PointLots
+	Transfers   TransferRepository
+}
+
+type UnitOfWork interface {
+	// Do runs fn in a transaction. It is committed if fn returns nil
+	// and rolled back otherwise. Failures of the storage that may not
+	// happen again are returned as domain.TransientError.
+	Do(ctx context.Context, fn func(repos Repositories) error) error
+}
@@ -1,11 +1,24 @@
 package ports
 
-import "github.com/OrtemRepos/go_store/internal/domain"
+import (
+	"context"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
 
 type UserStorage interface {
-	GetByID(id uint) (*domain.User, error)
-	GetByEmail(email string) (*domain.User, error)
-	AddAccural(id uint, accural int) error
-	UserBalance(id uint) (int, int, error)
-	Save(user *domain.User) error
+	GetByID(ctx context.Context, id uint) (*domain.User, error)
+	GetByEmail(ctx context.Context, email string) (*domain.User, error)
+	AddAccural(ctx context.Context, id uint, accural int) error
+	UserBalance(ctx context.Context, id uint) (domain.Balance, error)
+	// LockBalance returns the balance and keeps the user row locked until
+	// the transaction ends, so no other change of the balance interleaves.
+	LockBalance(ctx context.Context, id uint) (domain.Balance, error)
+	// AdjustBalance adds delta to the balance in one statement. It fails
+	// with domain.ErrNotEnoughPoints if the current or held points would
+	// become negative.
+	AdjustBalance(ctx context.Context, id uint, delta domain.Balance) error
+	SessionVersion(ctx context.Context, id uint) (int, error)
+	Save(ctx context.Context, user *domain.User) error
+	UpdatePassword(ctx context.Context, user *domain.User) error
 }
@@ -0,0 +1,29 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type WebhookStorage interface {
+	Save(ctx context.Context, webhook *domain.Webhook) error
+	// Get returns domain.ErrWebhookNotFound if the webhook does not exist
+	// or belongs to another user.
+	Get(ctx context.Context, userID, id uint) (*domain.Webhook, error)
+	ListByUser(ctx context.Context, userID uint) ([]*domain.Webhook, error)
+	Delete(ctx context.Context, userID, id uint) error
+	SaveDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error
+	// GetDelivery returns domain.ErrWebhookDeliveryNotFound if the delivery
+	// does not exist or belongs to another user.
+	GetDelivery(ctx context.Context, userID, id uint) (*domain.WebhookDelivery, error)
+	// ListDeliveries returns the latest deliveries of a webhook first.
+	ListDeliveries(ctx context.Context, userID, webhookID uint, limit int) ([]*domain.WebhookDelivery, error)
+}
+
+// OrderStatusListener is told about orders that have just been completed
+// as PROCESSED or INVALID, and about orders that have just been marked
+// NEEDS_ATTENTION.
+type OrderStatusListener interface {
+	OrderStatusChanged(ctx context.Context, order *domain.Order)
+}
@@ -0,0 +1,18 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+)
+
+type WithdrawalRepository interface {
+	Create(ctx context.Context, withdraw *domain.Withdraw) error
+	GetByNumber(ctx context.Context, number string) (*domain.Withdraw, error)
+	List(ctx context.Context, userID uint, query domain.ListQuery) (*domain.Page[*domain.Withdraw], error)
+	// Resolve stores the new status of a held withdrawal. It fails with
+	// domain.ErrWithdrawalNotHeld if the hold was resolved in the meantime.
+	Resolve(ctx context.Context, withdraw *domain.Withdraw) error
+	ListExpiredHolds(ctx context.Context, now time.Time, limit int) ([]*domain.Withdraw, error)
+}
@@ -0,0 +1,294 @@
+package orderservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"go.uber.org/zap"
+)
+
+// reconciliationSource is the source of the lots of points credited to
+// fix a balance.
+const reconciliationSource = "reconciliation"
+
+// Reconciler asks the accrual system again about the orders created in a
+// date range and compares the answers with the local orders, then checks
+// that the balances of their users add up to the ledger. With fix set,
+// points a user is missing are credited; anything else is only reported.
+type Reconciler struct {
+	orders    *OrderService
+	listeners []ports.BalanceListener
+	batchSize int
+	fix       bool
+	reportDir string
+	interval  time.Duration
+	window    time.Duration
+	minAge    time.Duration
+	queued    atomic.Bool
+	logger    *zap.Logger
+}
+
+// The periodic job checks the orders created in the last window, except
+// the ones younger than minAge that may still be processed. Its reports are
+// written to reportDir, or only logged if it is empty.
+func NewReconciler(logger *zap.Logger, orders *OrderService, listeners []ports.BalanceListener, batchSize int, fix bool, reportDir string, interval, window, minAge time.Duration) (*Reconciler, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger[zap.Logger] is a mandatory dependency")
+	}
+	if orders == nil {
+		return nil, fmt.Errorf("orders[OrderService] is a mandatory dependency")
+	}
+	if orders.rulesMode == RulesReplace {
+		return nil, fmt.Errorf("orders[OrderService] doesn't use the accrual system in the %s mode", RulesReplace)
+	}
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batchSize[int] must be greater than zero")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval[time.Duration] must be greater than zero")
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("window[time.Duration] must be greater than zero")
+	}
+	if minAge < 0 {
+		return nil, fmt.Errorf("minAge[time.Duration] must be a non-negative duration")
+	}
+	return &Reconciler{
+		orders:    orders,
+		listeners: listeners,
+		batchSize: batchSize,
+		fix:       fix,
+		reportDir: reportDir,
+		interval:  interval,
+		window:    window,
+		minAge:    minAge,
+		logger:    logger.Named("reconciler"),
+	}, nil
+}
+
+// Run submits the reconciliation job to the worker pool every interval
+// until ctx is done. A job is not submitted while the previous one is
+// still queued or running.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !r.queued.CompareAndSwap(false, true) {
+			continue
+		}
+		if err := r.orders.wp.Submit(ctx, &reconcileTask{r: r}); err != nil {
+			r.queued.Store(false)
+			r.logger.Warn("can't submit the reconciliation job", zap.Error(err))
+		}
+	}
+}
+
+// Reconcile checks the orders created from from until to. The report is
+// returned with what was checked so far even if it fails.
+func (r *Reconciler) Reconcile(ctx context.Context, from, to time.Time) (*domain.ReconciliationReport, error) {
+	report := &domain.ReconciliationReport{
+		From:          from,
+		To:            to,
+		Fix:           r.fix,
+		StartedAt:     time.Now(),
+		Discrepancies: []*domain.Discrepancy{},
+	}
+	defer func() { report.FinishedAt = time.Now() }()
+	users := make(map[uint]bool)
+	query := domain.ListQuery{Limit: r.batchSize, Sort: domain.SortAsc, From: &from, To: &to}
+	for {
+		page, err := r.orders.orders.ListAll(ctx, query)
+		if err != nil {
+			return report, err
+		}
+		for _, order := range page.Items {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			report.Orders++
+			users[order.UserID] = true
+			if d := r.checkOrder(ctx, order); d != nil {
+				report.Discrepancies = append(report.Discrepancies, d)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		last := page.Items[len(page.Items)-1]
+		query.Cursor = &domain.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	ids := make([]uint, 0, len(users))
+	for id := range users {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Users++
+		if d := r.checkBalance(ctx, id); d != nil {
+			report.Discrepancies = append(report.Discrepancies, d)
+		}
+	}
+	return report, nil
+}
+
+func (r *Reconciler) checkOrder(ctx context.Context, order *domain.Order) *domain.Discrepancy {
+	remote, response, err := r.orders.client.getOrderInfo(ctx, order.Number)
+	if errors.Is(err, ErrNotFound) {
+		return &domain.Discrepancy{
+			Kind:        domain.UNKNOWN_ORDER,
+			UserID:      order.UserID,
+			Number:      order.Number,
+			LocalStatus: order.Status,
+		}
+	} else if err != nil {
+		return &domain.Discrepancy{
+			Kind:   domain.CHECK_FAILED,
+			UserID: order.UserID,
+			Number: order.Number,
+			Error:  err.Error(),
+		}
+	}
+	remote.UserID = order.UserID
+	remote.Number = order.Number
+	remote.CreatedAt = order.CreatedAt
+	remote.Amount = order.Amount
+	d := domain.CompareOrder(order, remote)
+	if d == nil || !r.fix || !remote.Status.Final() || (order.Completed && d.Missing() <= 0) {
+		return d
+	}
+	if order.Completed {
+		err = r.orders.correct(ctx, order, remote, response, d.Missing())
+	} else {
+		err = r.orders.complete(ctx, remote, response)
+	}
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	d.Fixed = true
+	r.orders.statusChanged(ctx, remote)
+	return d
+}
+
+// checkBalance compares the balance with the ledger while the user row is
+// locked, so a concurrent accrual, withdrawal or transfer can't make them
+// look different.
+func (r *Reconciler) checkBalance(ctx context.Context, userID uint) *domain.Discrepancy {
+	var d *domain.Discrepancy
+	err := r.orders.uow.Do(ctx, func(repos ports.Repositories) error {
+		d = nil
+		balance, err := repos.Users.LockBalance(ctx, userID)
+		if err != nil {
+			return err
+		}
+		var ledger domain.Ledger
+		if ledger.Accrued, err = repos.Orders.Accrued(ctx, userID); err != nil {
+			return err
+		}
+		if ledger.Transferred, err = repos.Transfers.Net(ctx, userID); err != nil {
+			return err
+		}
+		if ledger.Expired, err = repos.Lots.Expired(ctx, userID); err != nil {
+			return err
+		}
+		d = domain.CompareBalance(userID, balance, ledger)
+		if d == nil || !r.fix || d.Missing() <= 0 {
+			return nil
+		}
+		if err := repos.Users.AdjustBalance(ctx, userID, domain.Balance{Current: d.Missing()}); err != nil {
+			return err
+		}
+		// The credited points expire like the accruals they stand for.
+		if r.orders.pointsValidMonths > 0 {
+			lot := domain.NewPointLot(userID, reconciliationSource, d.Missing(), time.Now(), r.orders.pointsValidMonths)
+			if err := repos.Lots.Add(ctx, lot); err != nil {
+				return err
+			}
+		}
+		d.Fixed = true
+		return repos.Outbox.Add(ctx, domain.NewBalanceCorrectedEvent(d))
+	})
+	if err != nil {
+		if d == nil {
+			d = &domain.Discrepancy{Kind: domain.CHECK_FAILED, UserID: userID}
+		}
+		d.Fixed = false
+		d.Error = err.Error()
+		return d
+	}
+	if d != nil && d.Fixed {
+		for _, listener := range r.listeners {
+			listener.BalanceChanged(ctx, userID)
+		}
+	}
+	return d
+}
+
+// report logs the summary and every discrepancy, and writes the report to
+// the report directory if there is one.
+func (r *Reconciler) report(report *domain.ReconciliationReport) {
+	r.logger.Info("orders reconciled",
+		zap.Time("from", report.From),
+		zap.Time("to", report.To),
+		zap.Int("orders", report.Orders),
+		zap.Int("users", report.Users),
+		zap.Int("discrepancies", len(report.Discrepancies)),
+		zap.Int("unresolved", report.Unresolved()),
+	)
+	for _, d := range report.Discrepancies {
+		r.logger.Warn("reconciliation discrepancy", zap.Any("discrepancy", d))
+	}
+	if r.reportDir == "" {
+		return
+	}
+	if err := WriteReport(r.reportDir, report); err != nil {
+		r.logger.Error("can't write the reconciliation report", zap.Error(err))
+	}
+}
+
+// WriteReport writes the report as JSON to a file of dir named after the
+// time the reconciliation started.
+func WriteReport(dir string, report *domain.ReconciliationReport) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("reconciliation-%s.json", report.StartedAt.UTC().Format("20060102T150405Z"))
+	return os.WriteFile(filepath.Join(dir, name), data, 0o644)
+}
+
+type reconcileTask struct {
+	r *Reconciler
+}
+
+func (t *reconcileTask) Execute(ctx context.Context) error {
+	defer t.r.queued.Store(false)
+	to := time.Now().Add(-t.r.minAge)
+	report, err := t.r.Reconcile(ctx, to.Add(-t.r.window), to)
+	t.r.report(report)
+	return err
+}
+
+func (t *reconcileTask) Stringer() string {
+	return "reconcile orders"
+}
@@ -5,25 +5,43 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/OrtemRepos/go_store/internal/domain"
 	"github.com/OrtemRepos/go_store/internal/ports"
+	"github.com/OrtemRepos/go_store/internal/tracing"
 	"github.com/OrtemRepos/go_store/internal/worker-pool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
+// maxResponseSize limits the body read from the accrual system.
+const maxResponseSize = 64 << 10
+
 var (
 	ErrInternalServerError = errors.New("internal server error")
-	ErrRequestTimeout = errors.New("timeout request")
-	ErrGatewayTimeout = errors.New("timeout gateway")
-	ErrNotFound = errors.New("order not found")
-	ErrMaxRetry = errors.New("max retries exceeded")
-	ErrBufferFull = errors.New("buffer full")
+	ErrRequestTimeout      = errors.New("timeout request")
+	ErrGatewayTimeout      = errors.New("timeout gateway")
+	ErrServiceUnavailable  = errors.New("service unavailable")
+	ErrNotFound            = errors.New("order not found")
+	ErrMaxRetry            = errors.New("max retries exceeded")
+	ErrBufferFull          = errors.New("buffer full")
+)
+
+// RulesMode tells how the local accrual rules are used.
+type RulesMode string
+
+const (
+	RulesOff RulesMode = "off"
+	// RulesFallback asks the local rules when the accrual system can't be
+	// reached or keeps failing.
+	RulesFallback RulesMode = "fallback"
+	// RulesReplace asks only the local rules.
+	RulesReplace RulesMode = "replace"
 )
 
 type RetryableError struct {
@@ -43,68 +61,92 @@ type client struct {
 	logger     *zap.Logger
 }
 
-func newClient(baseURL string, maxRetries, retryDelay int, logger *zap.Logger) *client {
+func newClient(baseURL string, timeout time.Duration, maxRetries, retryDelay int, logger *zap.Logger) *client {
 	return &client{
 		BaseURL:    baseURL,
-		HTTPClient: &http.Client{Timeout: time.Second * 10},
+		HTTPClient: &http.Client{Timeout: timeout},
 		MaxRetries: maxRetries,
 		RetryDelay: time.Millisecond * time.Duration(retryDelay),
 		logger: logger,
 	}
 }
 
-func NewOrderService(db *gorm.DB, logger *zap.Logger, wp worker.WorkerPool, userStorage ports.UserStorage, accuralAddress string, maxRetries, retryDelay int) (*OrderService, error) {
-	client := newClient(accuralAddress, maxRetries, retryDelay, logger)
+// statusListeners are told about every order this service completes.
+// Accrued points expire after pointsValidMonths; zero or less keeps them
+// forever. rules is the local accrual system used as rulesMode tells; it
+// may be nil with RulesOff. A request to the accrual system is abandoned
+// after accrualTimeout, or earlier if the context of the caller is done.
+func NewOrderService(logger *zap.Logger, wp worker.WorkerPool, orders ports.OrderRepository, uow ports.UnitOfWork, statusListeners []ports.OrderStatusListener, accuralAddress string, accrualTimeout time.Duration, maxRetries, retryDelay, pointsValidMonths int, rules ports.AccrualSystem, rulesMode RulesMode) (*OrderService, error) {
+	client := newClient(accuralAddress, accrualTimeout, maxRetries, retryDelay, logger)
 	if wp == nil {
 		return nil, fmt.Errorf("WorkerPool[worker.WorkerPool] is a mandatory dependency")
 	}
-	if db == nil {
-		return nil, fmt.Errorf("db[gorm.DB] is a mandatory dependency")
+	if orders == nil {
+		return nil, fmt.Errorf("orders[ports.OrderRepository] is a mandatory dependency")
 	}
 	if logger == nil {
 		return nil, fmt.Errorf("logger[zap.Logger] is a mandatory dependency")
 	}
-	if accuralAddress == "" {
+	switch rulesMode {
+	case RulesOff, RulesFallback, RulesReplace:
+	default:
+		return nil, fmt.Errorf("rulesMode[RulesMode] must be one of off, fallback or replace")
+	}
+	if rulesMode != RulesOff && rules == nil {
+		return nil, fmt.Errorf("rules[ports.AccrualSystem] is a mandatory dependency in the %s mode", rulesMode)
+	}
+	if accuralAddress == "" && rulesMode != RulesReplace {
 		return nil, fmt.Errorf("accuralAddress[string] must not be nil or an empty string")
 	}
+	if accrualTimeout <= 0 {
+		return nil, fmt.Errorf("accrualTimeout[time.Duration] must be greater than zero")
+	}
 	if maxRetries < 0 {
 		return nil, fmt.Errorf("maxRetries[int] must be a non-negative number")
 	}
 	if retryDelay <= 0 {
 		return nil, fmt.Errorf("retryDelay[int] must be greater than zero")
 	}
-	if userStorage == nil {
-		return nil, fmt.Errorf("userStorage[ports.UserStorage] is a mandatory dependency")
+	if uow == nil {
+		return nil, fmt.Errorf("uow[ports.UnitOfWork] is a mandatory dependency")
 	}
 
 	os := &OrderService{
-		db: db,
-		logger: logger,
-		client: *client,
-		wp: wp,
-		userStorage: userStorage,
+		orders:            orders,
+		uow:               uow,
+		statusListeners:   statusListeners,
+		pointsValidMonths: pointsValidMonths,
+		rules:             rules,
+		rulesMode:         rulesMode,
+		logger:            logger,
+		client:            *client,
+		wp:                wp,
+		lifetime:          context.Background(),
 	}
 	return os, nil
 }
 
-func (c *client) getOrderInfo(ctx context.Context, orderNumber string) (*domain.Order, error) {
+// getOrderInfo returns the order and the raw response of the accrual
+// system.
+func (c *client) getOrderInfo(ctx context.Context, orderNumber string) (*domain.Order, []byte, error) {
 	url := fmt.Sprintf("http://%s/api/orders/%s", c.BaseURL, orderNumber)
 
 	var order *domain.Order
+	var body []byte
 	var err error
 	retryDelay := c.RetryDelay
 	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
-		order, err = c.doRequest(ctx, url)
+		order, body, err = c.doRequest(ctx, url)
 		if err == nil {
-			return order, nil
+			return order, body, nil
 		}
 		var retrErr *RetryableError
 		if errors.As(err, &retrErr) {
 			retryDelay = retrErr.RetryAfter
 		}
 
-		if !shouldRetry(err) {
-			return nil, err
+		if !domain.IsTransient(err) {
+			return nil, nil, err
 		}
 
 		c.logger.Info("retry", zap.String("url", url), zap.Int("attempt", attempt), zap.Error(err))
@@ -113,32 +155,48 @@ func (c *client) getOrderInfo(ctx context.Context, orderNumber string) (*domain.
 		case <- time.After(retryDelay):
 			retryDelay = c.RetryDelay
 		case <- ctx.Done():
-			return nil, ctx.Err()
+			return nil, nil, ctx.Err()
 		}
 	}
 
-	return nil, fmt.Errorf("maximum number of repeated requests: %w", ErrMaxRetry)
+	return nil, nil, fmt.Errorf("maximum number of repeated requests: %w: %w", ErrMaxRetry, err)
 }
 
-func (c *client) doRequest(ctx context.Context, url string) (*domain.Order, error) {
+// doRequest makes one request in a span of its own and passes the trace
+// context and the request ID on to the accrual system.
+func (c *client) doRequest(ctx context.Context, url string) (_ *domain.Order, _ []byte, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "accrual GET",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", url)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, err
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	} else if err != nil {
+		return nil, nil, domain.Transient(err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	switch resp.StatusCode {
 	case http.StatusOK:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		if err != nil {
+			return nil, nil, domain.Transient(err)
+		}
 		var order domain.Order
-		if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
-			return nil, err
+		if err := json.Unmarshal(body, &order); err != nil {
+			return nil, nil, domain.Permanent(fmt.Errorf("can't decode the accural service response: %w", err))
 		}
-		return &order, nil
+		return &order, body, nil
 	case http.StatusTooManyRequests:
 		retryAfterStr := resp.Header.Get("Retry-After")
 		var retryAfter time.Duration
@@ -154,59 +212,49 @@ func (c *client) doRequest(ctx context.Context, url string) (*domain.Order, erro
 			)
 			retryAfter = 60 * time.Second // Default to 60s
 		}
-		return nil, &RetryableError{
+		return nil, nil, domain.Transient(&RetryableError{
 			RetryAfter: time.Duration(retryAfter),
 			Message:    "too many requests",
-		}
+		})
 	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("accural service error: %w", ErrInternalServerError)
+		return nil, nil, domain.Transient(fmt.Errorf("accural service error: %w", ErrInternalServerError))
 	case http.StatusRequestTimeout:
-		return nil, ErrRequestTimeout
+		return nil, nil, domain.Transient(ErrRequestTimeout)
 	case http.StatusGatewayTimeout:
-		return nil, ErrGatewayTimeout
+		return nil, nil, domain.Transient(ErrGatewayTimeout)
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return nil, nil, domain.Transient(ErrServiceUnavailable)
 	case http.StatusNotFound:
-		return nil, ErrNotFound
+		return nil, nil, domain.Permanent(ErrNotFound)
 	default:
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-}
-
-
-func shouldRetry(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	var retrErr *RetryableError
-	if errors.As(err, &retrErr) {
-		return true
-	}
-
-	netErr, ok := err.(net.Error)
-	if ok && netErr.Timeout() {
-		return true
+		return nil, nil, domain.Permanent(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
 	}
-	
-	return errors.Is(err, ErrInternalServerError) ||
-		errors.Is(err, ErrRequestTimeout) ||
-		errors.Is(err, ErrGatewayTimeout)
 }
 
 
 type OrderService struct {
-	db          *gorm.DB
-	userStorage ports.UserStorage
-	logger      *zap.Logger
-	client      client
-	wp          worker.WorkerPool
-	orderResult    chan domain.Order
+	orders            ports.OrderRepository
+	uow               ports.UnitOfWork
+	statusListeners   []ports.OrderStatusListener
+	pointsValidMonths int
+	rules             ports.AccrualSystem
+	rulesMode         RulesMode
+	logger            *zap.Logger
+	client            client
+	wp                worker.WorkerPool
+	orderResult       chan domain.Order
+	// lifetime is the context of Start; background work stops with it.
+	lifetime context.Context
 }
 
 func (os *OrderService) Metrics() worker.MetricsResult {
 	return os.wp.Metrics()
 }
 
+// Start starts the worker pool. It must be called before the service is
+// used; ctx is the lifetime of the service.
 func (os *OrderService) Start(ctx context.Context) {
+	os.lifetime = ctx
 	os.wp.Start(ctx)
 }
 
@@ -216,83 +264,280 @@ func (os *OrderService) ProcessOrder(ctx context.Context, order domain.Order) (*
 	return os.processOrder(ctx, order, attempt, int(delay))
 }
 
+// processOrder retries transient failures only. An order that fails for
+// good, or keeps failing until the retries run out, is marked as needing
+// attention instead of being left as if it were still processed.
 func (os *OrderService) processOrder(ctx context.Context, order domain.Order, attempt, delay int) (*domain.Order, error) {
-	os.logger.Info("start processing the order", zap.String("number_order", order.Number))
-	remoteOrder, err := os.client.getOrderInfo(ctx, order.Number)
+	logger := tracing.Logger(ctx, os.logger)
+	logger.Info("start processing the order", zap.String("number_order", order.Number))
+	remoteOrder, response, err := os.orderInfo(ctx, order)
 	if err != nil {
-		os.logger.Info("error whan get order from accural system", zap.Error(err))
-		if attempt < os.client.MaxRetries {
-			time.Sleep(os.client.RetryDelay)
+		logger.Info("error whan get order from accural system", zap.Error(err))
+		if domain.IsTransient(err) && attempt < os.client.MaxRetries {
+			if err := sleep(ctx, os.client.RetryDelay); err != nil {
+				return nil, err
+			}
 			return os.processOrder(ctx, order, attempt+1, delay*2)
 		}
-		return nil, err
+		return nil, os.fail(ctx, order, err)
 	}
 	remoteOrder.UserID = order.UserID
-	os.logger.Debug("got order", zap.Any("order", remoteOrder))
-	if remoteOrder.Status == domain.INVALID {
-		remoteOrder.Completed = true
-		err = os.db.Model(&domain.Order{}).Where("number = ?", order.Number).Updates(remoteOrder).Error
-		if err != nil {
-			os.logger.Warn("error when saving invalid order", zap.Error(err))
-			if attempt < os.client.MaxRetries {
-				time.Sleep(time.Duration(delay))
+	remoteOrder.Number = order.Number
+	remoteOrder.CreatedAt = order.CreatedAt
+	remoteOrder.Amount = order.Amount
+	logger.Debug("got order", zap.Any("order", remoteOrder))
+	if remoteOrder.Status.Final() {
+		err = os.complete(ctx, remoteOrder, response)
+		if errors.Is(err, domain.ErrOrderAlreadyCompleted) {
+			return remoteOrder, nil
+		} else if err != nil {
+			logger.Warn("error when saving the completed order",
+				zap.String("status", string(remoteOrder.Status)),
+				zap.Error(err),
+			)
+			if domain.IsTransient(err) && attempt < os.client.MaxRetries {
+				if err := sleep(ctx, time.Duration(delay)); err != nil {
+					return nil, err
+				}
 				return os.processOrder(ctx, order, attempt+1, delay*2)
 			}
-			return nil, errors.Join(err, ErrMaxRetry)
+			return nil, os.fail(ctx, order, err)
 		}
+		os.statusChanged(ctx, remoteOrder)
 		return remoteOrder, nil
-	} else if remoteOrder.Status == domain.PROCESSED {
-		remoteOrder.Completed = true
-		err = os.db.Model(&domain.Order{}).Where("number = ?", remoteOrder.Number).Updates(remoteOrder).Error
-		if err != nil {
-			os.logger.Warn("error when saving processed order", zap.Error(err))
-			if attempt < os.client.MaxRetries {
-				time.Sleep(time.Duration(delay))
-				return os.processOrder(ctx, order, attempt+1, delay)
-			}
-			return nil, errors.Join(err, ErrMaxRetry)
-		}
-		os.logger.Debug("", zap.Int("accural", *remoteOrder.Accural))
-		err = os.userStorage.AddAccural(remoteOrder.UserID, *remoteOrder.Accural)
-		if err != nil {
-			os.logger.Warn("error when add accural", zap.Error(err))
+	}
+	if err := os.recordPending(ctx, remoteOrder, response); err != nil {
+		if !domain.IsTransient(err) {
+			return nil, os.fail(ctx, order, err)
 		}
-		return remoteOrder, nil
+		logger.Warn("error when recording the order status", zap.Error(err))
 	}
 	if attempt < os.client.MaxRetries {
-		time.Sleep(time.Duration(delay))
+		if err := sleep(ctx, time.Duration(delay)); err != nil {
+			return nil, err
+		}
 		return os.processOrder(ctx, order, attempt+1, delay)
 	}
 	return nil, ErrMaxRetry
 }
 
+// sleep waits for d unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fail marks the order as needing attention and tells the status
+// listeners. Nothing is marked if ctx is done: the service is stopping,
+// the order is not failing.
+func (os *OrderService) fail(ctx context.Context, order domain.Order, cause error) error {
+	if ctx.Err() != nil {
+		return cause
+	}
+	logger := tracing.Logger(ctx, os.logger)
+	logger.Error("order needs attention",
+		zap.String("number_order", order.Number),
+		zap.Bool("transient", domain.IsTransient(cause)),
+		zap.Error(cause),
+	)
+	order.Failure = cause.Error()
+	err := os.uow.Do(ctx, func(repos ports.Repositories) error {
+		if err := repos.Orders.MarkNeedsAttention(ctx, &order); err != nil {
+			return err
+		}
+		if err := repos.History.Add(ctx, domain.NewOrderStatusChange(&order, nil)); err != nil {
+			return err
+		}
+		return repos.Outbox.Add(ctx, domain.NewOrderEvent(&order))
+	})
+	if errors.Is(err, domain.ErrOrderAlreadyCompleted) {
+		return cause
+	} else if err != nil {
+		logger.Error("can't mark the order as needing attention", zap.String("number_order", order.Number), zap.Error(err))
+		return errors.Join(cause, err)
+	}
+	os.statusChanged(ctx, &order)
+	return fmt.Errorf("%w: %w", domain.ErrOrderNeedsAttention, cause)
+}
+
+// complete stores the final status of the order. The order is completed
+// and the accrual credited in one transaction, so a crash can't leave one
+// without the other.
+func (os *OrderService) complete(ctx context.Context, order *domain.Order, response []byte) error {
+	return os.uow.Do(ctx, func(repos ports.Repositories) error {
+		if err := repos.Orders.Complete(ctx, order); err != nil {
+			return err
+		}
+		if err := repos.History.Add(ctx, domain.NewOrderStatusChange(order, response)); err != nil {
+			return err
+		}
+		if err := repos.Outbox.Add(ctx, domain.NewOrderEvent(order)); err != nil {
+			return err
+		}
+		if order.Status != domain.PROCESSED || order.Accural == nil {
+			return nil
+		}
+		return os.credit(ctx, repos, order.UserID, order.Number, *order.Accural)
+	})
+}
+
+// credit adds the points accrued for the order to the balance and, if
+// points expire, to a lot of their own.
+func (os *OrderService) credit(ctx context.Context, repos ports.Repositories, userID uint, number string, points int) error {
+	os.logger.Debug("", zap.Int("accural", points))
+	if err := repos.Users.AddAccural(ctx, userID, points); err != nil {
+		return err
+	}
+	if os.pointsValidMonths <= 0 || points <= 0 {
+		return nil
+	}
+	return repos.Lots.Add(ctx, domain.NewPointLot(userID, number, points, time.Now(), os.pointsValidMonths))
+}
+
+// correct replaces the final status of a completed order with the one of
+// the accrual system and credits the missing points.
+func (os *OrderService) correct(ctx context.Context, local, remote *domain.Order, response []byte, missing int) error {
+	return os.uow.Do(ctx, func(repos ports.Repositories) error {
+		if err := repos.Orders.Correct(ctx, local, remote); err != nil {
+			return err
+		}
+		if err := repos.History.Add(ctx, domain.NewOrderStatusChange(remote, response)); err != nil {
+			return err
+		}
+		if err := repos.Outbox.Add(ctx, domain.NewOrderEvent(remote)); err != nil {
+			return err
+		}
+		return os.credit(ctx, repos, remote.UserID, remote.Number, missing)
+	})
+}
+
+// orderInfo asks the accrual system or the local rules, as the rules mode
+// tells. An order the accrual system doesn't know is not given to the
+// fallback, only failures to get an answer are.
+func (os *OrderService) orderInfo(ctx context.Context, order domain.Order) (*domain.Order, []byte, error) {
+	if os.rulesMode == RulesReplace {
+		return os.rules.OrderInfo(ctx, order)
+	}
+	remoteOrder, response, err := os.client.getOrderInfo(ctx, order.Number)
+	if err == nil || os.rulesMode != RulesFallback || errors.Is(err, ErrNotFound) || ctx.Err() != nil {
+		return remoteOrder, response, err
+	}
+	os.logger.Warn("accrual system failed, using the local rules",
+		zap.String("number_order", order.Number),
+		zap.Error(err),
+	)
+	return os.rules.OrderInfo(ctx, order)
+}
+
+// recordPending adds a not yet final status to the history unless it is
+// the same as the last one, so polling doesn't repeat entries.
+func (os *OrderService) recordPending(ctx context.Context, order *domain.Order, response []byte) error {
+	return os.uow.Do(ctx, func(repos ports.Repositories) error {
+		changes, err := repos.History.List(ctx, order.Number)
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 && changes[len(changes)-1].Status == order.Status {
+			return nil
+		}
+		return repos.History.Add(ctx, domain.NewOrderStatusChange(order, response))
+	})
+}
+
+func (os *OrderService) statusChanged(ctx context.Context, order *domain.Order) {
+	for _, listener := range os.statusListeners {
+		listener.OrderStatusChanged(ctx, order)
+	}
+}
+
+// ProcessingOrderTask carries the request ID and the span of the request
+// that queued the order, so the processing is logged and traced as part of
+// that request even though it outlives it.
 type ProcessingOrderTask struct {
-	os      *OrderService
-	order   domain.Order
+	os        *OrderService
+	order     domain.Order
+	requestID string
+	parent    trace.SpanContext
 }
 
 func (pt *ProcessingOrderTask) Execute(ctx context.Context) error {
+	ctx = tracing.WithRequestID(trace.ContextWithSpanContext(ctx, pt.parent), pt.requestID)
+	ctx, span := tracing.Tracer().Start(ctx, "order.process",
+		trace.WithAttributes(attribute.String("order.number", pt.order.Number)),
+	)
 	_, err := pt.os.ProcessOrder(ctx, pt.order)
+	tracing.End(span, err)
 	return err
 }
 
 func (pr *ProcessingOrderTask) Stringer() string {
 	str := fmt.Sprintf("ProcessOrder: Order-%s", pr.order.Number)
+	if pr.requestID != "" {
+		str += fmt.Sprintf(" (request %s)", pr.requestID)
+	}
 	return str
 }
 
-func (os *OrderService) newTask(order domain.Order) ProcessingOrderTask {
+func (os *OrderService) newTask(ctx context.Context, order domain.Order) ProcessingOrderTask {
 	return ProcessingOrderTask{
-		os: os,
-		order: order,
+		os:        os,
+		order:     order,
+		requestID: tracing.RequestID(ctx),
+		parent:    trace.SpanContextFromContext(ctx),
 	}
 }
 
 func (os *OrderService) AsyncProcessOrder(ctx context.Context, order domain.Order) error {
-	task := os.newTask(order)
+	task := os.newTask(ctx, order)
 	if err := os.wp.Submit(ctx, &task); err != nil {
-		os.logger.Error("failed to submit task", zap.Any("task", task), zap.Error(err))
+		tracing.Logger(ctx, os.logger).Error("failed to submit task", zap.String("task", task.Stringer()), zap.Error(err))
 		return err
 	}
 	return nil
 }
+
+// AsyncProcessOrders enqueues many orders at once. The queue is smaller
+// than a large batch, so the orders are submitted in the background and a
+// full queue is waited out instead of dropping the rest. Submitting stops
+// with the service or the pool; the orders left stay REGISTERED and their
+// numbers are logged.
+func (os *OrderService) AsyncProcessOrders(ctx context.Context, orders []domain.Order) {
+	lifetime := os.lifetime
+	logger := tracing.Logger(ctx, os.logger)
+	go func() {
+		for i, order := range orders {
+			if err := os.submitWaiting(lifetime, ctx, order); err != nil {
+				numbers := make([]string, 0, len(orders)-i)
+				for _, order := range orders[i:] {
+					numbers = append(numbers, order.Number)
+				}
+				logger.Error("orders were not queued for processing", zap.Strings("numbers", numbers), zap.Error(err))
+				return
+			}
+		}
+	}()
+}
+
+// submitWaiting submits the order, waiting out a full queue with a delay
+// that doubles up to a minute, until lifetime is done. ctx only carries
+// the request the order came with.
+func (os *OrderService) submitWaiting(lifetime, ctx context.Context, order domain.Order) error {
+	task := os.newTask(ctx, order)
+	delay := os.client.RetryDelay
+	for {
+		err := os.wp.Submit(lifetime, &task)
+		if !errors.Is(err, worker.ErrWorkerPoolFull) {
+			return err
+		}
+		if err := sleep(lifetime, delay); err != nil {
+			return err
+		}
+		delay = min(2*delay, time.Minute)
+	}
+}
@@ -0,0 +1,246 @@
+package orderstream
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"go.uber.org/zap"
+)
+
+const (
+	EventOrder   = "order"
+	EventBalance = "balance"
+	// EventResync tells the client that events were missed and it has to
+	// reload its orders and balance.
+	EventResync = "resync"
+)
+
+// subscriptionBuffer is how many events a slow client may lag behind
+// before it is disconnected; it catches up on reconnect via Last-Event-ID.
+const subscriptionBuffer = 16
+
+type Event struct {
+	ID   EventID
+	Name string
+	Data any
+}
+
+// EventID identifies an event as "<epoch>-<seq>". The sequence starts
+// again in every stream, after a restart or once an idle stream was
+// dropped; the epoch tells those streams apart.
+type EventID struct {
+	Epoch string
+	Seq   uint64
+}
+
+func (id EventID) String() string {
+	return id.Epoch + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// ParseEventID parses the Last-Event-ID of a client. A plain number, as
+// sent by clients of before the epoch, parses without one and so always
+// gets a resync.
+func ParseEventID(s string) (EventID, error) {
+	epoch, seq, found := strings.Cut(s, "-")
+	if !found {
+		epoch, seq = "", s
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil || (found && epoch == "") {
+		return EventID{}, fmt.Errorf("invalid event ID %q", s)
+	}
+	return EventID{Epoch: epoch, Seq: n}, nil
+}
+
+// Broker is an in-process pub/sub of order status and balance changes per
+// user. Every user has an own sequence of event IDs and the last events
+// are kept, so a reconnecting client gets what it missed. The stream of a
+// user nobody listens to is dropped once it has been idle for the
+// retention window; a client that reconnects later is told to resync.
+type Broker struct {
+	mu          sync.Mutex
+	users       map[uint]*userStream
+	userStorage ports.UserStorage
+	historySize int
+	retention   time.Duration
+	// nextEpoch starts at the start time, so it also differs from the
+	// epochs of before a restart.
+	nextEpoch uint64
+	logger    *zap.Logger
+}
+
+type userStream struct {
+	epoch       string
+	lastID      uint64
+	history     []Event
+	subscribers map[*Subscription]struct{}
+	// activeAt is when the last event was published or the last
+	// subscriber left.
+	activeAt time.Time
+}
+
+type Subscription struct {
+	// Events is closed when the subscriber falls behind.
+	Events <-chan Event
+	events chan Event
+	userID uint
+}
+
+func NewBroker(logger *zap.Logger, userStorage ports.UserStorage, historySize int, retention time.Duration) (*Broker, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger[zap.Logger] is a mandatory dependency")
+	}
+	if userStorage == nil {
+		return nil, fmt.Errorf("userStorage[ports.UserStorage] is a mandatory dependency")
+	}
+	if historySize <= 0 {
+		return nil, fmt.Errorf("historySize[int] must be greater than zero")
+	}
+	if retention <= 0 {
+		return nil, fmt.Errorf("retention[time.Duration] must be greater than zero")
+	}
+	return &Broker{
+		users:       make(map[uint]*userStream),
+		userStorage: userStorage,
+		historySize: historySize,
+		retention:   retention,
+		nextEpoch:   uint64(time.Now().UnixNano()),
+		logger:      logger.Named("order-stream"),
+	}, nil
+}
+
+// Subscribe returns a subscription and the events after lastEventID, the
+// zero EventID for a new client. If those events are no longer kept, or
+// lastEventID is from another stream of the user, e.g. one from before a
+// restart, the replay is a single resync event.
+func (b *Broker) Subscribe(userID uint, lastEventID EventID) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stream := b.stream(userID)
+	events := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{Events: events, events: events, userID: userID}
+	stream.subscribers[sub] = struct{}{}
+	if lastEventID == (EventID{}) {
+		return sub, nil
+	}
+	last := lastEventID.Seq
+	if lastEventID.Epoch == stream.epoch && last == stream.lastID {
+		return sub, nil
+	}
+	if lastEventID.Epoch != stream.epoch || last > stream.lastID ||
+		len(stream.history) == 0 || stream.history[0].ID.Seq > last+1 {
+		resync := EventID{Epoch: stream.epoch, Seq: stream.lastID}
+		return sub, []Event{{ID: resync, Name: EventResync, Data: struct{}{}}}
+	}
+	var replay []Event
+	for _, event := range stream.history {
+		if event.ID.Seq > last {
+			replay = append(replay, event)
+		}
+	}
+	return sub, replay
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stream, ok := b.users[sub.userID]
+	if !ok {
+		return
+	}
+	if _, ok := stream.subscribers[sub]; ok {
+		delete(stream.subscribers, sub)
+		close(sub.events)
+		stream.activeAt = time.Now()
+	}
+}
+
+// Run drops the idle streams every retention window until ctx is done.
+func (b *Broker) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.retention)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if dropped := b.dropIdle(time.Now()); dropped > 0 {
+			b.logger.Debug("dropped idle streams", zap.Int("count", dropped))
+		}
+	}
+}
+
+// dropIdle drops the streams without subscribers that have been idle for
+// the retention window by now and returns how many were dropped.
+func (b *Broker) dropIdle(now time.Time) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dropped := 0
+	for userID, stream := range b.users {
+		if len(stream.subscribers) == 0 && now.Sub(stream.activeAt) >= b.retention {
+			delete(b.users, userID)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// OrderStatusChanged publishes the order and, if points were credited, the
+// new balance of its owner.
+func (b *Broker) OrderStatusChanged(ctx context.Context, order *domain.Order) {
+	b.publish(order.UserID, EventOrder, order)
+	if order.Status == domain.PROCESSED && order.Accural != nil {
+		b.BalanceChanged(ctx, order.UserID)
+	}
+}
+
+func (b *Broker) BalanceChanged(ctx context.Context, userID uint) {
+	balance, err := b.userStorage.UserBalance(ctx, userID)
+	if err != nil {
+		b.logger.Warn("can't read the balance", zap.Uint("user_id", userID), zap.Error(err))
+		return
+	}
+	b.publish(userID, EventBalance, balance)
+}
+
+func (b *Broker) publish(userID uint, name string, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stream := b.stream(userID)
+	stream.lastID++
+	stream.activeAt = time.Now()
+	event := Event{ID: EventID{Epoch: stream.epoch, Seq: stream.lastID}, Name: name, Data: data}
+	stream.history = append(stream.history, event)
+	if len(stream.history) > b.historySize {
+		stream.history = stream.history[len(stream.history)-b.historySize:]
+	}
+	for sub := range stream.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			delete(stream.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+func (b *Broker) stream(userID uint) *userStream {
+	stream, ok := b.users[userID]
+	if !ok {
+		b.nextEpoch++
+		stream = &userStream{
+			epoch:       strconv.FormatUint(b.nextEpoch, 36),
+			subscribers: make(map[*Subscription]struct{}),
+			activeAt:    time.Now(),
+		}
+		b.users[userID] = stream
+	}
+	return stream
+}
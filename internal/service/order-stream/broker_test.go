@@ -0,0 +1,117 @@
+package orderstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"go.uber.org/zap"
+)
+
+const retention = time.Minute
+
+// balances answers UserBalance, the only method the broker calls.
+type balances struct {
+	ports.UserStorage
+}
+
+func (balances) UserBalance(context.Context, uint) (domain.Balance, error) {
+	return domain.Balance{Current: 10}, nil
+}
+
+func newBroker(t *testing.T) *Broker {
+	t.Helper()
+	b, err := NewBroker(zap.NewNop(), balances{}, 10, retention)
+	if err != nil {
+		t.Fatalf("NewBroker: %v", err)
+	}
+	return b
+}
+
+// publishBalances publishes n events to the user and returns the last one.
+func publishBalances(t *testing.T, b *Broker, userID uint, n int) Event {
+	t.Helper()
+	sub, _ := b.Subscribe(userID, EventID{})
+	defer b.Unsubscribe(sub)
+	var last Event
+	for range n {
+		b.BalanceChanged(context.Background(), userID)
+		last = <-sub.Events
+	}
+	return last
+}
+
+func TestReplayAfterLastEventID(t *testing.T) {
+	b := newBroker(t)
+	first := publishBalances(t, b, 1, 1)
+	publishBalances(t, b, 1, 2)
+
+	_, replay := b.Subscribe(1, first.ID)
+	if len(replay) != 2 || replay[0].ID.Seq != 2 || replay[1].ID.Seq != 3 {
+		t.Errorf("replay = %+v, want events 2 and 3", replay)
+	}
+}
+
+func TestResyncAfterDropIdle(t *testing.T) {
+	b := newBroker(t)
+	seen := publishBalances(t, b, 1, 2)
+
+	if dropped := b.dropIdle(time.Now().Add(retention)); dropped != 1 {
+		t.Fatalf("dropIdle dropped %d streams, want 1", dropped)
+	}
+	// The new stream counts past the ID the client has seen.
+	publishBalances(t, b, 1, 3)
+
+	_, replay := b.Subscribe(1, seen.ID)
+	if len(replay) != 1 || replay[0].Name != EventResync {
+		t.Fatalf("replay = %+v, want a resync", replay)
+	}
+	if replay[0].ID.Epoch == seen.ID.Epoch || replay[0].ID.Seq != 3 {
+		t.Errorf("resync ID = %s, want the last ID of the new stream", replay[0].ID)
+	}
+}
+
+func TestDropIdleKeepsSubscribedStreams(t *testing.T) {
+	b := newBroker(t)
+	b.Subscribe(1, EventID{})
+	publishBalances(t, b, 2, 1)
+
+	if dropped := b.dropIdle(time.Now().Add(retention)); dropped != 1 {
+		t.Errorf("dropIdle dropped %d streams, want only the one without subscribers", dropped)
+	}
+	if _, ok := b.users[1]; !ok {
+		t.Error("the stream with a subscriber was dropped")
+	}
+}
+
+func TestParseEventID(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    EventID
+		wantErr bool
+	}{
+		{raw: "k2x-7", want: EventID{Epoch: "k2x", Seq: 7}},
+		{raw: "7", want: EventID{Seq: 7}},
+		{raw: "-7", wantErr: true},
+		{raw: "k2x-", wantErr: true},
+		{raw: "k2x-a", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEventID(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseEventID(%q) = %+v, %v", tt.raw, got, err)
+		}
+	}
+}
+
+func TestResyncForIDWithoutEpoch(t *testing.T) {
+	b := newBroker(t)
+	publishBalances(t, b, 1, 3)
+
+	_, replay := b.Subscribe(1, EventID{Seq: 1})
+	if len(replay) != 1 || replay[0].Name != EventResync {
+		t.Errorf("replay = %+v, want a resync", replay)
+	}
+}
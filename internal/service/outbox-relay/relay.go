@@ -0,0 +1,217 @@
+package outboxrelay
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"go.uber.org/zap"
+)
+
+// maxRetryDelay caps the backoff of a failing event.
+const maxRetryDelay = time.Hour
+
+// Relay publishes the events of the outbox. An event is marked as published
+// only after the publisher accepted it, so delivery is at least once. Events
+// of one user are published in the order they were added: after a failed
+// event the later events of the same user wait until it is retried, after a
+// delay that doubles with every attempt. An event that failed maxAttempts
+// times is marked dead and no longer holds up the user.
+//
+// An ID may be committed after greater ones, so the relay only publishes
+// events up to the first missing ID. A missing ID is taken for a rolled
+// back transaction once the event after it is gapTimeout old.
+//
+// Only one relay should run against a database.
+type Relay struct {
+	outbox      ports.Outbox
+	publisher   ports.EventPublisher
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	retryDelay  time.Duration
+	gapTimeout  time.Duration
+	logger      *zap.Logger
+
+	mu sync.Mutex
+	// committed is the ID up to which every event is known to be
+	// committed or rolled back.
+	committed uint
+}
+
+func NewRelay(logger *zap.Logger, outbox ports.Outbox, publisher ports.EventPublisher, interval time.Duration, batchSize, maxAttempts int, retryDelay, gapTimeout time.Duration) (*Relay, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger[zap.Logger] is a mandatory dependency")
+	}
+	if outbox == nil {
+		return nil, fmt.Errorf("outbox[ports.Outbox] is a mandatory dependency")
+	}
+	if publisher == nil {
+		return nil, fmt.Errorf("publisher[ports.EventPublisher] is a mandatory dependency")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval[time.Duration] must be greater than zero")
+	}
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batchSize[int] must be greater than zero")
+	}
+	if maxAttempts <= 0 {
+		return nil, fmt.Errorf("maxAttempts[int] must be greater than zero")
+	}
+	if retryDelay <= 0 {
+		return nil, fmt.Errorf("retryDelay[time.Duration] must be greater than zero")
+	}
+	if gapTimeout <= 0 {
+		return nil, fmt.Errorf("gapTimeout[time.Duration] must be greater than zero")
+	}
+	return &Relay{
+		outbox:      outbox,
+		publisher:   publisher,
+		interval:    interval,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+		gapTimeout:  gapTimeout,
+		logger:      logger.Named("outbox"),
+	}, nil
+}
+
+// Run publishes pending events every interval until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		if _, err := r.RelayPending(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Warn("can't relay the outbox", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// RelayPending publishes the pending events batchSize at a time and
+// returns how many were published. The events of blocked users are
+// skipped, so one failing user doesn't hold up the others.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if err := r.advance(ctx, now); err != nil {
+		return 0, err
+	}
+	published := 0
+	blocked := make(map[uint]bool)
+	var lastID uint
+	for {
+		events, err := r.outbox.Pending(ctx, lastID, r.batchSize)
+		if err != nil {
+			return published, err
+		}
+		for _, event := range events {
+			if ctx.Err() != nil {
+				return published, ctx.Err()
+			}
+			if event.ID > r.committed {
+				return published, nil
+			}
+			lastID = event.ID
+			if blocked[event.UserID] {
+				continue
+			}
+			if event.RetryAt != nil && event.RetryAt.After(now) {
+				blocked[event.UserID] = true
+				continue
+			}
+			switch r.publish(ctx, event) {
+			case eventPublished:
+				published++
+			case eventFailed:
+				blocked[event.UserID] = true
+			}
+		}
+		if len(events) < r.batchSize {
+			return published, nil
+		}
+	}
+}
+
+// advance moves committed up to the first missing ID that may still be
+// committed.
+func (r *Relay) advance(ctx context.Context, now time.Time) error {
+	for {
+		events, err := r.outbox.Committed(ctx, r.committed, r.batchSize)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if event.ID > r.committed+1 {
+				if now.Sub(event.CreatedAt) < r.gapTimeout {
+					return nil
+				}
+				r.logger.Debug("skipped the IDs of rolled back events",
+					zap.Uint("from", r.committed+1), zap.Uint("to", event.ID-1))
+			}
+			r.committed = event.ID
+		}
+		if len(events) < r.batchSize {
+			return nil
+		}
+	}
+}
+
+type outcome int
+
+const (
+	eventPublished outcome = iota
+	// eventFailed is retried; the later events of the user wait.
+	eventFailed
+	// eventDead is given up; the later events of the user go on.
+	eventDead
+)
+
+// publish publishes the event and records the outcome.
+func (r *Relay) publish(ctx context.Context, event *domain.Event) outcome {
+	err := r.publisher.Publish(ctx, event)
+	if err == nil {
+		if err := r.outbox.MarkPublished(ctx, event.ID, time.Now()); err != nil {
+			// The event will be published again; the user is blocked so
+			// that later events don't overtake the repeated one.
+			r.logger.Error("can't mark the event as published", zap.Uint("id", event.ID), zap.Error(err))
+			return eventFailed
+		}
+		return eventPublished
+	}
+	attempt := event.Attempts + 1
+	fields := []zap.Field{
+		zap.Uint("id", event.ID),
+		zap.String("type", string(event.Type)),
+		zap.Int("attempt", attempt),
+		zap.Error(err),
+	}
+	if attempt >= r.maxAttempts {
+		r.logger.Error("giving up on the event", fields...)
+		if err := r.outbox.MarkDead(ctx, event.ID, err.Error(), time.Now()); err != nil {
+			r.logger.Error("can't mark the event as dead", zap.Uint("id", event.ID), zap.Error(err))
+			return eventFailed
+		}
+		return eventDead
+	}
+	r.logger.Warn("can't publish the event", fields...)
+	if err := r.outbox.MarkFailed(ctx, event.ID, err.Error(), time.Now().Add(r.backoff(attempt))); err != nil {
+		r.logger.Error("can't record the failed attempt", zap.Uint("id", event.ID), zap.Error(err))
+	}
+	return eventFailed
+}
+
+// backoff is the delay after the given failed attempt.
+func (r *Relay) backoff(attempt int) time.Duration {
+	delay := r.retryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
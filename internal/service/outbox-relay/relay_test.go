@@ -0,0 +1,202 @@
+package outboxrelay
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"go.uber.org/zap"
+)
+
+var ctx = context.Background()
+
+// outbox keeps the committed events; an ID it skipped is one whose
+// transaction has not been committed yet.
+type outbox struct {
+	events map[uint]*domain.Event
+}
+
+func newOutbox() *outbox {
+	return &outbox{events: make(map[uint]*domain.Event)}
+}
+
+func (o *outbox) commit(id, userID uint, createdAt time.Time) {
+	o.events[id] = &domain.Event{ID: id, UserID: userID, Type: domain.EventPointsSent, CreatedAt: createdAt}
+}
+
+func (o *outbox) sorted(keep func(*domain.Event) bool, afterID uint, limit int) []*domain.Event {
+	var events []*domain.Event
+	for _, event := range o.events {
+		if event.ID > afterID && keep(event) {
+			event := *event
+			events = append(events, &event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events
+}
+
+func (o *outbox) Add(context.Context, ...*domain.Event) error {
+	return errors.New("not used")
+}
+
+func (o *outbox) Pending(_ context.Context, afterID uint, limit int) ([]*domain.Event, error) {
+	return o.sorted(func(e *domain.Event) bool { return e.PublishedAt == nil && e.DeadAt == nil }, afterID, limit), nil
+}
+
+func (o *outbox) Committed(_ context.Context, afterID uint, limit int) ([]*domain.Event, error) {
+	return o.sorted(func(*domain.Event) bool { return true }, afterID, limit), nil
+}
+
+func (o *outbox) MarkPublished(_ context.Context, id uint, at time.Time) error {
+	o.events[id].PublishedAt = &at
+	return nil
+}
+
+func (o *outbox) MarkFailed(_ context.Context, id uint, reason string, retryAt time.Time) error {
+	o.events[id].Attempts++
+	o.events[id].LastError = reason
+	o.events[id].RetryAt = &retryAt
+	return nil
+}
+
+func (o *outbox) MarkDead(_ context.Context, id uint, reason string, at time.Time) error {
+	o.events[id].Attempts++
+	o.events[id].LastError = reason
+	o.events[id].DeadAt = &at
+	return nil
+}
+
+// publisher records the published IDs and fails the ones in fail.
+type publisher struct {
+	published []uint
+	fail      map[uint]bool
+}
+
+func (p *publisher) Publish(_ context.Context, event *domain.Event) error {
+	if p.fail[event.ID] {
+		return errors.New("rejected")
+	}
+	p.published = append(p.published, event.ID)
+	return nil
+}
+
+func newRelay(t *testing.T, o *outbox, p *publisher, maxAttempts int) *Relay {
+	t.Helper()
+	r, err := NewRelay(zap.NewNop(), o, p, time.Second, 2, maxAttempts, time.Minute, 30*time.Second)
+	if err != nil {
+		t.Fatalf("NewRelay: %v", err)
+	}
+	return r
+}
+
+func equal(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRelayWaitsForLateCommits(t *testing.T) {
+	o, p := newOutbox(), &publisher{}
+	r := newRelay(t, o, p, 3)
+	now := time.Now()
+	o.commit(1, 1, now)
+	// 2 is still in flight when 3 of the same user is committed.
+	o.commit(3, 1, now)
+
+	if _, err := r.RelayPending(ctx); err != nil {
+		t.Fatalf("RelayPending: %v", err)
+	}
+	if !equal(p.published, []uint{1}) {
+		t.Fatalf("published %v before the gap was filled, want [1]", p.published)
+	}
+
+	o.commit(2, 1, now)
+	if _, err := r.RelayPending(ctx); err != nil {
+		t.Fatalf("RelayPending: %v", err)
+	}
+	if !equal(p.published, []uint{1, 2, 3}) {
+		t.Errorf("published %v, want [1 2 3]", p.published)
+	}
+}
+
+func TestRelaySkipsOldGaps(t *testing.T) {
+	o, p := newOutbox(), &publisher{}
+	r := newRelay(t, o, p, 3)
+	// 2 was rolled back long ago.
+	o.commit(1, 1, time.Now().Add(-time.Hour))
+	o.commit(3, 1, time.Now().Add(-time.Hour))
+	o.commit(4, 2, time.Now())
+
+	if _, err := r.RelayPending(ctx); err != nil {
+		t.Fatalf("RelayPending: %v", err)
+	}
+	if !equal(p.published, []uint{1, 3, 4}) {
+		t.Errorf("published %v, want [1 3 4]", p.published)
+	}
+}
+
+func TestRelayBacksOffAndGivesUp(t *testing.T) {
+	o, p := newOutbox(), &publisher{fail: map[uint]bool{1: true}}
+	r := newRelay(t, o, p, 2)
+	o.commit(1, 1, time.Now())
+	o.commit(2, 1, time.Now())
+	o.commit(3, 2, time.Now())
+
+	if _, err := r.RelayPending(ctx); err != nil {
+		t.Fatalf("RelayPending: %v", err)
+	}
+	if !equal(p.published, []uint{3}) {
+		t.Fatalf("published %v, want [3]: the user of the failed event waits", p.published)
+	}
+	if retryAt := o.events[1].RetryAt; retryAt == nil || time.Until(*retryAt) < 59*time.Second {
+		t.Fatalf("RetryAt = %v, want a minute from now", retryAt)
+	}
+
+	// The event is not retried before RetryAt.
+	if _, err := r.RelayPending(ctx); err != nil {
+		t.Fatalf("RelayPending: %v", err)
+	}
+	if o.events[1].Attempts != 1 || !equal(p.published, []uint{3}) {
+		t.Fatalf("retried before RetryAt: attempts %d, published %v", o.events[1].Attempts, p.published)
+	}
+
+	past := time.Now().Add(-time.Second)
+	o.events[1].RetryAt = &past
+	if _, err := r.RelayPending(ctx); err != nil {
+		t.Fatalf("RelayPending: %v", err)
+	}
+	if o.events[1].DeadAt == nil || o.events[1].Attempts != 2 {
+		t.Errorf("event after the last attempt = %+v, want it dead", o.events[1])
+	}
+	if !equal(p.published, []uint{3, 2}) {
+		t.Errorf("published %v, want [3 2]: the dead event no longer holds up its user", p.published)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := &Relay{retryDelay: time.Minute}
+	tests := map[int]time.Duration{
+		1:   time.Minute,
+		2:   2 * time.Minute,
+		3:   4 * time.Minute,
+		100: maxRetryDelay,
+	}
+	for attempt, want := range tests {
+		if got := r.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
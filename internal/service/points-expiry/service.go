@@ -0,0 +1,163 @@
+package pointsexpiry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"github.com/OrtemRepos/go_store/internal/worker-pool"
+	"go.uber.org/zap"
+)
+
+// ExpiryService expires the points of lots past their expiry date. The job
+// is submitted to the worker pool every interval and writes an expiry
+// record and a PointsExpired event for every lot.
+type ExpiryService struct {
+	uow       ports.UnitOfWork
+	wp        worker.WorkerPool
+	listeners []ports.BalanceListener
+	interval  time.Duration
+	batchSize int
+	queued    atomic.Bool
+	logger    *zap.Logger
+}
+
+func NewExpiryService(logger *zap.Logger, wp worker.WorkerPool, uow ports.UnitOfWork, listeners []ports.BalanceListener, interval time.Duration, batchSize int) (*ExpiryService, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger[zap.Logger] is a mandatory dependency")
+	}
+	if wp == nil {
+		return nil, fmt.Errorf("WorkerPool[worker.WorkerPool] is a mandatory dependency")
+	}
+	if uow == nil {
+		return nil, fmt.Errorf("uow[ports.UnitOfWork] is a mandatory dependency")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval[time.Duration] must be greater than zero")
+	}
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batchSize[int] must be greater than zero")
+	}
+	return &ExpiryService{
+		uow:       uow,
+		wp:        wp,
+		listeners: listeners,
+		interval:  interval,
+		batchSize: batchSize,
+		logger:    logger.Named("points-expiry"),
+	}, nil
+}
+
+// Run submits the expiry job to the worker pool every interval until ctx
+// is done. A job is not submitted while the previous one is still queued
+// or running.
+func (s *ExpiryService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !s.queued.CompareAndSwap(false, true) {
+			continue
+		}
+		if err := s.wp.Submit(ctx, &expiryTask{s: s}); err != nil {
+			s.queued.Store(false)
+			s.logger.Warn("can't submit the points expiry job", zap.Error(err))
+		}
+	}
+}
+
+// ExpireDue expires the lots due by now and returns how many points
+// expired. A lot changed concurrently, or one whose points the user no
+// longer has, is left for the next run; the run goes on past it.
+func (s *ExpiryService) ExpireDue(ctx context.Context) (int, error) {
+	expired := 0
+	now := time.Now()
+	var after *domain.PointLot
+	for ctx.Err() == nil {
+		var lots []*domain.PointLot
+		err := s.uow.Do(ctx, func(repos ports.Repositories) error {
+			var err error
+			lots, err = repos.Lots.ListExpired(ctx, now, after, s.batchSize)
+			return err
+		})
+		if err != nil {
+			return expired, err
+		}
+		for _, lot := range lots {
+			amount, err := s.expire(ctx, lot)
+			if errors.Is(err, domain.ErrPointLotChanged) || errors.Is(err, domain.ErrNotEnoughPoints) {
+				s.logger.Debug("lot left for the next run", zap.Uint("lot_id", lot.ID), zap.Error(err))
+				continue
+			} else if err != nil {
+				return expired, err
+			}
+			expired += amount
+		}
+		if len(lots) < s.batchSize {
+			return expired, nil
+		}
+		after = lots[len(lots)-1]
+	}
+	return expired, ctx.Err()
+}
+
+// expire takes the points of the lot from the balance first, so the user
+// row is locked before the lot like in a withdrawal.
+func (s *ExpiryService) expire(ctx context.Context, lot *domain.PointLot) (int, error) {
+	remaining := lot.Remaining
+	var expiry *domain.PointExpiry
+	err := s.uow.Do(ctx, func(repos ports.Repositories) error {
+		balance, err := repos.Users.LockBalance(ctx, lot.UserID)
+		if err != nil {
+			return err
+		}
+		expiry, err = lot.Expire(time.Now(), balance.Current)
+		if err != nil {
+			return err
+		}
+		if err := repos.Users.AdjustBalance(ctx, lot.UserID, domain.Balance{Current: -expiry.Amount}); err != nil {
+			return err
+		}
+		if err := repos.Lots.Expire(ctx, expiry, remaining); err != nil {
+			return err
+		}
+		return repos.Outbox.Add(ctx, domain.NewPointsExpiredEvent(expiry))
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.logger.Info("points expired",
+		zap.Uint("user_id", lot.UserID),
+		zap.String("source", lot.Source),
+		zap.Int("amount", expiry.Amount),
+	)
+	for _, listener := range s.listeners {
+		listener.BalanceChanged(ctx, lot.UserID)
+	}
+	return expiry.Amount, nil
+}
+
+type expiryTask struct {
+	s *ExpiryService
+}
+
+func (t *expiryTask) Execute(ctx context.Context) error {
+	defer t.s.queued.Store(false)
+	expired, err := t.s.ExpireDue(ctx)
+	if expired > 0 {
+		t.s.logger.Info("expired points", zap.Int("amount", expired))
+	}
+	return err
+}
+
+func (t *expiryTask) Stringer() string {
+	return "expire point lots"
+}
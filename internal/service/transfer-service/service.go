@@ -0,0 +1,144 @@
+package transferservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"go.uber.org/zap"
+)
+
+// TransferService moves points between users. The rules are checked by
+// domain.User; the service only loads the users and writes the result in
+// one transaction.
+type TransferService struct {
+	uow       ports.UnitOfWork
+	listeners []ports.BalanceListener
+	limits    domain.TransferLimits
+	logger    *zap.Logger
+}
+
+func NewTransferService(logger *zap.Logger, uow ports.UnitOfWork, listeners []ports.BalanceListener, limits domain.TransferLimits) (*TransferService, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger[zap.Logger] is a mandatory dependency")
+	}
+	if uow == nil {
+		return nil, fmt.Errorf("uow[ports.UnitOfWork] is a mandatory dependency")
+	}
+	if limits.DailySum < 0 || limits.DailyCount < 0 {
+		return nil, fmt.Errorf("limits[domain.TransferLimits] must not be negative")
+	}
+	return &TransferService{
+		uow:       uow,
+		listeners: listeners,
+		limits:    limits,
+		logger:    logger.Named("transfers"),
+	}, nil
+}
+
+// Transfer moves sum points of the sender to the user with recipientEmail.
+// The points keep the expiry date of the lots they are taken from. The
+// recipient is looked up last and an unknown one is reported as
+// domain.ErrTransferRecipientRejected, so that transfers can't tell which
+// emails are registered.
+func (s *TransferService) Transfer(ctx context.Context, senderID uint, recipientEmail string, sum int) (*domain.Transfer, error) {
+	email, err := domain.NormalizeEmail(recipientEmail)
+	if err != nil {
+		return nil, err
+	}
+	dayStart := time.Now().UTC().Truncate(24 * time.Hour)
+	var transfer *domain.Transfer
+	err = s.uow.Do(ctx, func(repos ports.Repositories) error {
+		sender, err := repos.Users.GetByID(ctx, senderID)
+		if err != nil {
+			return err
+		}
+		sent, err := repos.Transfers.SentSince(ctx, senderID, dayStart)
+		if err != nil {
+			return err
+		}
+		if err := sender.CanTransfer(sum, sent, s.limits); err != nil {
+			return err
+		}
+		recipient, err := repos.Users.GetByEmail(ctx, email)
+		if errors.Is(err, domain.ErrUserNotExist) {
+			return domain.ErrTransferRecipientRejected
+		} else if err != nil {
+			return err
+		}
+		transfer, err = sender.TransferTo(recipient, sum, sent, s.limits)
+		if err != nil {
+			return err
+		}
+		if err := adjustBalances(ctx, repos, transfer); err != nil {
+			return err
+		}
+		// The limit is checked again now that the sender is locked by the
+		// balance update, as a concurrent transfer may have been committed.
+		if sent, err = repos.Transfers.SentSince(ctx, senderID, dayStart); err != nil {
+			return err
+		}
+		if err := s.limits.Allow(sent, sum); err != nil {
+			return err
+		}
+		if err := repos.Transfers.Create(ctx, transfer); err != nil {
+			return err
+		}
+		lots, err := repos.Lots.Available(ctx, senderID)
+		if err != nil {
+			return err
+		}
+		usages := domain.TakeFromLots(lots, transfer.Reference(), sum)
+		if err := repos.Lots.Take(ctx, usages); err != nil {
+			return err
+		}
+		for _, lot := range transfer.MovedLots(lots, usages) {
+			if err := repos.Lots.Add(ctx, lot); err != nil {
+				return err
+			}
+		}
+		for _, event := range domain.NewTransferEvents(transfer) {
+			if err := repos.Outbox.Add(ctx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("points transferred",
+		zap.Uint("sender_id", transfer.SenderID),
+		zap.Uint("recipient_id", transfer.RecipientID),
+		zap.Int("sum", transfer.Sum),
+	)
+	for _, listener := range s.listeners {
+		listener.BalanceChanged(ctx, transfer.SenderID)
+		listener.BalanceChanged(ctx, transfer.RecipientID)
+	}
+	return transfer, nil
+}
+
+// adjustBalances updates the users in the order of their IDs, so two
+// transfers in opposite directions can't deadlock.
+func adjustBalances(ctx context.Context, repos ports.Repositories, transfer *domain.Transfer) error {
+	changes := []struct {
+		userID uint
+		delta  domain.Balance
+	}{
+		{transfer.SenderID, domain.Balance{Current: -transfer.Sum}},
+		{transfer.RecipientID, domain.Balance{Current: transfer.Sum}},
+	}
+	if transfer.RecipientID < transfer.SenderID {
+		changes[0], changes[1] = changes[1], changes[0]
+	}
+	for _, change := range changes {
+		if err := repos.Users.AdjustBalance(ctx, change.userID, change.delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
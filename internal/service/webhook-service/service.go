@@ -0,0 +1,223 @@
+package webhookservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"github.com/OrtemRepos/go_store/internal/worker-pool"
+	"go.uber.org/zap"
+)
+
+const maxRetryDelay = time.Hour
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventIDHeader   = "X-Webhook-Event-ID"
+)
+
+// WebhookService delivers order status changes to the webhooks of the
+// order owner. Deliveries run on the worker pool; a failed one is submitted
+// again after a delay that doubles with every attempt, and every attempt
+// is logged with its response code. Retries are best-effort: they wait in
+// memory and are lost on restart, the delivery log lets the owner replay
+// the ones that never succeeded. Webhooks are only delivered to public
+// addresses, see domain.PublicAddress.
+type WebhookService struct {
+	webhooks    ports.WebhookStorage
+	wp          worker.WorkerPool
+	client      *http.Client
+	maxAttempts int
+	retryDelay  time.Duration
+	logger      *zap.Logger
+}
+
+func NewWebhookService(logger *zap.Logger, wp worker.WorkerPool, webhooks ports.WebhookStorage, timeout time.Duration, maxAttempts int, retryDelay time.Duration) (*WebhookService, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger[zap.Logger] is a mandatory dependency")
+	}
+	if wp == nil {
+		return nil, fmt.Errorf("WorkerPool[worker.WorkerPool] is a mandatory dependency")
+	}
+	if webhooks == nil {
+		return nil, fmt.Errorf("webhooks[ports.WebhookStorage] is a mandatory dependency")
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("timeout[time.Duration] must be greater than zero")
+	}
+	if maxAttempts <= 0 {
+		return nil, fmt.Errorf("maxAttempts[int] must be greater than zero")
+	}
+	if retryDelay <= 0 {
+		return nil, fmt.Errorf("retryDelay[time.Duration] must be greater than zero")
+	}
+	return &WebhookService{
+		webhooks:    webhooks,
+		wp:          wp,
+		client:      newClient(timeout),
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+		logger:      logger.Named("webhooks"),
+	}, nil
+}
+
+// OrderStatusChanged queues a delivery of the order to every webhook of
+// its owner. Partners are only told about PROCESSED and INVALID orders,
+// NEEDS_ATTENTION is for the operators.
+func (s *WebhookService) OrderStatusChanged(ctx context.Context, order *domain.Order) {
+	if order.Status != domain.PROCESSED && order.Status != domain.INVALID {
+		return
+	}
+	webhooks, err := s.webhooks.ListByUser(ctx, order.UserID)
+	if err != nil {
+		s.logger.Error("can't list webhooks", zap.Uint("user_id", order.UserID), zap.Error(err))
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	payload, eventID, err := domain.NewOrderWebhookPayload(order)
+	if err != nil {
+		s.logger.Error("can't build the webhook payload", zap.String("number", order.Number), zap.Error(err))
+		return
+	}
+	for _, webhook := range webhooks {
+		s.submit(ctx, &deliveryTask{s: s, webhook: webhook, eventID: eventID, payload: payload, attempt: 1})
+	}
+}
+
+// Replay queues the payload of a logged delivery again. The event ID is
+// kept, so the receiver can recognize a payload it has already handled.
+func (s *WebhookService) Replay(ctx context.Context, userID, deliveryID uint) error {
+	delivery, err := s.webhooks.GetDelivery(ctx, userID, deliveryID)
+	if err != nil {
+		return err
+	}
+	webhook, err := s.webhooks.Get(ctx, userID, delivery.WebhookID)
+	if err != nil {
+		return err
+	}
+	task := &deliveryTask{s: s, webhook: webhook, eventID: delivery.EventID, payload: delivery.Payload, attempt: 1}
+	return s.wp.Submit(ctx, task)
+}
+
+// newClient returns a client that refuses to connect to addresses that
+// are not public. The check runs on the resolved address of every
+// connection, redirects included, so a host name that resolves to the
+// host itself or to the metadata service is refused as well. Proxies are
+// not used, they would connect in place of the client.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   refusePrivateAddress,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func refusePrivateAddress(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !domain.PublicAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", domain.ErrWebhookAddressNotAllowed, addrPort.Addr())
+	}
+	return nil
+}
+
+func (s *WebhookService) submit(ctx context.Context, task *deliveryTask) {
+	if err := s.wp.Submit(ctx, task); err != nil {
+		s.logger.Error("can't submit the webhook delivery", zap.String("task", task.Stringer()), zap.Error(err))
+	}
+}
+
+// retry submits the task again after the backoff of its attempt. The
+// delay is not spent on a worker, so other tasks keep running meanwhile.
+// The pending retry lives only in memory.
+func (s *WebhookService) retry(task *deliveryTask) {
+	delay := s.retryDelay << (task.attempt - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	next := *task
+	next.attempt++
+	time.AfterFunc(delay, func() { s.submit(context.Background(), &next) })
+}
+
+type deliveryTask struct {
+	s       *WebhookService
+	webhook *domain.Webhook
+	eventID string
+	payload json.RawMessage
+	attempt int
+}
+
+func (t *deliveryTask) Execute(ctx context.Context) error {
+	delivery := &domain.WebhookDelivery{
+		WebhookID: t.webhook.ID,
+		UserID:    t.webhook.UserID,
+		EventID:   t.eventID,
+		Payload:   t.payload,
+		Attempt:   t.attempt,
+	}
+	start := time.Now()
+	statusCode, err := t.send(ctx)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	delivery.StatusCode = statusCode
+	delivery.Success = err == nil
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	if err := t.s.webhooks.SaveDelivery(ctx, delivery); err != nil {
+		t.s.logger.Warn("can't log the webhook delivery", zap.Error(err))
+	}
+	if err == nil {
+		return nil
+	}
+	if t.attempt < t.s.maxAttempts && !errors.Is(err, context.Canceled) && !errors.Is(err, domain.ErrWebhookAddressNotAllowed) {
+		t.s.retry(t)
+	}
+	return err
+}
+
+func (t *deliveryTask) send(ctx context.Context) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.webhook.URL, bytes.NewReader(t.payload))
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, t.eventID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, "sha256="+t.webhook.Sign(now, t.payload))
+	resp, err := t.s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (t *deliveryTask) Stringer() string {
+	return fmt.Sprintf("WebhookDelivery: Webhook-%d Event-%s Attempt-%d", t.webhook.ID, t.eventID, t.attempt)
+}
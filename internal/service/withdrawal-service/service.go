@@ -0,0 +1,247 @@
+package withdrawalservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/OrtemRepos/go_store/internal/domain"
+	"github.com/OrtemRepos/go_store/internal/ports"
+	"github.com/OrtemRepos/go_store/internal/worker-pool"
+	"go.uber.org/zap"
+)
+
+// WithdrawalService writes withdrawals together with the balance change
+// they cause and takes their points from the lots that expire first. A
+// withdrawal is either final at once or two-phase: the points are held
+// first and then confirmed or cancelled. Holds that are not resolved in
+// time are released by a job submitted to the worker pool.
+type WithdrawalService struct {
+	uow            ports.UnitOfWork
+	wp             worker.WorkerPool
+	listeners      []ports.BalanceListener
+	holdTTL        time.Duration
+	expiryInterval time.Duration
+	batchSize      int
+	expiryQueued   atomic.Bool
+	logger         *zap.Logger
+}
+
+func NewWithdrawalService(logger *zap.Logger, wp worker.WorkerPool, uow ports.UnitOfWork, listeners []ports.BalanceListener, holdTTL, expiryInterval time.Duration, batchSize int) (*WithdrawalService, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger[zap.Logger] is a mandatory dependency")
+	}
+	if wp == nil {
+		return nil, fmt.Errorf("WorkerPool[worker.WorkerPool] is a mandatory dependency")
+	}
+	if uow == nil {
+		return nil, fmt.Errorf("uow[ports.UnitOfWork] is a mandatory dependency")
+	}
+	if holdTTL <= 0 {
+		return nil, fmt.Errorf("holdTTL[time.Duration] must be greater than zero")
+	}
+	if expiryInterval <= 0 {
+		return nil, fmt.Errorf("expiryInterval[time.Duration] must be greater than zero")
+	}
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batchSize[int] must be greater than zero")
+	}
+	return &WithdrawalService{
+		uow:            uow,
+		wp:             wp,
+		listeners:      listeners,
+		holdTTL:        holdTTL,
+		expiryInterval: expiryInterval,
+		batchSize:      batchSize,
+		logger:         logger.Named("withdrawals"),
+	}, nil
+}
+
+// Withdraw spends sum points of the user at once.
+func (s *WithdrawalService) Withdraw(ctx context.Context, user *domain.User, number string, sum int) (*domain.Withdraw, error) {
+	withdraw, err := user.AddWithdrawn(number, sum)
+	if err != nil {
+		return withdraw, err
+	}
+	return withdraw, s.create(ctx, user.ID, withdraw)
+}
+
+// Hold reserves sum points of the user until they are confirmed or
+// cancelled, at most for the hold TTL.
+func (s *WithdrawalService) Hold(ctx context.Context, user *domain.User, number string, sum int) (*domain.Withdraw, error) {
+	withdraw, err := user.HoldWithdrawn(number, sum, time.Now().UTC().Add(s.holdTTL))
+	if err != nil {
+		return withdraw, err
+	}
+	return withdraw, s.create(ctx, user.ID, withdraw)
+}
+
+// Confirm spends the points held by the withdrawal of the user.
+func (s *WithdrawalService) Confirm(ctx context.Context, userID uint, number string) (*domain.Withdraw, error) {
+	return s.resolve(ctx, userID, number, (*domain.Withdraw).Confirm)
+}
+
+// Cancel returns the points held by the withdrawal of the user.
+func (s *WithdrawalService) Cancel(ctx context.Context, userID uint, number string) (*domain.Withdraw, error) {
+	return s.resolve(ctx, userID, number, (*domain.Withdraw).Cancel)
+}
+
+// Run submits the expiry job to the worker pool every expiry interval
+// until ctx is done. A job is not submitted while the previous one is
+// still queued or running.
+func (s *WithdrawalService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.expiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !s.expiryQueued.CompareAndSwap(false, true) {
+			continue
+		}
+		if err := s.wp.Submit(ctx, &expiryTask{s: s}); err != nil {
+			s.expiryQueued.Store(false)
+			s.logger.Warn("can't submit the hold expiry job", zap.Error(err))
+		}
+	}
+}
+
+// ReleaseExpired releases the holds expired by now and returns how many
+// were released. A hold resolved concurrently is skipped.
+func (s *WithdrawalService) ReleaseExpired(ctx context.Context) (int, error) {
+	released := 0
+	for ctx.Err() == nil {
+		var expired []*domain.Withdraw
+		err := s.uow.Do(ctx, func(repos ports.Repositories) error {
+			var err error
+			expired, err = repos.Withdrawals.ListExpiredHolds(ctx, time.Now(), s.batchSize)
+			return err
+		})
+		if err != nil {
+			return released, err
+		}
+		for _, withdraw := range expired {
+			err := s.expire(ctx, withdraw)
+			if errors.Is(err, domain.ErrWithdrawalNotHeld) {
+				continue
+			} else if err != nil {
+				return released, err
+			}
+			released++
+		}
+		if len(expired) < s.batchSize {
+			return released, nil
+		}
+	}
+	return released, ctx.Err()
+}
+
+func (s *WithdrawalService) create(ctx context.Context, userID uint, withdraw *domain.Withdraw) error {
+	err := s.uow.Do(ctx, func(repos ports.Repositories) error {
+		if err := repos.Users.AdjustBalance(ctx, userID, withdraw.Delta()); err != nil {
+			return err
+		}
+		if err := repos.Withdrawals.Create(ctx, withdraw); err != nil {
+			return err
+		}
+		lots, err := repos.Lots.Available(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if err := repos.Lots.Take(ctx, domain.TakeFromLots(lots, withdraw.Number, withdraw.Sum)); err != nil {
+			return err
+		}
+		return repos.Outbox.Add(ctx, domain.NewWithdrawalEvent(userID, withdraw))
+	})
+	if err != nil {
+		return err
+	}
+	s.balanceChanged(ctx, userID)
+	return nil
+}
+
+func (s *WithdrawalService) resolve(ctx context.Context, userID uint, number string, transition func(*domain.Withdraw, time.Time) (domain.Balance, error)) (*domain.Withdraw, error) {
+	var withdraw *domain.Withdraw
+	err := s.uow.Do(ctx, func(repos ports.Repositories) error {
+		var err error
+		withdraw, err = repos.Withdrawals.GetByNumber(ctx, number)
+		if err != nil {
+			return err
+		}
+		if withdraw.UserID != strconv.FormatUint(uint64(userID), 10) {
+			return domain.ErrWithdrawalNotFound
+		}
+		return s.apply(ctx, repos, userID, withdraw, transition)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.balanceChanged(ctx, userID)
+	return withdraw, nil
+}
+
+func (s *WithdrawalService) expire(ctx context.Context, withdraw *domain.Withdraw) error {
+	userID, err := strconv.ParseUint(withdraw.UserID, 10, 0)
+	if err != nil {
+		return fmt.Errorf("withdrawal %s has an invalid user ID %q: %w", withdraw.Number, withdraw.UserID, err)
+	}
+	err = s.uow.Do(ctx, func(repos ports.Repositories) error {
+		return s.apply(ctx, repos, uint(userID), withdraw, (*domain.Withdraw).Expire)
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.Info("withdrawal hold expired", zap.String("number", withdraw.Number), zap.Int("sum", withdraw.Sum))
+	s.balanceChanged(ctx, uint(userID))
+	return nil
+}
+
+// apply moves the withdrawal out of the hold and the points with it.
+// Resolve goes first, so of two concurrent resolutions only one changes
+// the balance.
+func (s *WithdrawalService) apply(ctx context.Context, repos ports.Repositories, userID uint, withdraw *domain.Withdraw, transition func(*domain.Withdraw, time.Time) (domain.Balance, error)) error {
+	delta, err := transition(withdraw, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if err := repos.Withdrawals.Resolve(ctx, withdraw); err != nil {
+		return err
+	}
+	if err := repos.Users.AdjustBalance(ctx, userID, delta); err != nil {
+		return err
+	}
+	if delta.Current > 0 {
+		if err := repos.Lots.Release(ctx, withdraw.Number); err != nil {
+			return err
+		}
+	}
+	return repos.Outbox.Add(ctx, domain.NewWithdrawalEvent(userID, withdraw))
+}
+
+func (s *WithdrawalService) balanceChanged(ctx context.Context, userID uint) {
+	for _, listener := range s.listeners {
+		listener.BalanceChanged(ctx, userID)
+	}
+}
+
+type expiryTask struct {
+	s *WithdrawalService
+}
+
+func (t *expiryTask) Execute(ctx context.Context) error {
+	defer t.s.expiryQueued.Store(false)
+	released, err := t.s.ReleaseExpired(ctx)
+	if released > 0 {
+		t.s.logger.Info("released expired withdrawal holds", zap.Int("count", released))
+	}
+	return err
+}
+
+func (t *expiryTask) Stringer() string {
+	return "release expired withdrawal holds"
+}
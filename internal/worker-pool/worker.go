@@ -296,7 +296,7 @@ func (wp *IWorkerPool) Submit(ctx context.Context, task Task) error {
         case <-ctx.Done():
                 return ctx.Err()
         default:
-                wp.logger.Warn("task queue is full, dropping task", zap.Any("task", task))
+                wp.logger.Warn("task queue is full, dropping task", zap.String("task", task.Stringer()))
                 return ErrWorkerPoolFull
         }
 }